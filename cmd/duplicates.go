@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cjs/purtypics/pkg/common"
+	"github.com/cjs/purtypics/pkg/gallery"
+	"github.com/cjs/purtypics/pkg/metadata"
+	"github.com/spf13/cobra"
+)
+
+var (
+	duplicatesSource    string
+	duplicatesOutput    string
+	duplicatesMetadata  string
+	duplicatesThreshold int
+)
+
+var duplicatesCmd = &cobra.Command{
+	Use:   "duplicates [path]",
+	Short: "Find duplicate and near-duplicate photos",
+	Long: `Find photos that appear more than once in a gallery, across all albums.
+
+Exact duplicates are byte-for-byte copies. Near duplicates are the same
+picture saved again: resized, recompressed or lightly edited. They are found
+by comparing perceptual hashes; raise --threshold to catch looser matches.
+
+Each group lists the best copy first (the most pixels, then the largest
+file). Hide the others in the editor's Duplicates tab, or set hidden: true
+for them in gallery.yaml.
+
+Usage:
+  purtypics duplicates                    # Check the gallery in current directory
+  purtypics duplicates /path/to/gallery   # Check the gallery in specified directory
+  purtypics duplicates -s ~/photos -t 12  # Explicit source, looser matching`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sourcePath := duplicatesSource
+		if sourcePath == "" {
+			sourcePath = "."
+			if len(args) > 0 {
+				sourcePath = args[0]
+			}
+		}
+		metadataPath := filepath.Join(sourcePath, "gallery.yaml")
+		if duplicatesMetadata != "" {
+			metadataPath = common.ResolvePath(duplicatesMetadata, sourcePath)
+		}
+
+		// Skip the generated gallery, whose renditions would all match
+		// their originals; it defaults to where generate puts it
+		outputPath := duplicatesOutput
+		if outputPath == "" {
+			outputPath = "gallery"
+			if filepath.IsAbs(sourcePath) {
+				outputPath = filepath.Join(filepath.Dir(sourcePath), "gallery")
+			}
+		}
+
+		if err := common.ValidateDirectory(sourcePath); err != nil {
+			return err
+		}
+		meta, err := metadata.Load(metadataPath)
+		if err != nil {
+			return fmt.Errorf("loading metadata: %w", err)
+		}
+		albums, err := gallery.ScanDirectory(sourcePath, outputPath)
+		if err != nil {
+			return fmt.Errorf("scanning albums: %w", err)
+		}
+
+		progress := func(current, total int, message string) {
+			fmt.Printf("\r\033[K[%3d%%] %s", current*100/total, message)
+			if current == total {
+				fmt.Printf("\r\033[K")
+			}
+		}
+		groups, errs := gallery.NewDuplicateFinder(duplicatesThreshold).Find(albums, meta, progress)
+		for _, err := range errs {
+			fmt.Printf("Warning: skipping %v\n", err)
+		}
+
+		if len(groups) == 0 {
+			fmt.Println("No duplicates found")
+			return nil
+		}
+		for i, group := range groups {
+			kind := "Near duplicates"
+			if group.Exact {
+				kind = "Exact duplicates"
+			}
+			fmt.Printf("%s (%d copies):\n", kind, len(group.Photos))
+			table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for j, photo := range group.Photos {
+				rel, err := filepath.Rel(sourcePath, photo.Path)
+				if err != nil {
+					rel = photo.Path
+				}
+				var notes []string
+				if j == 0 {
+					notes = append(notes, "best")
+				}
+				if photo.Hidden {
+					notes = append(notes, "hidden")
+				}
+				note := ""
+				if len(notes) > 0 {
+					note = "  (" + strings.Join(notes, ", ") + ")"
+				}
+				fmt.Fprintf(table, "  %s\t%dx%d\t%s%s\n", rel, photo.Width, photo.Height, formatSize(photo.Size), note)
+			}
+			table.Flush()
+			if i < len(groups)-1 {
+				fmt.Println()
+			}
+		}
+		return nil
+	},
+}
+
+// formatSize renders a file size in the largest unit below it, e.g. 2.4 MB
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGT"[exp])
+}
+
+func init() {
+	rootCmd.AddCommand(duplicatesCmd)
+
+	duplicatesCmd.Flags().StringVarP(&duplicatesSource, "source", "s", "", "Source directory containing photos")
+	duplicatesCmd.Flags().StringVarP(&duplicatesOutput, "output", "o", "", "Output directory of the generated gallery, which is skipped")
+	duplicatesCmd.Flags().StringVar(&duplicatesMetadata, "metadata", "", "Path to metadata file (default: gallery.yaml in source)")
+	duplicatesCmd.Flags().IntVarP(&duplicatesThreshold, "threshold", "t", gallery.DefaultDuplicateThreshold, "Bits of the 64-bit perceptual hashes that may differ between near duplicates")
+}
@@ -15,7 +15,11 @@ var (
 	generateOutput   string
 	generateMetadata string
 	generateTitle    string
+	generateBaseURL  string
 	generateVerbose  bool
+	generateNoCache  bool
+	generatePrune    bool
+	generateNoPrune  bool
 )
 
 var generateCmd = &cobra.Command{
@@ -108,9 +112,11 @@ Otherwise, it expects a gallery directory with photos, gallery.yaml, and output/
 		}
 
 		// Create gallery generator
-		generator := gallery.NewGenerator(sourcePath, outputPath, title, "", version, generateVerbose)
+		generator := gallery.NewGenerator(sourcePath, outputPath, title, generateBaseURL, version, generateVerbose)
 		generator.MetadataPath = metadataPath
 		generator.ProgressCallback = progressCallback
+		generator.NoCache = generateNoCache
+		generator.NoPrune = generateNoPrune || !generatePrune
 
 		fmt.Printf("Generating gallery from %s...\n", sourcePath)
 		
@@ -134,7 +140,11 @@ func init() {
 	generateCmd.Flags().StringVarP(&generateOutput, "output", "o", "", "Output directory for the gallery (overrides default behavior)")
 	generateCmd.Flags().StringVar(&generateMetadata, "metadata", "", "Path to metadata file (default: gallery.yaml in source)")
 	generateCmd.Flags().StringVar(&generateTitle, "title", "", "Title for the gallery (overrides metadata)")
+	generateCmd.Flags().StringVar(&generateBaseURL, "base-url", "", "Public URL of the gallery, used for absolute links (overrides metadata)")
 	generateCmd.Flags().BoolVarP(&generateVerbose, "verbose", "v", false, "Enable verbose output")
+	generateCmd.Flags().BoolVar(&generateNoCache, "no-cache", false, "Ignore the build manifest and reprocess every photo")
+	generateCmd.Flags().BoolVar(&generatePrune, "prune", true, "Remove thumbnails, videos and pages no longer produced by the build")
+	generateCmd.Flags().BoolVar(&generateNoPrune, "no-prune", false, "Keep stale output files (same as --prune=false)")
 
 	rootCmd.AddCommand(generateCmd)
 }
\ No newline at end of file
@@ -456,7 +456,7 @@ func (c *CloudflareDeployer) collectFiles() ([]fileEntry, []largeFileEntry, erro
 		}
 		rel = filepath.ToSlash(rel)
 
-		if rel == "gallery.yaml" || rel == "deploy.yaml" {
+		if rel == "gallery.yaml" || rel == "deploy.yaml" || rel == ".purtypics-manifest.json" {
 			return nil
 		}
 
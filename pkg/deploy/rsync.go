@@ -158,6 +158,8 @@ func (r *RsyncDeployer) buildArgs() []string {
 		"gallery.yaml",
 		"--exclude",         // exclude deploy.yaml from deployment
 		"deploy.yaml",
+		"--exclude",         // exclude the build manifest from deployment
+		".purtypics-manifest.json",
 	}
 
 	// Add port if specified
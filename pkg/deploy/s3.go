@@ -326,7 +326,7 @@ func (d *S3Deployer) collectFiles() ([]string, error) {
 		}
 		rel = filepath.ToSlash(rel)
 
-		if rel == "gallery.yaml" || rel == "deploy.yaml" {
+		if rel == "gallery.yaml" || rel == "deploy.yaml" || rel == ".purtypics-manifest.json" {
 			return nil
 		}
 
@@ -5,10 +5,13 @@ import (
 	"net/http"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/cjs/purtypics/pkg/exif"
 	"github.com/cjs/purtypics/pkg/gallery"
+	"github.com/cjs/purtypics/pkg/metadata"
 )
 
 // handleAlbums returns album information
@@ -19,15 +22,18 @@ func (s *Server) handleAlbums(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type albumResponse struct {
-		Path        string    `json:"path"`
-		RelativePath string   `json:"relativePath"`
-		Title       string    `json:"title"`
-		Description string    `json:"description"`
-		PhotoCount  int       `json:"photoCount"`
-		CoverPhoto  string    `json:"coverPhoto"`
-		Hidden      bool      `json:"hidden"`
-		Date        time.Time `json:"date"`
-		Photos      []string  `json:"photos"`
+		Path         string    `json:"path"`
+		RelativePath string    `json:"relativePath"`
+		ParentPath   string    `json:"parentPath"`
+		Depth        int       `json:"depth"`
+		Children     []string  `json:"children"`
+		Title        string    `json:"title"`
+		Description  string    `json:"description"`
+		PhotoCount   int       `json:"photoCount"`
+		CoverPhoto   string    `json:"coverPhoto"`
+		Hidden       bool      `json:"hidden"`
+		Date         time.Time `json:"date"`
+		Photos       []string  `json:"photos"`
 	}
 
 	albums := make([]albumResponse, len(s.albums))
@@ -38,12 +44,15 @@ func (s *Server) handleAlbums(w http.ResponseWriter, r *http.Request) {
 			photos[j] = photo.Filename
 		}
 		
-		// Convert absolute path to relative path for metadata lookup
-		relPath, _ := filepath.Rel(s.SourcePath, album.Path)
+		// The album ID is its path relative to the source directory
+		relPath := album.ID
 		
 		resp := albumResponse{
 			Path:         album.Path,
 			RelativePath: relPath,
+			ParentPath:   album.ParentID,
+			Depth:        album.Depth(),
+			Children:     []string{},
 			Title:        album.Title,
 			PhotoCount:   len(album.Photos),
 			Photos:       photos,
@@ -85,6 +94,27 @@ func (s *Server) handleAlbums(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
+	// Arrange the list as a tree walk: each album is followed by its nested
+	// albums, with siblings kept in the order established above
+	byParent := make(map[string][]int)
+	for i, album := range albums {
+		byParent[album.ParentPath] = append(byParent[album.ParentPath], i)
+	}
+	ordered := make([]albumResponse, 0, len(albums))
+	var visit func(parent string)
+	visit = func(parent string) {
+		for _, i := range byParent[parent] {
+			album := albums[i]
+			for _, child := range byParent[album.RelativePath] {
+				album.Children = append(album.Children, albums[child].RelativePath)
+			}
+			ordered = append(ordered, album)
+			visit(album.RelativePath)
+		}
+	}
+	visit("")
+	albums = ordered
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(albums)
 }
@@ -124,8 +154,9 @@ func (s *Server) handlePhotos(w http.ResponseWriter, r *http.Request) {
 		Thumbnails  map[string]string `json:"thumbnails"`
 	}
 
-	photos := make([]photoResponse, len(album.Photos))
-	for i, photo := range album.Photos {
+	ordered := s.orderedPhotos(album)
+	photos := make([]photoResponse, len(ordered))
+	for i, photo := range ordered {
 		photoPath := filepath.Join(album.Path, photo.Filename)
 		resp := photoResponse{
 			Path:       photoPath,
@@ -147,4 +178,129 @@ func (s *Server) handlePhotos(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(photos)
-}
\ No newline at end of file
+}
+
+// orderedPhotos returns a copy of the album's photos in the order the
+// generator will publish them, so drag-and-drop starts from what users see.
+func (s *Server) orderedPhotos(album *gallery.Album) []gallery.Photo {
+	sorted := gallery.Album{
+		ID:     album.ID,
+		Photos: append([]gallery.Photo(nil), album.Photos...),
+	}
+
+	sortOrder, customOrder := "", []string(nil)
+	if meta := s.metadata.GetAlbumMetadata(album.ID); meta != nil {
+		sortOrder, customOrder = meta.SortOrder, meta.CustomOrder
+	}
+
+	for i := range sorted.Photos {
+		photo := &sorted.Photos[i]
+		if meta := s.metadata.GetPhotoMetadata(filepath.Join(album.Path, photo.Filename)); meta != nil {
+			photo.SortIndex = meta.SortIndex
+		}
+		// Date ordering needs EXIF, which the editor doesn't load up front
+		if sortOrder != gallery.SortByName && photo.EXIF == nil && !photo.IsVideo {
+			if data, err := exif.ExtractMetadata(photo.Path); err == nil {
+				photo.EXIF = data
+			}
+		}
+	}
+
+	sorted.SortPhotos(sortOrder, customOrder)
+	return sorted.Photos
+}
+
+// handleDuplicates reports photos that appear more than once across albums,
+// as exact copies or as near duplicates. The threshold query parameter
+// loosens or tightens near-duplicate matching.
+func (s *Server) handleDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	threshold := gallery.DefaultDuplicateThreshold
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 64 {
+			http.Error(w, "Threshold must be between 0 and 64", http.StatusBadRequest)
+			return
+		}
+		threshold = n
+	}
+
+	s.duplicatesMutex.Lock()
+	if s.duplicates == nil {
+		s.duplicates = gallery.NewDuplicateFinder(threshold)
+	}
+	s.duplicates.Threshold = threshold
+	groups, errs := s.duplicates.Find(s.albums, s.metadata, nil)
+	s.duplicatesMutex.Unlock()
+
+	type duplicatesResponse struct {
+		Groups  []gallery.DuplicateGroup `json:"groups"`
+		Skipped []string                 `json:"skipped"` // photos that couldn't be read
+	}
+	resp := duplicatesResponse{
+		Groups:  groups,
+		Skipped: []string{},
+	}
+	if resp.Groups == nil {
+		resp.Groups = []gallery.DuplicateGroup{}
+	}
+	for _, err := range errs {
+		resp.Skipped = append(resp.Skipped, err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleStacks suggests stacks for an album's bursts and similar shots.
+// Photos already in a stack are left out, so accepting every suggestion
+// never puts a photo in two stacks.
+func (s *Server) handleStacks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	albumPath := filepath.Join(s.SourcePath, strings.TrimPrefix(r.URL.Path, "/api/stacks/"))
+	var album *gallery.Album
+	for i := range s.albums {
+		if s.albums[i].Path == albumPath {
+			album = &s.albums[i]
+			break
+		}
+	}
+	if album == nil {
+		http.Error(w, "Album not found", http.StatusNotFound)
+		return
+	}
+
+	// Stacks share the duplicate finder's hashes
+	s.duplicatesMutex.Lock()
+	if s.duplicates == nil {
+		s.duplicates = gallery.NewDuplicateFinder(gallery.DefaultDuplicateThreshold)
+	}
+	stacks, errs := s.duplicates.FindStacks(*album, s.metadata, gallery.DefaultStackGap, gallery.DefaultStackThreshold)
+	s.duplicatesMutex.Unlock()
+
+	type stacksResponse struct {
+		Stacks  []metadata.PhotoStack `json:"stacks"`
+		Skipped []string              `json:"skipped"` // photos that couldn't be read
+	}
+	resp := stacksResponse{
+		Stacks:  stacks,
+		Skipped: []string{},
+	}
+	if resp.Stacks == nil {
+		resp.Stacks = []metadata.PhotoStack{}
+	}
+	for _, err := range errs {
+		resp.Skipped = append(resp.Skipped, err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
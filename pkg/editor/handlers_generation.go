@@ -59,7 +59,7 @@ func (s *Server) runGeneration() {
 	// First, scan to count total photos
 	s.genTracker.Update(1, "Scanning albums...")
 	
-	albums, err := gallery.ScanDirectory(s.SourcePath)
+	albums, err := gallery.ScanDirectory(s.SourcePath, outputPath)
 	if err != nil {
 		s.genTracker.SetError(fmt.Sprintf("Failed to scan directory: %v", err))
 		return
@@ -2,16 +2,19 @@ package editor
 
 import (
 	"fmt"
-	"image"
 	"image/jpeg"
 	"image/png"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
-	"github.com/cjs/purtypics/pkg/exif"
-	"github.com/disintegration/imaging"
+	"github.com/cjs/purtypics/pkg/gallery"
+	"github.com/cjs/purtypics/pkg/image"
+	"github.com/cjs/purtypics/pkg/metadata"
 )
 
 // handleThumbnails dynamically generates thumbnails
@@ -23,22 +26,18 @@ func (s *Server) handleThumbnails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	size := parts[0]
+	sizeName := parts[0]
 	imagePath := strings.Join(parts[1:], "/")
 	fullPath := filepath.Join(s.SourcePath, imagePath)
 	
-	// Validate size
-	var width int
-	switch size {
-	case "small":
-		width = 300
-	case "medium":
-		width = 800
-	case "large":
-		width = 1600
-	default:
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		return
+	// Use the sizes the gallery generates. The editor asks for the built-in
+	// names, so one the gallery disabled falls back to the smallest size.
+	sizes, _ := gallery.RenderingSizes(s.metadata)
+	size := sizes[0]
+	for _, candidate := range sizes {
+		if candidate.Name == sizeName {
+			size = candidate
+		}
 	}
 	
 	// Check if source file exists
@@ -47,28 +46,38 @@ func (s *Server) handleThumbnails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// Open the image
-	img, err := imaging.Open(fullPath)
+	// Open the image, oriented and decoded the way the generator does it
+	img, err := image.Open(fullPath)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error opening image: %v", err), http.StatusInternalServerError)
 		return
 	}
 	
-	// Apply EXIF orientation
-	oriented, err := applyOrientation(fullPath, img)
-	if err == nil {
-		img = oriented
+	// Frame it as the metadata says, or as the photo modal is previewing
+	edit, err := previewEdit(s.metadata.GetPhotoMetadata(fullPath), r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	
-	// Resize the image
-	resized := imaging.Resize(img, width, 0, imaging.Lanczos)
+	img = edit.Apply(img)
+
+	// Adjust its tones the same way
+	adjustments, err := previewAdjustments(s.metadata, path.Dir(imagePath), s.metadata.GetPhotoMetadata(fullPath), r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	img = adjustments.Apply(img)
+
+	// Resize the image the way the generator will
+	resized := size.Render(img)
 	
 	// Set content type based on file extension
 	ext := strings.ToLower(filepath.Ext(fullPath))
 	switch ext {
 	case ".jpg", ".jpeg":
 		w.Header().Set("Content-Type", "image/jpeg")
-		if err := jpeg.Encode(w, resized, &jpeg.Options{Quality: 90}); err != nil {
+		if err := jpeg.Encode(w, resized, &jpeg.Options{Quality: size.Quality}); err != nil {
 			http.Error(w, "Error encoding image", http.StatusInternalServerError)
 		}
 	case ".png":
@@ -79,42 +88,95 @@ func (s *Server) handleThumbnails(w http.ResponseWriter, r *http.Request) {
 	default:
 		// Default to JPEG
 		w.Header().Set("Content-Type", "image/jpeg")
-		if err := jpeg.Encode(w, resized, &jpeg.Options{Quality: 90}); err != nil {
+		if err := jpeg.Encode(w, resized, &jpeg.Options{Quality: size.Quality}); err != nil {
 			http.Error(w, "Error encoding image", http.StatusInternalServerError)
 		}
 	}
 }
 
-// applyOrientation applies EXIF orientation to an image
-func applyOrientation(imagePath string, img image.Image) (image.Image, error) {
-	file, err := os.Open(imagePath)
-	if err != nil {
-		return img, err
+// previewEdit returns a photo's edit with unsaved changes from the query:
+// rotate and straighten in degrees, and crop as x,y,width,height fractions
+// or "none" to show the whole rotated photo, as the crop tool needs
+func previewEdit(meta *metadata.PhotoMetadata, query url.Values) (image.Edit, error) {
+	var photo metadata.PhotoMetadata
+	if meta != nil {
+		photo = *meta
 	}
-	defer file.Close()
-
-	orientation := 1
-	exifData, err := exif.ExtractMetadata(imagePath)
-	if err == nil && exifData != nil {
-		orientation = exifData.Orientation
+	if value := query.Get("rotate"); value != "" {
+		degrees, err := strconv.Atoi(value)
+		if err != nil {
+			return image.Edit{}, fmt.Errorf("invalid rotate %q", value)
+		}
+		photo.Rotate = degrees
 	}
+	if value := query.Get("straighten"); value != "" {
+		degrees, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return image.Edit{}, fmt.Errorf("invalid straighten %q", value)
+		}
+		photo.Straighten = degrees
+	}
+	switch value := query.Get("crop"); value {
+	case "":
+	case "none":
+		photo.Crop = nil
+	default:
+		parts := strings.Split(value, ",")
+		if len(parts) != 4 {
+			return image.Edit{}, fmt.Errorf("invalid crop %q, want x,y,width,height", value)
+		}
+		var v [4]float64
+		for i, part := range parts {
+			f, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return image.Edit{}, fmt.Errorf("invalid crop %q, want x,y,width,height", value)
+			}
+			v[i] = f
+		}
+		photo.Crop = &metadata.CropRegion{X: v[0], Y: v[1], Width: v[2], Height: v[3]}
+	}
+	return gallery.PhotoEdit(&photo), nil
+}
 
-	switch orientation {
-	case 2: // Flip horizontal
-		return imaging.FlipH(img), nil
-	case 3: // Rotate 180
-		return imaging.Rotate180(img), nil
-	case 4: // Flip vertical
-		return imaging.FlipV(img), nil
-	case 5: // Transpose (flip horizontal and rotate 270)
-		return imaging.Rotate270(imaging.FlipH(img)), nil
-	case 6: // Rotate 90
-		return imaging.Rotate270(img), nil
-	case 7: // Transverse (flip horizontal and rotate 90)
-		return imaging.Rotate90(imaging.FlipH(img)), nil
-	case 8: // Rotate 270
-		return imaging.Rotate90(img), nil
+// previewAdjustments returns a photo's tonal adjustments with unsaved
+// changes from the query: preset, gamma, brightness, contrast, saturation and
+// grayscale replace the photo's own, adjust=album shows what it inherits from
+// its album and adjust=none shows it unadjusted, as the before view needs
+func previewAdjustments(meta *metadata.GalleryMetadata, albumID string, photoMeta *metadata.PhotoMetadata, query url.Values) (image.Adjustments, error) {
+	var photo metadata.PhotoMetadata
+	if photoMeta != nil {
+		photo = *photoMeta
+	}
+	switch query.Get("adjust") {
+	case "":
+	case "none":
+		photo.Adjustments = &metadata.Adjustments{}
+	case "album":
+		photo.Adjustments = nil
 	default:
-		return img, nil
+		return image.Adjustments{}, fmt.Errorf("invalid adjust %q, want none or album", query.Get("adjust"))
+	}
+
+	if query.Has("preset") || query.Has("gamma") || query.Has("brightness") || query.Has("contrast") || query.Has("saturation") || query.Has("grayscale") {
+		adj := metadata.Adjustments{Preset: query.Get("preset"), Grayscale: query.Get("grayscale") == "true"}
+		for name, field := range map[string]*float64{
+			"gamma":      &adj.Gamma,
+			"brightness": &adj.Brightness,
+			"contrast":   &adj.Contrast,
+			"saturation": &adj.Saturation,
+		} {
+			if value := query.Get(name); value != "" {
+				f, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return image.Adjustments{}, fmt.Errorf("invalid %s %q", name, value)
+				}
+				*field = f
+			}
+		}
+		photo.Adjustments = &adj
 	}
-}
\ No newline at end of file
+
+	// An unknown preset is left out, as the generator does
+	adjustments, _ := gallery.PhotoAdjustments(meta, albumID, &photo)
+	return adjustments, nil
+}
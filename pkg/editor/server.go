@@ -34,6 +34,10 @@ type Server struct {
 	deployStatus   string
 	deployError    string
 	deployMutex    sync.RWMutex
+
+	// Perceptual hashes are kept between duplicate checks
+	duplicates      *gallery.DuplicateFinder
+	duplicatesMutex sync.Mutex
 }
 
 // NewServer creates a new editor server
@@ -84,7 +88,7 @@ func (s *Server) StartWithListener(listener net.Listener) error {
 	s.metadata = meta
 
 	// Scan albums and sort by original photo dates
-	albums, err := gallery.ScanDirectory(s.SourcePath)
+	albums, err := gallery.ScanDirectory(s.SourcePath, s.OutputPath)
 	if err != nil {
 		return fmt.Errorf("scanning albums: %w", err)
 	}
@@ -99,6 +103,8 @@ func (s *Server) StartWithListener(listener net.Listener) error {
 	mux.HandleFunc("/api/metadata", s.handleMetadata)
 	mux.HandleFunc("/api/albums", s.handleAlbums)
 	mux.HandleFunc("/api/photos/", s.handlePhotos)
+	mux.HandleFunc("/api/duplicates", s.handleDuplicates)
+	mux.HandleFunc("/api/stacks/", s.handleStacks)
 	mux.HandleFunc("/api/save", s.handleSave)
 	mux.HandleFunc("/api/generate", s.handleGenerate)
 	mux.HandleFunc("/api/generate/progress", s.handleGenerateProgress)
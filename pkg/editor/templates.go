@@ -23,6 +23,7 @@ const editorHTML = `<!DOCTYPE html>
             <button class="tab-btn active" data-tab="gallery">Gallery</button>
             <button class="tab-btn" data-tab="albums">Albums</button>
             <button class="tab-btn" data-tab="photos">Photos</button>
+            <button class="tab-btn" data-tab="duplicates">Duplicates</button>
             <button class="tab-btn" data-tab="deploy">Deploy</button>
         </div>
 
@@ -47,6 +48,11 @@ const editorHTML = `<!DOCTYPE html>
                         <label for="gallery-copyright">Copyright</label>
                         <input type="text" id="gallery-copyright" class="form-control">
                     </div>
+                    <div class="form-group">
+                        <label for="gallery-base-url">Site URL</label>
+                        <input type="url" id="gallery-base-url" class="form-control" placeholder="https://photos.example.com">
+                        <p style="margin-top: 5px; font-size: 12px; color: var(--text-secondary);">Public address of the published gallery, used for share previews and other absolute links</p>
+                    </div>
                     <div class="form-group">
                         <label for="gallery-theme">Theme</label>
                         <select id="gallery-theme" class="form-control">
@@ -78,10 +84,29 @@ const editorHTML = `<!DOCTYPE html>
                     <select id="photo-album-select" class="form-control">
                         <option value="">Choose an album...</option>
                     </select>
+                    <button type="button" id="photos-find-stacks" class="btn btn-secondary">Stack bursts</button>
                 </div>
+                <p id="photos-order-hint" class="photos-order-hint">Drag photos to set a custom order for this album. Stacks show only their pick in the gallery; open one with its +N button.</p>
+                <p id="photos-stacks-status" class="photos-order-hint"></p>
                 <div id="photos-list" class="photos-grid"></div>
             </div>
 
+            <!-- Duplicates Tab -->
+            <div id="duplicates-tab" class="tab-pane">
+                <h2>Duplicates</h2>
+                <div class="album-selector">
+                    <label for="duplicates-threshold">Match:</label>
+                    <select id="duplicates-threshold" class="form-control">
+                        <option value="4">Strict (same picture, resized)</option>
+                        <option value="8" selected>Normal (also recompressed or lightly edited)</option>
+                        <option value="12">Loose (also retouched or recropped)</option>
+                    </select>
+                    <button type="button" id="duplicates-scan" class="btn btn-secondary">Scan again</button>
+                </div>
+                <p class="photos-order-hint">Photos that appear more than once across albums, best copy first. Keep one and the others are hidden from the gallery.</p>
+                <div id="duplicates-list"></div>
+            </div>
+
             <!-- Deploy Tab -->
             <div id="deploy-tab" class="tab-pane">
                 <h2>Deployment Settings</h2>
@@ -226,6 +251,26 @@ const editorHTML = `<!DOCTYPE html>
                     <label for="album-description">Description</label>
                     <textarea id="album-description" class="form-control" rows="3"></textarea>
                 </div>
+                <div class="form-group">
+                    <label for="album-tags">Tags</label>
+                    <input type="text" id="album-tags" class="form-control" placeholder="travel, family">
+                </div>
+
+                <div class="form-group">
+                    <label for="album-sort-order">Photo Order</label>
+                    <select id="album-sort-order" class="form-control">
+                        <option value="date">Date taken (oldest first)</option>
+                        <option value="date_desc">Date taken (newest first)</option>
+                        <option value="name">Filename</option>
+                        <option value="custom">Custom (drag photos in the Photos tab)</option>
+                    </select>
+                </div>
+
+                <div class="form-group">
+                    <label for="album-adjust-preset">Adjustments</label>
+                    <select id="album-adjust-preset" class="form-control"></select>
+                    <small class="photos-order-hint">Applied to the album's photos that have no adjustments of their own</small>
+                </div>
 
                 <div class="form-group">
                     <label for="album-cover">Cover Photo</label>
@@ -247,7 +292,54 @@ const editorHTML = `<!DOCTYPE html>
         <div class="modal-content">
             <h3>Edit Photo</h3>
             <div class="photo-preview">
-                <img id="photo-preview-img" src="" alt="">
+                <div class="focal-frame">
+                    <img id="photo-preview-img" src="" alt="" title="Click to set the focal point">
+                    <div id="photo-focal-marker" class="focal-marker"></div>
+                    <div id="photo-crop-box" class="crop-box"></div>
+                </div>
+                <div class="focal-hint">
+                    <span id="photo-focal-label">Focal point: automatic</span>
+                    <button type="button" id="photo-focal-clear" class="btn-link" onclick="setFocalPoint(null)">Reset</button>
+                </div>
+                <div id="photo-edit-tools" class="edit-tools">
+                    <button type="button" class="btn btn-secondary" onclick="rotatePhoto(-90)" title="Rotate left">&#8634;</button>
+                    <button type="button" class="btn btn-secondary" onclick="rotatePhoto(90)" title="Rotate right">&#8635;</button>
+                    <label for="photo-straighten">Straighten</label>
+                    <input type="range" id="photo-straighten" min="-45" max="45" step="0.5" value="0">
+                    <span id="photo-straighten-value">0°</span>
+                    <button type="button" id="photo-crop-toggle" class="btn btn-secondary" onclick="toggleCropping()">Crop</button>
+                    <button type="button" class="btn-link" onclick="resetPhotoEdit()">Reset</button>
+                </div>
+                <div id="photo-adjust-tools" class="adjust-tools">
+                    <div class="adjust-compare">
+                        <figure><img id="photo-adjust-before" src="" alt="Before"><figcaption>Before</figcaption></figure>
+                        <figure><img id="photo-adjust-after" src="" alt="After"><figcaption>After</figcaption></figure>
+                    </div>
+                    <div class="adjust-controls">
+                        <label for="photo-adjust-preset">Adjustments</label>
+                        <select id="photo-adjust-preset" class="form-control"></select>
+                        <label for="photo-adjust-brightness">Brightness</label>
+                        <input type="range" id="photo-adjust-brightness" min="-100" max="100" step="1" value="0">
+                        <span id="photo-adjust-brightness-value">0</span>
+                        <label for="photo-adjust-contrast">Contrast</label>
+                        <input type="range" id="photo-adjust-contrast" min="-100" max="100" step="1" value="0">
+                        <span id="photo-adjust-contrast-value">0</span>
+                        <label for="photo-adjust-gamma">Gamma</label>
+                        <input type="range" id="photo-adjust-gamma" min="0.2" max="3" step="0.05" value="1">
+                        <span id="photo-adjust-gamma-value">1</span>
+                        <label for="photo-adjust-saturation">Saturation</label>
+                        <input type="range" id="photo-adjust-saturation" min="-100" max="200" step="1" value="0">
+                        <span id="photo-adjust-saturation-value">0</span>
+                        <label for="photo-adjust-grayscale">Black and white</label>
+                        <input type="checkbox" id="photo-adjust-grayscale">
+                        <span></span>
+                    </div>
+                    <div class="focal-hint">
+                        Sliders set away from the middle override the preset.
+                        <button type="button" class="btn-link" onclick="savePhotoAdjustPreset()">Save as preset</button>
+                        <button type="button" class="btn-link" onclick="resetPhotoAdjustments()">Reset</button>
+                    </div>
+                </div>
             </div>
             <form id="photo-form">
                 <input type="hidden" id="photo-path">
@@ -259,6 +351,10 @@ const editorHTML = `<!DOCTYPE html>
                     <label for="photo-description">Description</label>
                     <textarea id="photo-description" class="form-control" rows="3"></textarea>
                 </div>
+                <div class="form-group">
+                    <label for="photo-tags">Tags</label>
+                    <input type="text" id="photo-tags" class="form-control" placeholder="sunset, landscape">
+                </div>
                 <div class="form-group">
                     <label for="photo-hidden">
                         <input type="checkbox" id="photo-hidden">
@@ -629,10 +725,52 @@ textarea.form-control {
     cursor: grabbing;
 }
 
-.album-card.dragging {
+.album-card.dragging, .photo-card.dragging {
     opacity: 0.4;
 }
 
+.photo-card[draggable="true"] img {
+    pointer-events: none;
+}
+
+.photos-order-hint {
+    margin: 10px 0 0;
+    font-size: 12px;
+    color: var(--text-secondary);
+}
+
+.photo-card.stack-pick {
+    box-shadow: 4px 4px 0 var(--bg-secondary), 5px 5px 0 var(--border-light);
+}
+
+.photo-card.stack-member {
+    border-left: 3px solid var(--accent-teal);
+}
+
+.photo-card.stack-collapsed {
+    display: none;
+}
+
+.photo-card .stack-actions {
+    display: flex;
+    gap: 8px;
+    margin-top: 8px;
+}
+
+.photo-card .stack-actions .btn {
+    padding: 6px 12px;
+    font-size: 12px;
+}
+
+.album-card.nested-album {
+    border-left: 3px solid var(--accent-teal);
+}
+
+.album-card p.album-parent {
+    font-size: 12px;
+    margin-bottom: 4px;
+}
+
 .album-card:hover, .photo-card:hover {
     transform: translateY(-2px);
     border-color: var(--accent-teal);
@@ -840,6 +978,115 @@ textarea.form-control {
     border-radius: 4px;
 }
 
+.focal-frame {
+    position: relative;
+    display: inline-block;
+    line-height: 0;
+}
+
+.focal-frame img {
+    cursor: crosshair;
+}
+
+.focal-marker {
+    display: none;
+    position: absolute;
+    width: 20px;
+    height: 20px;
+    margin: -10px 0 0 -10px;
+    border: 2px solid #fff;
+    border-radius: 50%;
+    box-shadow: 0 0 0 1px rgba(0, 0, 0, 0.6);
+    pointer-events: none;
+}
+
+.crop-box {
+    display: none;
+    position: absolute;
+    border: 1px dashed #fff;
+    box-shadow: 0 0 0 9999px rgba(0, 0, 0, 0.5);
+    pointer-events: none;
+}
+
+.focal-frame.cropping {
+    overflow: hidden;
+}
+
+.focal-frame.cropping .focal-marker {
+    display: none !important;
+}
+
+.edit-tools {
+    display: flex;
+    align-items: center;
+    justify-content: center;
+    gap: 8px;
+    margin-top: 10px;
+    font-size: 13px;
+    color: var(--text-secondary);
+}
+
+.edit-tools .btn {
+    padding: 4px 10px;
+    font-size: 13px;
+}
+
+.edit-tools input[type="range"] {
+    width: 140px;
+}
+
+.adjust-tools {
+    margin-top: 14px;
+}
+
+.adjust-compare {
+    display: flex;
+    justify-content: center;
+    gap: 10px;
+}
+
+.adjust-compare figure {
+    margin: 0;
+    font-size: 12px;
+    color: var(--text-secondary);
+}
+
+.adjust-compare img {
+    max-width: 220px;
+    max-height: 160px;
+    border-radius: 4px;
+}
+
+.adjust-controls {
+    display: grid;
+    grid-template-columns: auto 1fr 40px;
+    align-items: center;
+    gap: 6px 10px;
+    margin-top: 10px;
+    font-size: 13px;
+    color: var(--text-secondary);
+    text-align: left;
+}
+
+.adjust-controls select {
+    grid-column: span 2;
+}
+
+.focal-hint {
+    margin-top: 8px;
+    font-size: 13px;
+    color: var(--text-secondary);
+}
+
+.btn-link {
+    background: none;
+    border: none;
+    padding: 0 4px;
+    color: var(--accent-teal-dark);
+    cursor: pointer;
+    font-size: inherit;
+}
+
 .album-selector {
     margin-bottom: 20px;
 }
@@ -853,6 +1100,35 @@ textarea.form-control {
     min-width: 300px;
 }
 
+.duplicate-group {
+    margin-top: 20px;
+}
+
+.duplicate-group h3 {
+    font-size: 14px;
+    text-transform: uppercase;
+    color: var(--text-secondary);
+}
+
+.duplicate-group .photos-grid {
+    grid-template-columns: repeat(auto-fill, minmax(200px, 1fr));
+    margin-top: 10px;
+}
+
+.duplicate-group .photo-card {
+    cursor: default;
+}
+
+.duplicate-group .photo-card.is-hidden img {
+    opacity: 0.4;
+}
+
+.duplicate-group .photo-card .btn {
+    margin-top: 8px;
+    padding: 6px 12px;
+    font-size: 12px;
+}
+
 .hidden-badge {
     display: inline-block;
     background: var(--error-red);
@@ -989,6 +1265,7 @@ function updateGalleryForm() {
     document.getElementById('gallery-description').value = metadata.description || '';
     document.getElementById('gallery-author').value = metadata.author || '';
     document.getElementById('gallery-copyright').value = metadata.copyright || '';
+    document.getElementById('gallery-base-url').value = metadata.base_url || '';
     document.getElementById('gallery-show-locations').checked = metadata.show_locations || false;
     loadThemes();
 }
@@ -1051,22 +1328,27 @@ function renderAlbums() {
             e.preventDefault();
             e.dataTransfer.dropEffect = 'move';
             const targetIndex = parseInt(card.dataset.index);
-            if (dragSrcIndex !== null && dragSrcIndex !== targetIndex) {
+            // Albums can only be reordered among their siblings
+            if (dragSrcIndex !== null && dragSrcIndex !== targetIndex &&
+                albums[dragSrcIndex].parentPath === albums[targetIndex].parentPath) {
                 const moved = albums.splice(dragSrcIndex, 1)[0];
                 albums.splice(targetIndex, 0, moved);
-                dragSrcIndex = targetIndex;
+                albums = flattenAlbumTree(albums);
+                dragSrcIndex = albums.indexOf(moved);
                 renderAlbums();
             }
         });
 
-        const albumName = album.path.split('/').pop();
         const coverImage = album.coverPhoto || (album.photos && album.photos.length > 0 ? album.photos[0] : 'placeholder.jpg');
+        const parentTrail = album.relativePath.split('/').slice(0, -1).join(' / ');
+        const childCount = album.children ? album.children.length : 0;
 
         card.innerHTML = ` + "`" + `
-            <img src="/images/${albumName}/${coverImage}" alt="${album.title}" onerror="this.src='data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 width=%22250%22 height=%22200%22 viewBox=%220 0 250 200%22><rect fill=%22%23ddd%22 width=%22250%22 height=%22200%22/><text fill=%22%23999%22 x=%2250%%22 y=%2250%%22 text-anchor=%22middle%22 dy=%22.3em%22>No Image</text></svg>'">
+            <img src="/images/${album.relativePath}/${coverImage}" alt="${album.title}" onerror="this.src='data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 width=%22250%22 height=%22200%22 viewBox=%220 0 250 200%22><rect fill=%22%23ddd%22 width=%22250%22 height=%22200%22/><text fill=%22%23999%22 x=%2250%%22 y=%2250%%22 text-anchor=%22middle%22 dy=%22.3em%22>No Image</text></svg>'">
             <div class="album-card-info">
+                ${parentTrail ? '<p class="album-parent">' + parentTrail + '</p>' : ''}
                 <h3>${album.title}${album.hidden ? '<span class="hidden-badge">Hidden</span>' : ''}</h3>
-                <p>${album.photoCount} ${album.photoCount === 1 ? 'photo' : 'photos'}</p>
+                <p>${album.photoCount} ${album.photoCount === 1 ? 'photo' : 'photos'}${childCount ? ' · ' + childCount + (childCount === 1 ? ' album' : ' albums') : ''}</p>
                 ${album.description ? '<p>' + album.description + '</p>' : ''}
             </div>
         ` + "`" + `;
@@ -1074,6 +1356,9 @@ function renderAlbums() {
         if (index === dragSrcIndex) {
             card.classList.add('dragging');
         }
+        if (album.depth > 1) {
+            card.classList.add('nested-album');
+        }
 
         container.appendChild(card);
     });
@@ -1083,6 +1368,35 @@ function updateAlbumOrder() {
     metadata.album_order = albums.map(a => a.relativePath);
 }
 
+// Reorder a flat album list so every album is followed by its nested albums,
+// keeping the current relative order among siblings
+function flattenAlbumTree(list) {
+    const byParent = {};
+    list.forEach(a => {
+        (byParent[a.parentPath] = byParent[a.parentPath] || []).push(a);
+    });
+    const result = [];
+    const visit = (parentPath) => {
+        (byParent[parentPath] || []).forEach(a => {
+            result.push(a);
+            visit(a.relativePath);
+        });
+    };
+    visit('');
+    return result;
+}
+
+// Split a comma-separated tag field into a clean list
+function parseTags(value) {
+    return value.split(',').map(t => t.trim()).filter(t => t !== '');
+}
+
+// Get an album's path relative to the source directory
+function albumRelPath(albumPath) {
+    const album = albums.find(a => a.path === albumPath);
+    return album ? album.relativePath : albumPath.split('/').pop();
+}
+
 // Populate album select for photos tab
 function populateAlbumSelect() {
     const select = document.getElementById('photo-album-select');
@@ -1093,7 +1407,7 @@ function populateAlbumSelect() {
     albums.forEach((album, index) => {
         const option = document.createElement('option');
         option.value = album.path;
-        option.textContent = album.title;
+        option.textContent = '\u00a0\u00a0'.repeat(Math.max(album.depth - 1, 0)) + album.title;
         select.appendChild(option);
         
         // Store the first album path
@@ -1117,8 +1431,7 @@ async function loadPhotos(albumPath) {
     }
     
     try {
-        const albumName = albumPath.split('/').pop();
-        const response = await fetch('/api/photos/' + albumName);
+        const response = await fetch('/api/photos/' + albumRelPath(albumPath));
         const photos = await response.json();
         
         renderPhotos(photos, albumPath);
@@ -1128,18 +1441,87 @@ async function loadPhotos(albumPath) {
 }
 
 // Render photos grid
+let currentPhotos = [];
+let photoDragSrcIndex = null;
+let photosBeforeDrag = null;
+
+// Picks whose stacks are shown open in the photos grid
+const openStacks = new Set();
+
+// The stack a photo belongs to, if any
+function stackOf(path) {
+    return (metadata.stacks || []).find(stack => stack.photos.includes(path)) || null;
+}
+
+// The photo a stack shows, like the generator: its pick while that is
+// visible, otherwise the first visible member in album order
+function stackPick(stack, photos) {
+    const isHidden = path => ((metadata.photos || {})[path] || {}).hidden || false;
+    const members = photos.map(p => p.path).filter(path => stack.photos.includes(path) && !isHidden(path));
+    if (members.includes(stack.pick)) return stack.pick;
+    return members.length > 0 ? members[0] : stack.photos[0];
+}
+
 function renderPhotos(photos, albumPath) {
     const container = document.getElementById('photos-list');
     container.innerHTML = '';
+    currentPhotos = photos;
     
-    const albumName = albumPath.split('/').pop();
+    const albumName = albumRelPath(albumPath);
     
-    photos.forEach(photo => {
+    const inAlbum = new Set(photos.map(p => p.path));
+    photos.forEach((photo, index) => {
+        const stack = stackOf(photo.path);
+        const pick = stack ? stackPick(stack, photos) : null;
+        const stackSize = stack ? stack.photos.filter(p => inAlbum.has(p)).length : 0;
         const card = document.createElement('div');
         card.className = 'photo-card';
+        if (stack && pick === photo.path) {
+            card.classList.add('stack-pick');
+        } else if (stack) {
+            card.classList.add('stack-member');
+            if (!openStacks.has(pick)) card.classList.add('stack-collapsed');
+        }
+        card.draggable = true;
+        card.dataset.index = index;
         card.onclick = () => editPhoto(photo, albumPath);
+
+        card.addEventListener('dragstart', (e) => {
+            photoDragSrcIndex = index;
+            photosBeforeDrag = currentPhotos.slice();
+            card.classList.add('dragging');
+            e.dataTransfer.effectAllowed = 'move';
+        });
+        card.addEventListener('dragend', () => {
+            if (photosBeforeDrag) {
+                const changed = currentPhotos.some((p, i) => p !== photosBeforeDrag[i]);
+                if (changed) {
+                    updatePhotoOrder(albumName);
+                    scheduleAutoSave();
+                }
+                photosBeforeDrag = null;
+            }
+            photoDragSrcIndex = null;
+            renderPhotos(currentPhotos, albumPath);
+        });
+        card.addEventListener('dragover', (e) => {
+            e.preventDefault();
+            e.dataTransfer.dropEffect = 'move';
+            const targetIndex = parseInt(card.dataset.index);
+            if (photoDragSrcIndex !== null && photoDragSrcIndex !== targetIndex) {
+                const moved = currentPhotos.splice(photoDragSrcIndex, 1)[0];
+                currentPhotos.splice(targetIndex, 0, moved);
+                photoDragSrcIndex = targetIndex;
+                renderPhotos(currentPhotos, albumPath);
+            }
+        });
         
-        const imageUrl = ` + "`" + `/images/${albumName}/${photo.filename}` + "`" + `;
+        // Edited photos are previewed framed and adjusted as they will be published
+        const edit = photoEditOf((metadata.photos || {})[photo.path] || {});
+        const adjust = resolveAdjustments(photoAdjustmentsOf(photo.path, albumName));
+        const imageUrl = isEdited(edit) || isAdjusted(adjust)
+            ? ` + "`" + `/thumbs/medium/${albumName}/${photo.filename}?${photoEditQuery(edit, edit.crop)}&${adjustmentsQuery(adjust)}` + "`" + `
+            : ` + "`" + `/images/${albumName}/${photo.filename}` + "`" + `;
         
         card.innerHTML = ` + "`" + `
             <img src="${imageUrl}" alt="${photo.title}" onerror="this.src='data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 width=%22250%22 height=%22200%22 viewBox=%220 0 250 200%22><rect fill=%22%23ddd%22 width=%22250%22 height=%22200%22/><text fill=%22%23999%22 x=%2250%%22 y=%2250%%22 text-anchor=%22middle%22 dy=%22.3em%22>No Image</text></svg>'">
@@ -1149,17 +1531,99 @@ function renderPhotos(photos, albumPath) {
                 ${photo.isVideo ? '<p>Video</p>' : ''}
             </div>
         ` + "`" + `;
+
+        if (stack) {
+            const actions = document.createElement('div');
+            actions.className = 'stack-actions';
+            const addAction = (label, handler) => {
+                const button = document.createElement('button');
+                button.type = 'button';
+                button.className = 'btn btn-secondary';
+                button.textContent = label;
+                button.addEventListener('click', (e) => {
+                    e.stopPropagation();
+                    handler();
+                    renderPhotos(currentPhotos, albumPath);
+                });
+                actions.appendChild(button);
+            };
+            if (pick === photo.path) {
+                addAction(openStacks.has(pick) ? 'Close stack' : ` + "`" + `+${stackSize - 1}` + "`" + `, () => {
+                    if (!openStacks.delete(pick)) openStacks.add(pick);
+                });
+                addAction('Unstack', () => {
+                    metadata.stacks = metadata.stacks.filter(s => s !== stack);
+                    openStacks.delete(pick);
+                    scheduleAutoSave();
+                });
+            } else {
+                addAction('Make pick', () => {
+                    stack.pick = photo.path;
+                    openStacks.delete(pick);
+                    openStacks.add(photo.path);
+                    scheduleAutoSave();
+                });
+            }
+            card.querySelector('.photo-card-info').appendChild(actions);
+        }
+
+        if (index === photoDragSrcIndex) {
+            card.classList.add('dragging');
+        }
         
         container.appendChild(card);
     });
 }
 
+// Ask the server for the album's bursts and stack them, each behind its
+// first shot
+async function findStacks() {
+    const albumPath = document.getElementById('photo-album-select').value;
+    const status = document.getElementById('photos-stacks-status');
+    if (!albumPath) {
+        status.textContent = 'Choose an album first.';
+        return;
+    }
+    status.textContent = 'Looking for bursts...';
+    try {
+        const response = await fetch('/api/stacks/' + albumRelPath(albumPath));
+        if (!response.ok) throw new Error(await response.text());
+        const result = await response.json();
+        if (result.stacks.length === 0) {
+            status.textContent = 'No new bursts found.';
+            return;
+        }
+        metadata.stacks = (metadata.stacks || []).concat(result.stacks);
+        const photoCount = result.stacks.reduce((n, stack) => n + stack.photos.length, 0);
+        status.textContent = ` + "`" + `Stacked ${photoCount} photos into ${result.stacks.length} stack(s).` + "`" + `;
+        renderPhotos(currentPhotos, albumPath);
+        scheduleAutoSave();
+    } catch (error) {
+        console.error('Error finding bursts:', error);
+        status.textContent = 'Error finding bursts';
+    }
+}
+
+// Store the dragged photo order as the album's custom order
+function updatePhotoOrder(albumRelativePath) {
+    if (!metadata.albums) metadata.albums = {};
+    const albumMeta = metadata.albums[albumRelativePath] || {};
+    albumMeta.sort_order = 'custom';
+    albumMeta.custom_order = currentPhotos.map(p => p.filename);
+    metadata.albums[albumRelativePath] = albumMeta;
+}
+
 // Edit album
 async function editAlbum(album) {
     document.getElementById('album-path').value = album.path;
     document.getElementById('album-relative-path').value = album.relativePath;
     document.getElementById('album-title').value = album.title;
     document.getElementById('album-description').value = album.description || '';
+    const albumMeta = (metadata.albums || {})[album.relativePath] || {};
+    document.getElementById('album-sort-order').value = albumMeta.sort_order || 'date';
+    document.getElementById('album-tags').value = (albumMeta.tags || []).join(', ');
+    fillPresetSelect(document.getElementById('album-adjust-preset'), 'None');
+    document.getElementById('album-adjust-preset').value = (albumMeta.adjustments || {}).preset || '';
 
     // Set cover photo - use first photo if none selected
     let coverPhoto = album.coverPhoto;
@@ -1180,7 +1644,7 @@ async function loadCoverPhotoOptions(album) {
     selector.innerHTML = '<div style="text-align: center; padding: 20px;">Loading photos...</div>';
     
     try {
-        const albumName = album.path.split('/').pop();
+        const albumName = album.relativePath;
         const response = await fetch('/api/photos/' + albumName);
         const photos = await response.json();
         
@@ -1238,19 +1702,319 @@ function selectCoverPhoto(filename, albumName) {
 
 // Edit photo
 function editPhoto(photo, albumPath) {
-    const albumName = albumPath.split('/').pop();
+    const albumName = albumRelPath(albumPath);
     document.getElementById('photo-path').value = photo.path;
     document.getElementById('photo-title').value = photo.title;
     document.getElementById('photo-description').value = photo.description || '';
     document.getElementById('photo-hidden').checked = photo.hidden || false;
+    const photoMeta = (metadata.photos || {})[photo.path] || {};
+    document.getElementById('photo-tags').value = (photoMeta.tags || []).join(', ');
     
     // Set preview image
-    const previewImg = document.getElementById('photo-preview-img');
-    previewImg.src = ` + "`" + `/images/${albumName}/${photo.filename}` + "`" + `;
+    photoPreviewPath = ` + "`" + `${albumName}/${photo.filename}` + "`" + `;
+    photoEdit = photoEditOf(photoMeta);
+    photoAlbumName = albumName;
+    setPhotoAdjustments(photoMeta.adjustments || null);
+    cropping = false;
+    document.getElementById('photo-edit-tools').style.display = photo.isVideo ? 'none' : 'flex';
+    document.getElementById('photo-adjust-tools').style.display = photo.isVideo ? 'none' : 'block';
+    updatePhotoPreview();
+    setFocalPoint(photoMeta.focal_point || null);
     
     document.getElementById('photo-modal').style.display = 'block';
 }
 
+// Focal point of the photo being edited, as fractions of its width and
+// height; null lets the generator find it
+let photoFocalPoint = null;
+
+function setFocalPoint(point) {
+    photoFocalPoint = point;
+    const marker = document.getElementById('photo-focal-marker');
+    const label = document.getElementById('photo-focal-label');
+    const clear = document.getElementById('photo-focal-clear');
+    if (point) {
+        marker.style.left = (point.x * 100) + '%';
+        marker.style.top = (point.y * 100) + '%';
+        marker.style.display = 'block';
+        label.textContent = ` + "`" + `Focal point: ${Math.round(point.x * 100)}%, ${Math.round(point.y * 100)}%` + "`" + `;
+        clear.style.display = 'inline';
+    } else {
+        marker.style.display = 'none';
+        label.textContent = 'Focal point: automatic (click the photo to set it)';
+        clear.style.display = 'none';
+    }
+}
+
+// Framing of the photo being edited, applied to previews through the query
+// of /thumbs/ until it is saved
+let photoPreviewPath = '';
+let photoEdit = {rotate: 0, straighten: 0, crop: null};
+let cropping = false;
+let cropStart = null;
+
+function photoEditOf(photoMeta) {
+    return {rotate: photoMeta.rotate || 0, straighten: photoMeta.straighten || 0, crop: photoMeta.crop || null};
+}
+
+function isEdited(edit) {
+    return edit.rotate !== 0 || edit.straighten !== 0 || edit.crop !== null;
+}
+
+function photoEditQuery(edit, crop) {
+    const region = crop ? [crop.x, crop.y, crop.width, crop.height].join(',') : 'none';
+    return ` + "`" + `rotate=${edit.rotate}&straighten=${edit.straighten}&crop=${region}` + "`" + `;
+}
+
+// Show the photo as edited. While cropping, the whole rotated photo shows
+// with the crop drawn over it.
+function updatePhotoPreview() {
+    const img = document.getElementById('photo-preview-img');
+    const frame = img.parentElement;
+    const box = document.getElementById('photo-crop-box');
+    const straighten = document.getElementById('photo-straighten');
+    straighten.value = photoEdit.straighten;
+    document.getElementById('photo-straighten-value').textContent = photoEdit.straighten + '°';
+    document.getElementById('photo-crop-toggle').textContent = cropping ? 'Done' : 'Crop';
+    frame.classList.toggle('cropping', cropping);
+    img.title = cropping ? 'Drag to select the part to keep' : 'Click to set the focal point';
+
+    const adjust = resolveAdjustments(currentPhotoAdjustments());
+    let src = ` + "`" + `/images/${photoPreviewPath}` + "`" + `;
+    if (cropping) {
+        src = ` + "`" + `/thumbs/large/${photoPreviewPath}?${photoEditQuery(photoEdit, null)}&${adjustmentsQuery(adjust)}` + "`" + `;
+    } else if (isEdited(photoEdit) || isAdjusted(adjust)) {
+        src = ` + "`" + `/thumbs/large/${photoPreviewPath}?${photoEditQuery(photoEdit, photoEdit.crop)}&${adjustmentsQuery(adjust)}` + "`" + `;
+    }
+    if (img.getAttribute('src') !== src) img.src = src;
+
+    const framed = ` + "`" + `/thumbs/medium/${photoPreviewPath}?${photoEditQuery(photoEdit, photoEdit.crop)}` + "`" + `;
+    const before = document.getElementById('photo-adjust-before');
+    const after = document.getElementById('photo-adjust-after');
+    if (before.getAttribute('src') !== framed + '&adjust=none') before.src = framed + '&adjust=none';
+    if (after.getAttribute('src') !== framed + '&' + adjustmentsQuery(adjust)) after.src = framed + '&' + adjustmentsQuery(adjust);
+
+    const crop = photoEdit.crop;
+    if (cropping && crop) {
+        box.style.left = (crop.x * 100) + '%';
+        box.style.top = (crop.y * 100) + '%';
+        box.style.width = (crop.width * 100) + '%';
+        box.style.height = (crop.height * 100) + '%';
+        box.style.display = 'block';
+    } else {
+        box.style.display = 'none';
+    }
+}
+
+function rotatePhoto(degrees) {
+    // A crop drawn on the old orientation no longer fits
+    photoEdit.rotate = (photoEdit.rotate + degrees + 360) % 360;
+    photoEdit.crop = null;
+    updatePhotoPreview();
+}
+
+function toggleCropping() {
+    cropping = !cropping;
+    updatePhotoPreview();
+}
+
+function resetPhotoEdit() {
+    photoEdit = {rotate: 0, straighten: 0, crop: null};
+    cropping = false;
+    updatePhotoPreview();
+}
+
+// Tonal adjustments, stored like the metadata: a preset name and the values
+// that override it. Previews send the resolved values, so unsaved presets
+// and changes show without a save.
+const adjustmentFields = ['brightness', 'contrast', 'gamma', 'saturation'];
+let photoAlbumName = '';
+let photoAdjustInherit = true;
+
+// The photo's own adjustments, or its album's when it has none
+function photoAdjustmentsOf(path, albumName) {
+    const own = ((metadata.photos || {})[path] || {}).adjustments;
+    return own || ((metadata.albums || {})[albumName] || {}).adjustments || null;
+}
+
+// Fill in the preset an adjustment names, as the generator does
+function resolveAdjustments(adjust) {
+    if (!adjust) return null;
+    const preset = adjust.preset ? (metadata.adjustment_presets || {})[adjust.preset] : null;
+    if (!preset) return adjust;
+    const values = Object.assign({}, preset, {grayscale: preset.grayscale || adjust.grayscale || false});
+    adjustmentFields.forEach(field => {
+        if (adjust[field]) values[field] = adjust[field];
+    });
+    return values;
+}
+
+function isAdjusted(values) {
+    return !!values && (values.grayscale || adjustmentFields.some(field =>
+        values[field] && !(field === 'gamma' && values[field] === 1)));
+}
+
+function adjustmentsQuery(values) {
+    if (!isAdjusted(values)) return 'adjust=none';
+    return adjustmentFields.map(field => ` + "`" + `${field}=${values[field] || 0}` + "`" + `).join('&') +
+        ` + "`" + `&grayscale=${!!values.grayscale}` + "`" + `;
+}
+
+function fillPresetSelect(select, emptyLabel) {
+    select.innerHTML = '';
+    const addOption = (value, label) => {
+        const option = document.createElement('option');
+        option.value = value;
+        option.textContent = label;
+        select.appendChild(option);
+    };
+    if (select.id === 'photo-adjust-preset') addOption('album', 'Album default');
+    addOption('', emptyLabel);
+    Object.keys(metadata.adjustment_presets || {}).sort().forEach(name => addOption(name, name));
+}
+
+// Show a photo's own adjustments in the modal; null inherits the album's
+function setPhotoAdjustments(adjust) {
+    photoAdjustInherit = !adjust;
+    const select = document.getElementById('photo-adjust-preset');
+    fillPresetSelect(select, 'None');
+    select.value = adjust ? (adjust.preset || '') : 'album';
+    adjustmentFields.forEach(field => {
+        const value = (adjust || {})[field] || (field === 'gamma' ? 1 : 0);
+        document.getElementById('photo-adjust-' + field).value = value;
+        document.getElementById('photo-adjust-' + field + '-value').textContent = value;
+    });
+    document.getElementById('photo-adjust-grayscale').checked = !!(adjust || {}).grayscale;
+    document.querySelectorAll('#photo-adjust-tools .adjust-controls input').forEach(input => {
+        input.disabled = photoAdjustInherit;
+    });
+}
+
+// The adjustments the modal shows, null while inheriting the album's
+function photoOwnAdjustments() {
+    if (photoAdjustInherit) return null;
+    const adjust = {};
+    const preset = document.getElementById('photo-adjust-preset').value;
+    if (preset) adjust.preset = preset;
+    adjustmentFields.forEach(field => {
+        const value = parseFloat(document.getElementById('photo-adjust-' + field).value);
+        if (value !== (field === 'gamma' ? 1 : 0)) adjust[field] = value;
+    });
+    if (document.getElementById('photo-adjust-grayscale').checked) adjust.grayscale = true;
+    return adjust;
+}
+
+function currentPhotoAdjustments() {
+    const own = photoOwnAdjustments();
+    return own || ((metadata.albums || {})[photoAlbumName] || {}).adjustments || null;
+}
+
+function resetPhotoAdjustments() {
+    setPhotoAdjustments(null);
+    updatePhotoPreview();
+}
+
+// Keep the current values as a named preset other photos and albums can use
+function savePhotoAdjustPreset() {
+    const values = resolveAdjustments(currentPhotoAdjustments());
+    if (!isAdjusted(values)) {
+        alert('Adjust the photo before saving a preset.');
+        return;
+    }
+    const name = (prompt('Preset name:') || '').trim();
+    if (!name || name === 'album') return;
+    if (!metadata.adjustment_presets) metadata.adjustment_presets = {};
+    const preset = {};
+    adjustmentFields.forEach(field => {
+        if (values[field] && !(field === 'gamma' && values[field] === 1)) preset[field] = values[field];
+    });
+    if (values.grayscale) preset.grayscale = true;
+    metadata.adjustment_presets[name] = preset;
+    setPhotoAdjustments({preset: name});
+    updatePhotoPreview();
+    scheduleAutoSave();
+}
+
+// Duplicates found by the last scan, and the photos it couldn't read
+let duplicateGroups = null;
+let duplicateSkipped = [];
+
+// Ask the server for photos that appear more than once
+async function loadDuplicates() {
+    const container = document.getElementById('duplicates-list');
+    const threshold = document.getElementById('duplicates-threshold').value;
+    container.innerHTML = '<p class="photos-order-hint">Comparing photos, this can take a while for large galleries...</p>';
+    try {
+        const response = await fetch(` + "`" + `/api/duplicates?threshold=${threshold}` + "`" + `);
+        if (!response.ok) throw new Error(await response.text());
+        const result = await response.json();
+        duplicateGroups = result.groups;
+        duplicateSkipped = result.skipped;
+        renderDuplicates();
+    } catch (error) {
+        console.error('Error finding duplicates:', error);
+        container.innerHTML = '<p style="color: var(--error-red);">Error finding duplicates</p>';
+    }
+}
+
+function renderDuplicates() {
+    const container = document.getElementById('duplicates-list');
+    container.innerHTML = '';
+    if (duplicateGroups.length === 0) {
+        container.innerHTML = '<p class="photos-order-hint">No duplicates found.</p>';
+    }
+
+    const isHidden = path => ((metadata.photos || {})[path] || {}).hidden || false;
+    duplicateGroups.forEach(group => {
+        const section = document.createElement('div');
+        section.className = 'duplicate-group';
+        section.innerHTML = ` + "`" + `<h3>${group.exact ? 'Exact copies' : 'Near duplicates'}</h3>` + "`" + `;
+        const grid = document.createElement('div');
+        grid.className = 'photos-grid';
+
+        const visible = group.photos.filter(photo => !isHidden(photo.path));
+        group.photos.forEach((photo, index) => {
+            const relPath = photo.album ? ` + "`" + `${photo.album}/${photo.filename}` + "`" + ` : photo.filename;
+            const hidden = isHidden(photo.path);
+            const kept = !hidden && visible.length === 1;
+            const card = document.createElement('div');
+            card.className = 'photo-card' + (hidden ? ' is-hidden' : '');
+            card.innerHTML = ` + "`" + `
+                <img src="/thumbs/small/${relPath}" alt="${photo.filename}" loading="lazy">
+                <div class="photo-card-info">
+                    <h3>${relPath}${hidden ? '<span class="hidden-badge">Hidden</span>' : ''}</h3>
+                    <p>${photo.width}×${photo.height} · ${(photo.size / 1048576).toFixed(1)} MB${index === 0 ? ' · best copy' : ''}</p>
+                    <button type="button" class="btn ${kept ? 'btn-secondary' : 'btn-primary'}"${kept ? ' disabled' : ''}>${kept ? 'Kept' : 'Keep this, hide others'}</button>
+                </div>
+            ` + "`" + `;
+            card.querySelector('button').addEventListener('click', () => keepDuplicate(group, photo.path));
+            grid.appendChild(card);
+        });
+
+        section.appendChild(grid);
+        container.appendChild(section);
+    });
+
+    if (duplicateSkipped.length > 0) {
+        const note = document.createElement('p');
+        note.className = 'photos-order-hint';
+        note.textContent = ` + "`" + `${duplicateSkipped.length} photo(s) could not be read and were not compared.` + "`" + `;
+        container.appendChild(note);
+    }
+}
+
+// Hide every copy in the group except the one to keep
+function keepDuplicate(group, keepPath) {
+    if (!metadata.photos) metadata.photos = {};
+    group.photos.forEach(photo => {
+        metadata.photos[photo.path] = Object.assign(metadata.photos[photo.path] || {}, {
+            hidden: photo.path !== keepPath
+        });
+    });
+    renderDuplicates();
+    scheduleAutoSave();
+}
+
 // Close modals
 function closeAlbumModal() {
     document.getElementById('album-modal').style.display = 'none';
@@ -1410,6 +2174,11 @@ document.addEventListener('DOMContentLoaded', () => {
             if (tabName === 'deploy') {
                 loadDeployConfig();
             }
+
+            // Scanning reads every photo, so only the first visit starts it
+            if (tabName === 'duplicates' && duplicateGroups === null) {
+                loadDuplicates();
+            }
         });
     });
     
@@ -1435,12 +2204,27 @@ document.addEventListener('DOMContentLoaded', () => {
         
         if (!metadata.albums) metadata.albums = {};
         
-        metadata.albums[relativePath] = {
+        // Merge so fields not shown in the form (custom order, tags) survive
+        metadata.albums[relativePath] = Object.assign(metadata.albums[relativePath] || {}, {
             title: document.getElementById('album-title').value,
             description: document.getElementById('album-description').value,
-
+            sort_order: document.getElementById('album-sort-order').value,
+            tags: parseTags(document.getElementById('album-tags').value),
             cover_photo: document.getElementById('album-cover').value
-        };
+        });
+        // Values set in gallery.yaml besides the preset are kept
+        const albumAdjust = Object.assign({}, metadata.albums[relativePath].adjustments);
+        const albumPreset = document.getElementById('album-adjust-preset').value;
+        if (albumPreset) {
+            albumAdjust.preset = albumPreset;
+        } else {
+            delete albumAdjust.preset;
+        }
+        if (Object.keys(albumAdjust).length > 0) {
+            metadata.albums[relativePath].adjustments = albumAdjust;
+        } else {
+            delete metadata.albums[relativePath].adjustments;
+        }
         
         // Update local albums data
         const album = albums.find(a => a.path === path);
@@ -1463,11 +2247,17 @@ document.addEventListener('DOMContentLoaded', () => {
         
         if (!metadata.photos) metadata.photos = {};
         
-        metadata.photos[path] = {
+        metadata.photos[path] = Object.assign(metadata.photos[path] || {}, {
             title: document.getElementById('photo-title').value,
             description: document.getElementById('photo-description').value,
-            hidden: document.getElementById('photo-hidden').checked
-        };
+            hidden: document.getElementById('photo-hidden').checked,
+            tags: parseTags(document.getElementById('photo-tags').value),
+            focal_point: photoFocalPoint,
+            rotate: photoEdit.rotate,
+            straighten: photoEdit.straighten,
+            crop: photoEdit.crop,
+            adjustments: photoOwnAdjustments()
+        });
         
         closePhotoModal();
         
@@ -1480,10 +2270,37 @@ document.addEventListener('DOMContentLoaded', () => {
         scheduleAutoSave();
     });
     
+    // Photo adjustments
+    document.getElementById('photo-adjust-preset').addEventListener('change', (e) => {
+        if (e.target.value === 'album') {
+            setPhotoAdjustments(null);
+        } else {
+            photoAdjustInherit = false;
+            document.querySelectorAll('#photo-adjust-tools .adjust-controls input').forEach(input => {
+                input.disabled = false;
+            });
+        }
+        updatePhotoPreview();
+    });
+    adjustmentFields.forEach(field => {
+        const input = document.getElementById('photo-adjust-' + field);
+        input.addEventListener('input', () => {
+            document.getElementById('photo-adjust-' + field + '-value').textContent = input.value;
+        });
+        input.addEventListener('change', updatePhotoPreview);
+    });
+    document.getElementById('photo-adjust-grayscale').addEventListener('change', updatePhotoPreview);
+
     // Photo album select
     document.getElementById('photo-album-select').addEventListener('change', (e) => {
+        document.getElementById('photos-stacks-status').textContent = '';
         loadPhotos(e.target.value);
     });
+    document.getElementById('photos-find-stacks').addEventListener('click', findStacks);
+
+    // Duplicate scans
+    document.getElementById('duplicates-scan').addEventListener('click', loadDuplicates);
+    document.getElementById('duplicates-threshold').addEventListener('change', loadDuplicates);
     
     // Save button
     document.getElementById('saveBtn').addEventListener('click', saveAll);
@@ -1528,6 +2345,60 @@ document.addEventListener('DOMContentLoaded', () => {
     document.getElementById('photo-modal').addEventListener('click', (e) => {
         if (e.target.id === 'photo-modal') closePhotoModal();
     });
+    
+    // Clicking the preview sets the point crops keep in view
+    const previewImg = document.getElementById('photo-preview-img');
+    const round = v => Math.round(Math.min(Math.max(v, 0), 1) * 1000) / 1000;
+    previewImg.addEventListener('click', (e) => {
+        if (cropping) return;
+        const rect = e.target.getBoundingClientRect();
+        setFocalPoint({
+            x: round((e.clientX - rect.left) / rect.width),
+            y: round((e.clientY - rect.top) / rect.height)
+        });
+    });
+
+    // While cropping, dragging over the preview selects the part to keep
+    const cropPoint = (e) => {
+        const rect = previewImg.getBoundingClientRect();
+        return {x: round((e.clientX - rect.left) / rect.width), y: round((e.clientY - rect.top) / rect.height)};
+    };
+    previewImg.addEventListener('pointerdown', (e) => {
+        if (!cropping) return;
+        e.preventDefault();
+        previewImg.setPointerCapture(e.pointerId);
+        cropStart = cropPoint(e);
+    });
+    previewImg.addEventListener('pointermove', (e) => {
+        if (!cropStart) return;
+        const end = cropPoint(e);
+        photoEdit.crop = {
+            x: Math.min(cropStart.x, end.x),
+            y: Math.min(cropStart.y, end.y),
+            width: round(Math.abs(end.x - cropStart.x)),
+            height: round(Math.abs(end.y - cropStart.y))
+        };
+        updatePhotoPreview();
+    });
+    previewImg.addEventListener('pointerup', () => {
+        // A click without a drag keeps the whole photo
+        if (photoEdit.crop && (photoEdit.crop.width < 0.02 || photoEdit.crop.height < 0.02)) {
+            photoEdit.crop = null;
+            updatePhotoPreview();
+        }
+        cropStart = null;
+    });
+
+    // The preview is rendered by the server, so it only follows the slider
+    // once it is let go
+    const straighten = document.getElementById('photo-straighten');
+    straighten.addEventListener('input', () => {
+        document.getElementById('photo-straighten-value').textContent = straighten.value + '°';
+    });
+    straighten.addEventListener('change', () => {
+        photoEdit.straighten = parseFloat(straighten.value);
+        updatePhotoPreview();
+    });
 });
 
 // Generate gallery with progress tracking
@@ -1,11 +1,13 @@
 package exif
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/cjs/purtypics/pkg/heif"
 	"github.com/rwcarlsen/goexif/exif"
 )
 
@@ -29,15 +31,30 @@ type GPSData struct {
 	Altitude  float64
 }
 
-// ExtractMetadata reads EXIF data from an image file
-func ExtractMetadata(path string) (*EXIFData, error) {
+// decode reads the EXIF block of a JPEG, TIFF or HEIF file
+func decode(path string) (*exif.Exif, error) {
+	if heif.IsHEIF(path) {
+		info, err := heif.Read(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.EXIF == nil {
+			return nil, fmt.Errorf("no EXIF data in %s", path)
+		}
+		return exif.Decode(bytes.NewReader(info.EXIF))
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
+	return exif.Decode(file)
+}
 
-	x, err := exif.Decode(file)
+// ExtractMetadata reads EXIF data from an image file
+func ExtractMetadata(path string) (*EXIFData, error) {
+	x, err := decode(path)
 	if err != nil {
 		return nil, err // not all images have EXIF
 	}
@@ -119,11 +136,20 @@ func ExtractMetadata(path string) (*EXIFData, error) {
 		data.Orientation = 1 // Default to normal orientation
 	}
 
+	// HEIF rotation lives in the container and is applied when decoding
+	if heif.IsHEIF(path) {
+		data.Orientation = 1
+	}
+
 	return data, nil
 }
 
 // GetOrientation reads only the EXIF orientation from an image file
 func GetOrientation(path string) (int, error) {
+	if heif.IsHEIF(path) {
+		return 1, nil // applied when decoding
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		return 1, err
@@ -1,6 +1,7 @@
 package gallery
 
 import (
+	"fmt"
 	"html/template"
 	"os"
 	"path/filepath"
@@ -8,11 +9,13 @@ import (
 	"time"
 
 	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/image"
+	"github.com/cjs/purtypics/pkg/raw"
 )
 
 // Album represents a photo album
 type Album struct {
-	ID          string
+	ID          string // slash-separated path relative to the source root
 	Title       string
 	Description template.HTML
 	Path        string
@@ -20,6 +23,10 @@ type Album struct {
 	Thumbnail   string // photo ID for album thumbnail
 	CoverPhoto  string // custom cover photo from metadata
 	CreatedAt   time.Time
+	Tags        []string
+	ParentID    string   // ID of the enclosing album, empty for top-level albums
+	Children    []*Album // nested albums, populated by LinkAlbums
+	NoIndex     bool     // keep search engines away from the album and its photos
 }
 
 // Photo represents a single photo
@@ -33,9 +40,22 @@ type Photo struct {
 	Height      int
 	AspectRatio string
 	EXIF        *exif.EXIFData
-	Thumbnails  map[string]string // size -> path
+	Thumbnails  map[string]string // size -> path of the JPEG rendition
+	Renditions  []image.Rendition // every generated file, in all formats
+	BlurHash    string            // blurred preview to show while the photo loads, see https://blurha.sh
+	Color       string            // dominant color as #rrggbb, for placeholder backgrounds
 	IsVideo     bool
 	VideoPath   string // Original video path
+	SortIndex   int    // position for custom ordering, 0 if unset
+	Tags        []string
+	PagePath    string   // site path of the photo's permalink page, empty if it has none
+	Stack       []*Photo // the rest of the burst stack this photo is the pick of
+	Stacked     bool     // shown through its stack's pick rather than on its own
+	focalPoint  *image.FocalPoint
+	edit        image.Edit        // rotation, straightening and crop from metadata
+	adjustments image.Adjustments // tonal changes from the photo's or album's metadata
+	stripped    bool              // video published without its container metadata
+	cardCrop    string            // crop CardPicture shows, empty for the full frame
 }
 
 // supportedFormats lists all supported image and video formats
@@ -44,53 +64,134 @@ var supportedFormats = map[string]bool{
 	".jpeg": true,
 	".png":  true,
 	".webp": true,
+	".gif":  true, // animated ones keep moving, see ProcessAnimation
 	".heif": true,
 	".heic": true,
+	".nef":  true, // camera RAW files, rendered from their embedded previews
+	".cr2":  true,
+	".arw":  true,
+	".dng":  true,
 	".mov":  true,
 	".mp4":  true,
 	".avi":  true,
 }
 
-// ScanDirectory finds all albums in a directory
-func ScanDirectory(rootPath string) ([]Album, error) {
-	var albums []Album
-
-	entries, err := os.ReadDir(rootPath)
-	if err != nil {
+// ScanDirectory finds all albums under rootPath, descending into nested
+// directories. Albums are returned as a flat list in depth-first order, so a
+// parent always precedes its children. A directory becomes an album when it
+// contains media or has a descendant that does. Hidden directories, the
+// top-level themes/ directory and any paths listed in exclude are skipped.
+func ScanDirectory(rootPath string, exclude ...string) ([]Album, error) {
+	if _, err := os.ReadDir(rootPath); err != nil {
 		return nil, err
 	}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
+	skip := make(map[string]bool, len(exclude)+1)
+	skip[filepath.Clean(filepath.Join(rootPath, "themes"))] = true
+	for _, p := range exclude {
+		if p == "" {
 			continue
 		}
+		if abs, err := filepath.Abs(p); err == nil {
+			skip[abs] = true
+		}
+		skip[filepath.Clean(p)] = true
+	}
+
+	var albums []Album
+	scanTree(rootPath, rootPath, "", skip, &albums)
+	return albums, nil
+}
+
+// checkReservedIDs returns an error when a top-level album shares its name
+// with one of the output directories the generator writes its own pages and
+// files to, as the album's page would overwrite them or be overwritten
+func checkReservedIDs(albums []Album, reserved []string) error {
+	for _, album := range albums {
+		if album.ParentID != "" {
+			continue
+		}
+		for _, dir := range reserved {
+			// Compared without case, as output may land on a
+			// case-insensitive file system
+			if strings.EqualFold(album.ID, dir) {
+				return fmt.Errorf("album folder %q has the same name as the gallery's own /%s/ directory; rename or hide it", album.ID, dir)
+			}
+		}
+	}
+	return nil
+}
 
-		albumPath := filepath.Join(rootPath, entry.Name())
-		album, err := scanAlbum(albumPath)
+// scanTree appends the album at dir (if any) and its descendants to albums.
+// It reports whether dir or any of its descendants holds media.
+func scanTree(rootPath, dir, parentID string, skip map[string]bool, albums *[]Album) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false // skip unreadable directories
+	}
+
+	id := ""
+	if dir != rootPath {
+		rel, err := filepath.Rel(rootPath, dir)
 		if err != nil {
-			continue // skip invalid albums
+			return false
 		}
+		id = filepath.ToSlash(rel)
+	}
 
-		if len(album.Photos) > 0 {
-			albums = append(albums, album)
+	// Reserve our slot before recursing so parents precede children
+	idx := -1
+	if id != "" {
+		album := scanAlbum(dir, entries)
+		album.ID = id
+		album.ParentID = parentID
+		*albums = append(*albums, album)
+		idx = len(*albums) - 1
+	}
+
+	hasChildren := false
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		childPath := filepath.Join(dir, entry.Name())
+		if isSkipped(childPath, skip) {
+			continue
+		}
+		if scanTree(rootPath, childPath, id, skip, albums) {
+			hasChildren = true
 		}
 	}
 
-	return albums, nil
+	if idx < 0 {
+		return hasChildren
+	}
+
+	// Drop directories that hold no media anywhere beneath them
+	if len((*albums)[idx].Photos) == 0 && !hasChildren {
+		*albums = (*albums)[:idx]
+		return false
+	}
+	return true
+}
+
+func isSkipped(path string, skip map[string]bool) bool {
+	if skip[filepath.Clean(path)] {
+		return true
+	}
+	if abs, err := filepath.Abs(path); err == nil && skip[abs] {
+		return true
+	}
+	return false
 }
 
-func scanAlbum(path string) (Album, error) {
+func scanAlbum(path string, entries []os.DirEntry) Album {
 	album := Album{
 		ID:    filepath.Base(path),
 		Title: formatTitle(filepath.Base(path)),
 		Path:  path,
 	}
 
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return album, err
-	}
-
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
@@ -116,13 +217,92 @@ func scanAlbum(path string) (Album, error) {
 
 		album.Photos = append(album.Photos, photo)
 	}
+	album.Photos = dropShadowedRAWs(album.Photos)
 
 	// Use first photo as default thumbnail
 	if len(album.Photos) > 0 {
 		album.Thumbnail = album.Photos[0].ID
 	}
 
-	return album, nil
+	return album
+}
+
+// dropShadowedRAWs removes RAW files that sit next to an image with the same
+// basename, usually the camera's or an editor's JPEG, so a photo shot as
+// RAW+JPEG is published once. Basenames are compared without case, as
+// cameras name the two files DSC_0001.NEF and DSC_0001.JPG but editors
+// often export dsc_0001.jpg.
+func dropShadowedRAWs(photos []Photo) []Photo {
+	images := make(map[string]bool)
+	for _, photo := range photos {
+		if !photo.IsVideo && !raw.IsRAW(photo.Filename) {
+			images[basename(photo.Filename)] = true
+		}
+	}
+	kept := photos[:0]
+	for _, photo := range photos {
+		if raw.IsRAW(photo.Filename) && images[basename(photo.Filename)] {
+			continue
+		}
+		kept = append(kept, photo)
+	}
+	return kept
+}
+
+// basename returns a filename without its extension, lower-cased
+func basename(filename string) string {
+	return strings.ToLower(strings.TrimSuffix(filename, filepath.Ext(filename)))
+}
+
+// LinkAlbums fills in each album's Children from the flat list, keeping the
+// list's order among siblings. It must be called after the list is in its
+// final order since Children point into the slice.
+func LinkAlbums(albums []Album) {
+	index := make(map[string]*Album, len(albums))
+	for i := range albums {
+		albums[i].Children = nil
+		index[albums[i].ID] = &albums[i]
+	}
+	for i := range albums {
+		if parent, ok := index[albums[i].ParentID]; ok {
+			parent.Children = append(parent.Children, &albums[i])
+		}
+	}
+}
+
+// TopLevelAlbums returns the albums that have no parent album
+func TopLevelAlbums(albums []Album) []Album {
+	top := make([]Album, 0, len(albums))
+	for _, album := range albums {
+		if album.ParentID == "" {
+			top = append(top, album)
+		}
+	}
+	return top
+}
+
+// Depth returns how many directories deep the album is (1 for top-level)
+func (a *Album) Depth() int {
+	return strings.Count(a.ID, "/") + 1
+}
+
+// Cover returns the photo used to represent the album: the custom cover photo
+// if set, otherwise the first photo, otherwise the cover of the first child.
+func (a *Album) Cover() *Photo {
+	for i := range a.Photos {
+		if a.CoverPhoto != "" && a.Photos[i].Filename == a.CoverPhoto {
+			return &a.Photos[i]
+		}
+	}
+	if len(a.Photos) > 0 {
+		return &a.Photos[0]
+	}
+	for _, child := range a.Children {
+		if cover := child.Cover(); cover != nil {
+			return cover
+		}
+	}
+	return nil
 }
 
 // formatTitle converts directory names to readable titles
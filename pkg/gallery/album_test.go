@@ -0,0 +1,138 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// helper to create a source tree of empty media files
+func setupSourceDir(t *testing.T, files []string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, path := range files {
+		abs := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(abs, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestScanDirectory_Nested(t *testing.T) {
+	dir := setupSourceDir(t, []string{
+		"2024/japan/kyoto/a.jpg",
+		"2024/japan/kyoto/b.jpg",
+		"2024/japan/tokyo.jpg",
+		"2024/empty/notes.txt", // no media, should be dropped
+		"beach/one.jpg",
+		"themes/mytheme/preview.jpg", // theme directory, should be skipped
+		".cache/x.jpg",               // hidden directory, should be skipped
+		"output/static/thumbs/beach/one_small.jpg",
+	})
+
+	albums, err := ScanDirectory(dir, filepath.Join(dir, "output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		id, parent string
+		photos     int
+	}{
+		{"2024", "", 0},
+		{"2024/japan", "2024", 1},
+		{"2024/japan/kyoto", "2024/japan", 2},
+		{"beach", "", 1},
+	}
+	if len(albums) != len(want) {
+		ids := make([]string, len(albums))
+		for i, a := range albums {
+			ids[i] = a.ID
+		}
+		t.Fatalf("expected %d albums, got %d: %v", len(want), len(albums), ids)
+	}
+	for i, w := range want {
+		a := albums[i]
+		if a.ID != w.id || a.ParentID != w.parent || len(a.Photos) != w.photos {
+			t.Errorf("album[%d] = {%q, parent %q, %d photos}, want {%q, parent %q, %d photos}",
+				i, a.ID, a.ParentID, len(a.Photos), w.id, w.parent, w.photos)
+		}
+	}
+}
+
+func TestScanDirectory_RAWShadowedByJPEG(t *testing.T) {
+	dir := setupSourceDir(t, []string{
+		"shoot/DSC_0001.NEF",
+		"shoot/DSC_0001.JPG", // published instead of the RAW
+		"shoot/DSC_0002.NEF",
+		"shoot/IMG_0003.dng",
+		"shoot/DSC_0004.ARW",
+		"shoot/dsc_0004.jpg", // an export, matched without case
+	})
+
+	albums, err := ScanDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 1 {
+		t.Fatalf("expected 1 album, got %d", len(albums))
+	}
+
+	var files []string
+	for _, photo := range albums[0].Photos {
+		files = append(files, photo.Filename)
+	}
+	want := []string{"DSC_0001.JPG", "DSC_0002.NEF", "IMG_0003.dng", "dsc_0004.jpg"}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("photos = %v, want %v", files, want)
+	}
+}
+
+func TestLinkAlbums(t *testing.T) {
+	albums := []Album{
+		{ID: "2024"},
+		{ID: "2024/japan", ParentID: "2024"},
+		{ID: "2024/italy", ParentID: "2024"},
+		{ID: "beach", Photos: []Photo{{Filename: "one.jpg"}}},
+	}
+	albums[1].Photos = []Photo{{Filename: "tokyo.jpg"}}
+
+	LinkAlbums(albums)
+
+	if got := len(albums[0].Children); got != 2 {
+		t.Fatalf("expected 2 children, got %d", got)
+	}
+	if albums[0].Children[0].ID != "2024/japan" || albums[0].Children[1].ID != "2024/italy" {
+		t.Errorf("children out of order: %q, %q", albums[0].Children[0].ID, albums[0].Children[1].ID)
+	}
+	if cover := albums[0].Cover(); cover == nil || cover.Filename != "tokyo.jpg" {
+		t.Errorf("parent cover should come from first child, got %+v", cover)
+	}
+	if top := TopLevelAlbums(albums); len(top) != 2 {
+		t.Errorf("expected 2 top-level albums, got %d", len(top))
+	}
+}
+
+func TestCheckReservedIDs(t *testing.T) {
+	albums := []Album{
+		{ID: "Tags"},
+		{ID: "map"},
+		{ID: "2024"},
+		{ID: "2024/archive", ParentID: "2024"},
+	}
+	err := checkReservedIDs(albums, []string{"css", "tags"})
+	if err == nil || !strings.Contains(err.Error(), "Tags") {
+		t.Errorf("err = %v, want one naming the Tags folder", err)
+	}
+
+	// Directories this build doesn't write are free, and nested albums
+	// live below their parent's path
+	if err := checkReservedIDs(albums, []string{"archive", "search"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package gallery
+
+import (
+	"github.com/cjs/purtypics/pkg/image"
+)
+
+// Animation is what a theme needs to show an animated GIF as a moving
+// image. URLs are already prefixed with the page's base path.
+type Animation struct {
+	Src    string // the first of the preferred sizes that exists
+	Full   string // the largest size, for the lightbox
+	Video  bool   // Src and Full are muted MP4s to loop rather than GIFs
+	Type   string // MIME type of Src and Full
+	Poster string // JPEG still of the first frame at Src's size
+	Width  int
+	Height int
+	Alt    string
+}
+
+// Animation returns the moving renditions of an animated GIF, or nil for
+// every other photo
+func (p *Photo) Animation(basePath string, preferred ...string) *Animation {
+	var moving []image.Rendition
+	for _, r := range p.Renditions {
+		if r.Format == image.FormatGIF || r.Format == image.FormatMP4 {
+			moving = append(moving, r)
+		}
+	}
+	if len(moving) == 0 {
+		return nil
+	}
+
+	src := moving[0]
+	for _, name := range preferred {
+		if i := indexOfSize(moving, name); i >= 0 {
+			src = moving[i]
+			break
+		}
+	}
+	full := moving[0]
+	for _, r := range moving {
+		if r.Width > full.Width {
+			full = r
+		}
+	}
+
+	anim := &Animation{
+		Src:    basePath + src.Path,
+		Full:   basePath + full.Path,
+		Video:  src.Format == image.FormatMP4,
+		Type:   image.FormatMIME(src.Format),
+		Width:  src.Width,
+		Height: src.Height,
+		Alt:    p.DisplayTitle(),
+	}
+	if poster, ok := p.Thumbnails[src.Size]; ok {
+		anim.Poster = basePath + poster
+	}
+	return anim
+}
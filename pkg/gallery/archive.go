@@ -0,0 +1,186 @@
+package gallery
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ArchiveYear groups the photos taken in one year
+type ArchiveYear struct {
+	Year   int
+	Months []*ArchiveMonth // oldest first
+	Count  int
+}
+
+// ArchiveMonth groups the photos taken in one month
+type ArchiveMonth struct {
+	Year  int
+	Month time.Month
+	Days  []*ArchiveDay // oldest first
+	Count int
+}
+
+// ArchiveDay lists the photos taken on one day, across albums
+type ArchiveDay struct {
+	Date   time.Time
+	Photos []TaggedPhoto // oldest first
+}
+
+// ArchivePage is the archive data handed to archive.html. Year and Month
+// are nil on the archive index; Month is nil on a year page.
+type ArchivePage struct {
+	Years []*ArchiveYear // newest first
+	Year  *ArchiveYear
+	Month *ArchiveMonth
+}
+
+// Path returns the month's path below /archive/, e.g. 2023/07/
+func (m *ArchiveMonth) Path() string {
+	return fmt.Sprintf("%04d/%02d/", m.Year, int(m.Month))
+}
+
+// Cover returns the first photo of the month
+func (m *ArchiveMonth) Cover() *Photo {
+	if len(m.Days) == 0 || len(m.Days[0].Photos) == 0 {
+		return nil
+	}
+	return m.Days[0].Photos[0].Photo
+}
+
+// CollectArchive groups every photo by the year, month and day it was taken,
+// using the same dates photo sorting uses
+func CollectArchive(albums []Album) []*ArchiveYear {
+	type dated struct {
+		photo TaggedPhoto
+		taken time.Time
+	}
+
+	var photos []dated
+	for i := range albums {
+		for j := range albums[i].Photos {
+			taken := photoTime(albums[i].Photos[j])
+			if taken.IsZero() {
+				continue
+			}
+			photos = append(photos, dated{TaggedPhoto{Photo: &albums[i].Photos[j], Album: &albums[i]}, taken})
+		}
+	}
+	sort.SliceStable(photos, func(i, j int) bool {
+		return photos[i].taken.Before(photos[j].taken)
+	})
+
+	var years []*ArchiveYear
+	var year *ArchiveYear
+	var month *ArchiveMonth
+	var day *ArchiveDay
+	for _, p := range photos {
+		y, m, d := p.taken.Date()
+		if year == nil || year.Year != y {
+			year = &ArchiveYear{Year: y}
+			years = append(years, year)
+			month = nil
+		}
+		if month == nil || month.Month != m {
+			month = &ArchiveMonth{Year: y, Month: m}
+			year.Months = append(year.Months, month)
+			day = nil
+		}
+		if day == nil || day.Date.Day() != d {
+			day = &ArchiveDay{Date: time.Date(y, m, d, 0, 0, 0, 0, time.UTC)}
+			month.Days = append(month.Days, day)
+		}
+		day.Photos = append(day.Photos, p.photo)
+		month.Count++
+		year.Count++
+	}
+
+	// Newest year first
+	for i, j := 0, len(years)-1; i < j; i, j = i+1, j-1 {
+		years[i], years[j] = years[j], years[i]
+	}
+	return years
+}
+
+// generateArchivePages writes the archive index at /archive/, one page per
+// year at /archive/YYYY/ and one per month at /archive/YYYY/MM/
+func (g *Generator) generateArchivePages(tmpl *template.Template, years []*ArchiveYear, galleryData *GalleryData) error {
+	if len(years) == 0 {
+		return nil
+	}
+
+	archiveCrumb := Breadcrumb{Title: "Archive"}
+	galleryCrumb := Breadcrumb{Title: galleryData.Title}
+
+	// Archive index
+	galleryCrumb.URL = "../"
+	if err := g.writeArchivePage(tmpl, "archive/index.html", "..",
+		fmt.Sprintf("Archive - %s", galleryData.Title), galleryData,
+		&ArchivePage{Years: years},
+		[]Breadcrumb{galleryCrumb, archiveCrumb}); err != nil {
+		return err
+	}
+
+	for _, year := range years {
+		yearCrumb := Breadcrumb{Title: fmt.Sprint(year.Year)}
+
+		galleryCrumb.URL = "../../"
+		archiveCrumb.URL = "../"
+		if err := g.writeArchivePage(tmpl, fmt.Sprintf("archive/%04d/index.html", year.Year), "../..",
+			fmt.Sprintf("%d - %s", year.Year, galleryData.Title), galleryData,
+			&ArchivePage{Years: years, Year: year},
+			[]Breadcrumb{galleryCrumb, archiveCrumb, yearCrumb}); err != nil {
+			return err
+		}
+
+		galleryCrumb.URL = "../../../"
+		archiveCrumb.URL = "../../"
+		yearCrumb.URL = "../"
+		for _, month := range year.Months {
+			title := fmt.Sprintf("%s %d", month.Month, month.Year)
+			if err := g.writeArchivePage(tmpl, "archive/"+month.Path()+"index.html", "../../..",
+				fmt.Sprintf("%s - %s", title, galleryData.Title), galleryData,
+				&ArchivePage{Years: years, Year: year, Month: month},
+				[]Breadcrumb{galleryCrumb, archiveCrumb, yearCrumb, {Title: month.Month.String()}}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeArchivePage renders one archive page to relPath in the output directory
+func (g *Generator) writeArchivePage(tmpl *template.Template, relPath, basePath, title string, galleryData *GalleryData, archive *ArchivePage, breadcrumbs []Breadcrumb) error {
+	var contentBuf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&contentBuf, "archive.html", HTMLTemplateData{
+		BasePath:    basePath,
+		Gallery:     galleryData,
+		Breadcrumbs: breadcrumbs,
+		Archive:     archive,
+	}); err != nil {
+		return fmt.Errorf("failed to render %s content: %w", relPath, err)
+	}
+
+	var pageBuf bytes.Buffer
+	pageData := g.pageData(title, galleryData.Description, basePath, template.HTML(contentBuf.String()))
+	if err := tmpl.ExecuteTemplate(&pageBuf, "base.html", pageData); err != nil {
+		return fmt.Errorf("failed to render %s: %w", relPath, err)
+	}
+
+	pagePath := filepath.Join(g.OutputPath, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(pagePath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(pagePath, pageBuf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if g.cache != nil {
+		g.cache.SetPage(relPath, "")
+	}
+	return nil
+}
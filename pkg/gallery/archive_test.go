@@ -0,0 +1,55 @@
+package gallery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cjs/purtypics/pkg/exif"
+)
+
+func TestCollectArchive(t *testing.T) {
+	taken := func(s string) *exif.EXIFData {
+		ts, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &exif.EXIFData{DateTime: ts}
+	}
+	albums := []Album{
+		{ID: "summer", Photos: []Photo{
+			{ID: "b", EXIF: taken("2023-07-04 18:00")},
+			{ID: "a", EXIF: taken("2023-07-04 09:00")},
+			{ID: "c", EXIF: taken("2023-08-01 12:00")},
+		}},
+		{ID: "winter", Photos: []Photo{
+			{ID: "d", EXIF: taken("2023-07-10 08:00")},
+			{ID: "e", EXIF: taken("2024-01-02 08:00")},
+		}},
+	}
+
+	years := CollectArchive(albums)
+	if len(years) != 2 || years[0].Year != 2024 || years[1].Year != 2023 {
+		t.Fatalf("years not newest first: %+v", years)
+	}
+
+	y2023 := years[1]
+	if y2023.Count != 4 || len(y2023.Months) != 2 {
+		t.Fatalf("2023: count %d, %d months", y2023.Count, len(y2023.Months))
+	}
+	july := y2023.Months[0]
+	if july.Month != time.July || july.Path() != "2023/07/" || july.Count != 3 || len(july.Days) != 2 {
+		t.Fatalf("July: %+v", july)
+	}
+
+	// Photos on the same day are ordered by time, across albums
+	fourth := july.Days[0]
+	if len(fourth.Photos) != 2 || fourth.Photos[0].Photo.ID != "a" || fourth.Photos[1].Photo.ID != "b" {
+		t.Errorf("July 4 photos out of order")
+	}
+	if got := july.Days[1].Photos[0].Album.ID; got != "winter" {
+		t.Errorf("July 10 photo album = %q, want winter", got)
+	}
+	if july.Cover().ID != "a" {
+		t.Errorf("July cover = %q, want a", july.Cover().ID)
+	}
+}
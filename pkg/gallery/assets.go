@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 )
 
 //go:embed all:assets
@@ -51,8 +52,8 @@ func SystemThemesDirs() []string {
 //  3. Embedded themes compiled into the binary
 type ThemeFS struct {
 	themeName string
-	userFS    fs.FS // highest-priority on-disk theme (may be nil)
-	defaultFS fs.FS // fallback theme (embedded default or embedded named theme)
+	userFS    fs.FS // the selected theme's files (nil for the default theme)
+	defaultFS fs.FS // embedded default theme, used for anything the theme omits
 }
 
 // NewThemeFS creates a ThemeFS for the given theme name.
@@ -100,10 +101,11 @@ func NewThemeFS(themeName, sourcePath string) (*ThemeFS, error) {
 		}
 	}
 
-	// Check embedded themes
+	// Check embedded themes. Built-in themes only ship stylesheets, so
+	// templates and scripts come from the embedded default.
 	if embeddedTheme, err := fs.Sub(assetsFS, "assets/themes/"+themeName); err == nil {
 		if _, err := fs.ReadDir(embeddedTheme, "."); err == nil {
-			t.defaultFS = embeddedTheme
+			t.userFS = embeddedTheme
 			return t, nil
 		}
 	}
@@ -157,7 +159,8 @@ func (o *overlayFS) Open(name string) (fs.File, error) {
 }
 
 // ReadDir merges directory listings from both layers.
-// Upper entries take precedence for duplicate names.
+// Upper entries take precedence for duplicate names. Entries are sorted by
+// name as fs.ReadDirFS requires.
 func (o *overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
 	entries := make(map[string]fs.DirEntry)
 
@@ -187,6 +190,9 @@ func (o *overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
 	for _, e := range entries {
 		result = append(result, e)
 	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
 	return result, nil
 }
 
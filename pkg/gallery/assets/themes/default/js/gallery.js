@@ -18,8 +18,9 @@ document.addEventListener('DOMContentLoaded', function() {
         // Store masonry instance on element for later access
         gridElem.masonry = msnry;
         
-        // Progressive layout approach: layout visible images first, then as others load
-        const visibleImages = gridElem.querySelectorAll('.grid-item img, .album-cover img');
+        // Progressive layout approach: layout visible images first, then as others load.
+        // Animated GIFs served as video have no image, so their video counts instead.
+        const visibleImages = gridElem.querySelectorAll('.grid-item img, .grid-item video.animated-media, .album-cover img');
         let loadedCount = 0;
         const totalImages = visibleImages.length;
         
@@ -34,13 +35,14 @@ document.addEventListener('DOMContentLoaded', function() {
         
         // Set up load handlers for each image
         visibleImages.forEach(function(img, index) {
-            if (img.complete && img.naturalWidth !== 0) {
+            const isVideo = img.tagName === 'VIDEO';
+            if (isVideo ? img.readyState >= 2 : img.complete && img.naturalWidth !== 0) {
                 // Image already loaded (from cache)
                 handleImageLoad();
                 img.closest('.grid-item, .album-card')?.classList.add('loaded');
             } else {
                 // Wait for image to load
-                img.addEventListener('load', function() {
+                img.addEventListener(isVideo ? 'loadeddata' : 'load', function() {
                     handleImageLoad();
                     // Add loaded class with stagger effect
                     setTimeout(function() {
@@ -84,6 +86,9 @@ document.addEventListener('DOMContentLoaded', function() {
         document.body.appendChild(script);
     }
     
+    // Blurred previews behind photos that haven't loaded yet
+    initPlaceholders();
+
     // Video hover preview
     initVideoHover();
 
@@ -111,6 +116,92 @@ function initVideoHover() {
     });
 }
 
+// Paint each card's BlurHash behind its photo. The hash is decoded into a
+// tiny canvas; the browser scales it up, which blurs it further.
+function initPlaceholders() {
+    const canvas = document.createElement('canvas');
+    canvas.width = 32;
+    canvas.height = 32;
+    const ctx = canvas.getContext('2d');
+    if (!ctx) return;
+
+    document.querySelectorAll('.photo-card[data-blurhash]').forEach(card => {
+        const link = card.querySelector('.photo-link');
+        const pixels = decodeBlurHash(card.dataset.blurhash, canvas.width, canvas.height);
+        if (!link || !pixels) return;
+        const imageData = ctx.createImageData(canvas.width, canvas.height);
+        imageData.data.set(pixels);
+        ctx.putImageData(imageData, 0, 0);
+        link.style.backgroundImage = `url(${canvas.toDataURL()})`;
+    });
+}
+
+// Decode a BlurHash (https://blurha.sh) into RGBA pixels, or null if the
+// hash is malformed
+function decodeBlurHash(hash, width, height) {
+    const digits = '0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~';
+    const decode83 = str => {
+        let value = 0;
+        for (const c of str) {
+            const digit = digits.indexOf(c);
+            if (digit < 0) return NaN;
+            value = value * 83 + digit;
+        }
+        return value;
+    };
+    const toLinear = v => {
+        const c = v / 255;
+        return c <= 0.04045 ? c / 12.92 : Math.pow((c + 0.055) / 1.055, 2.4);
+    };
+    const toSRGB = v => {
+        const c = Math.max(0, Math.min(1, v));
+        return c <= 0.0031308 ? Math.round(c * 12.92 * 255) : Math.round((1.055 * Math.pow(c, 1 / 2.4) - 0.055) * 255);
+    };
+    const signPow = (v, exp) => Math.sign(v) * Math.pow(Math.abs(v), exp);
+
+    if (!hash || hash.length < 6) return null;
+    const sizeFlag = decode83(hash[0]);
+    const cx = (sizeFlag % 9) + 1;
+    const cy = Math.floor(sizeFlag / 9) + 1;
+    if (hash.length !== 4 + 2 * cx * cy) return null;
+    const maximum = (decode83(hash[1]) + 1) / 166;
+
+    const colors = [];
+    const dc = decode83(hash.substring(2, 6));
+    colors.push([toLinear(dc >> 16), toLinear((dc >> 8) & 255), toLinear(dc & 255)]);
+    for (let i = 1; i < cx * cy; i++) {
+        const ac = decode83(hash.substring(4 + i * 2, 6 + i * 2));
+        colors.push([
+            signPow((Math.floor(ac / 361) - 9) / 9, 2) * maximum,
+            signPow((Math.floor(ac / 19) % 19 - 9) / 9, 2) * maximum,
+            signPow((ac % 19 - 9) / 9, 2) * maximum
+        ]);
+    }
+    if (colors.some(c => c.some(isNaN))) return null;
+
+    const pixels = new Uint8ClampedArray(width * height * 4);
+    for (let y = 0; y < height; y++) {
+        for (let x = 0; x < width; x++) {
+            let r = 0, g = 0, b = 0;
+            for (let j = 0; j < cy; j++) {
+                for (let i = 0; i < cx; i++) {
+                    const basis = Math.cos(Math.PI * x * i / width) * Math.cos(Math.PI * y * j / height);
+                    const color = colors[i + j * cx];
+                    r += color[0] * basis;
+                    g += color[1] * basis;
+                    b += color[2] * basis;
+                }
+            }
+            const p = 4 * (x + y * width);
+            pixels[p] = toSRGB(r);
+            pixels[p + 1] = toSRGB(g);
+            pixels[p + 2] = toSRGB(b);
+            pixels[p + 3] = 255;
+        }
+    }
+    return pixels;
+}
+
 // Basic lightbox implementation
 function initializeLightbox(links) {
     // Create lightbox elements
@@ -132,6 +223,7 @@ function initializeLightbox(links) {
     const lightboxImage = lightbox.querySelector('.lightbox-image');
     const lightboxVideo = lightbox.querySelector('.lightbox-video');
     const lightboxExif = lightbox.querySelector('.lightbox-exif');
+    const lightboxInfo = lightbox.querySelector('.lightbox-info');
     const closeBtn = lightbox.querySelector('.lightbox-close');
     const prevBtn = lightbox.querySelector('.lightbox-prev');
     const nextBtn = lightbox.querySelector('.lightbox-next');
@@ -148,6 +240,33 @@ function initializeLightbox(links) {
             lightbox.classList.add('active');
         });
     });
+
+    // "+N" on a stack's pick opens the rest of the stack
+    document.querySelectorAll('.stack-pick .stack-count').forEach(button => {
+        button.addEventListener('click', function() {
+            const pick = button.closest('.stack-pick');
+            pick.classList.add('stack-open');
+            currentIndex = photos.indexOf(pick.querySelector('.stack-member .photo-link'));
+            showPhoto(currentIndex);
+            lightbox.classList.add('active');
+        });
+    });
+
+    // Stacked photos are only visited once their stack is opened
+    function isCollapsed(link) {
+        const member = link.closest('.stack-member');
+        return member !== null && !member.closest('.stack-pick').classList.contains('stack-open');
+    }
+
+    function step(direction) {
+        let index = currentIndex;
+        for (let i = 0; i < photos.length; i++) {
+            index = (index + direction + photos.length) % photos.length;
+            if (!isCollapsed(photos[index])) break;
+        }
+        currentIndex = index;
+        showPhoto(currentIndex);
+    }
     
     // Close lightbox
     closeBtn.addEventListener('click', closeLightbox);
@@ -159,13 +278,11 @@ function initializeLightbox(links) {
     
     // Navigation
     prevBtn.addEventListener('click', function() {
-        currentIndex = (currentIndex - 1 + photos.length) % photos.length;
-        showPhoto(currentIndex);
+        step(-1);
     });
     
     nextBtn.addEventListener('click', function() {
-        currentIndex = (currentIndex + 1) % photos.length;
-        showPhoto(currentIndex);
+        step(1);
     });
     
     // Keyboard navigation
@@ -181,6 +298,7 @@ function initializeLightbox(links) {
         const link = photos[index];
         const card = link.closest('.photo-card');
         const isVideo = card && card.dataset.video === 'true';
+        const isAnimation = card && card.dataset.animated === 'video';
 
         // Pause any hover preview
         const preview = card && card.querySelector('.video-preview');
@@ -188,9 +306,13 @@ function initializeLightbox(links) {
             preview.pause();
         }
 
-        if (isVideo) {
-            const videoSrc = card.dataset.videoSrc;
-            lightboxVideo.src = videoSrc;
+        if (isVideo || isAnimation) {
+            // Animated GIFs converted to video loop silently, like GIFs
+            lightboxVideo.controls = !isAnimation;
+            lightboxVideo.loop = isAnimation;
+            lightboxVideo.muted = isAnimation;
+            lightboxVideo.autoplay = isAnimation;
+            lightboxVideo.src = isAnimation ? link.href : card.dataset.videoSrc;
             lightboxVideo.style.display = 'block';
             lightboxImage.style.display = 'none';
         } else {
@@ -198,10 +320,37 @@ function initializeLightbox(links) {
             lightboxVideo.src = '';
             lightboxVideo.style.display = 'none';
             lightboxImage.src = link.href;
-            lightboxImage.alt = link.querySelector('img').alt;
+            // Stacked photos have no thumbnail to take the alt text from
+            const img = link.querySelector('img');
+            lightboxImage.alt = img ? img.alt : link.dataset.alt || '';
             lightboxImage.style.display = 'block';
         }
 
+        // Link to the photo's own page
+        lightboxInfo.innerHTML = '';
+        if (card && card.dataset.page) {
+            const permalink = document.createElement('a');
+            permalink.href = card.dataset.page;
+            permalink.className = 'lightbox-permalink';
+            permalink.textContent = 'Photo page';
+            lightboxInfo.appendChild(permalink);
+        }
+
+        // Offer the rest of a closed stack
+        const pick = card && card.classList.contains('stack-pick') && !card.classList.contains('stack-open') ? card : null;
+        if (pick) {
+            const count = pick.querySelectorAll('.stack-member').length;
+            const more = document.createElement('button');
+            more.type = 'button';
+            more.className = 'lightbox-stack';
+            more.textContent = '+' + count + (count === 1 ? ' similar photo' : ' similar photos');
+            more.addEventListener('click', function() {
+                pick.classList.add('stack-open');
+                step(1);
+            });
+            lightboxInfo.appendChild(more);
+        }
+
         // Show EXIF data
         if (card) {
             const parts = [];
@@ -230,6 +379,7 @@ function initializeLightbox(links) {
 
     function closeLightbox() {
         lightbox.classList.remove('active');
+        document.querySelectorAll('.stack-open').forEach(pick => pick.classList.remove('stack-open'));
         lightboxVideo.pause();
         lightboxVideo.src = '';
         lightboxVideo.style.display = 'none';
@@ -327,6 +477,31 @@ const lightboxStyles = `
     padding: 0.5rem 0 0;
 }
 
+.lightbox-permalink {
+    color: rgba(255, 255, 255, 0.8);
+    font-size: 0.85rem;
+}
+
+.lightbox-stack {
+    margin-left: 1rem;
+    padding: 0.1rem 0.6rem;
+    background: none;
+    border: 1px solid rgba(255, 255, 255, 0.6);
+    border-radius: 1rem;
+    color: rgba(255, 255, 255, 0.8);
+    font-size: 0.85rem;
+    cursor: pointer;
+}
+
+.lightbox-stack:hover {
+    color: white;
+    border-color: white;
+}
+
+.lightbox-permalink:hover {
+    color: white;
+}
+
 .lightbox-exif {
     display: none;
     text-align: center;
@@ -0,0 +1,77 @@
+// Gallery map
+//
+// Plots every geotagged photo from map/photos.json, clustering nearby
+// markers. Each popup links to the photo's album and page.
+
+(function() {
+    const mapElement = document.getElementById('gallery-map');
+    if (!mapElement || typeof L === 'undefined') {
+        return;
+    }
+
+    const base = mapElement.dataset.base || '.';
+
+    const map = L.map(mapElement).setView([20, 0], 2);
+    L.tileLayer('https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png', {
+        attribution: '&copy; <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors',
+        maxZoom: 19
+    }).addTo(map);
+
+    // Popups are built from DOM nodes so titles never become markup
+    function popup(point) {
+        const box = document.createElement('div');
+        box.className = 'map-popup';
+
+        if (point.thumb) {
+            const img = document.createElement('img');
+            img.src = base + point.thumb;
+            img.alt = point.title;
+            img.loading = 'lazy';
+            if (point.url) {
+                const link = document.createElement('a');
+                link.href = base + point.url;
+                link.appendChild(img);
+                box.appendChild(link);
+            } else {
+                box.appendChild(img);
+            }
+        }
+
+        const title = document.createElement('strong');
+        title.textContent = point.title;
+        box.appendChild(title);
+
+        const album = document.createElement('a');
+        album.className = 'map-popup-album';
+        album.href = base + point.albumUrl;
+        album.textContent = point.album;
+        box.appendChild(album);
+
+        return box;
+    }
+
+    fetch(mapElement.dataset.points)
+        .then(function(response) {
+            if (!response.ok) {
+                throw new Error(response.status);
+            }
+            return response.json();
+        })
+        .then(function(points) {
+            // Fall back to plain markers if the clustering plugin didn't load
+            const layer = L.markerClusterGroup ? L.markerClusterGroup() : L.featureGroup();
+            points.forEach(function(point) {
+                L.marker([point.lat, point.lng])
+                    .bindPopup(function() { return popup(point); }, { minWidth: 160, maxWidth: 240 })
+                    .addTo(layer);
+            });
+            layer.addTo(map);
+
+            if (points.length > 0) {
+                map.fitBounds(layer.getBounds().pad(0.1), { maxZoom: 14 });
+            }
+        })
+        .catch(function(err) {
+            console.error('Failed to load photo locations:', err);
+        });
+})();
@@ -0,0 +1,228 @@
+// Client-side gallery search
+//
+// search-index.json lists every album along with the words found in its
+// photos. An album's photo shard is only fetched when the query could match
+// one of its photos, so large galleries stay cheap to search.
+
+(function() {
+    const results = document.getElementById('search-results');
+    if (!results) {
+        return;
+    }
+
+    const input = document.getElementById('search-input');
+    const status = document.getElementById('search-status');
+    const base = results.dataset.base || '.';
+    const maxPhotos = 200;
+
+    let indexPromise = null;
+    const shards = {};
+    let latest = 0;
+
+    // Must split text the same way as searchTerms in the generator
+    function tokenize(text) {
+        return (text || '').toLowerCase().match(/[\p{L}\p{N}]+/gu) || [];
+    }
+
+    // Every query term has to prefix one of the words
+    function matchesAll(terms, words) {
+        return terms.every(function(term) {
+            return words.some(function(word) { return word.startsWith(term); });
+        });
+    }
+
+    function matchesAny(terms, words) {
+        return terms.some(function(term) {
+            return words.some(function(word) { return word.startsWith(term); });
+        });
+    }
+
+    function albumWords(album) {
+        if (!album._words) {
+            album._words = tokenize([album.t, album.d, album.dt].concat(album.g || []).join(' '));
+        }
+        return album._words;
+    }
+
+    function photoWords(photo) {
+        if (!photo._words) {
+            photo._words = tokenize([photo.t, photo.d, photo.c, photo.l, photo.dt].concat(photo.g || []).join(' '));
+        }
+        return photo._words;
+    }
+
+    function fetchJSON(url) {
+        return fetch(url).then(function(response) {
+            if (!response.ok) {
+                throw new Error(url + ': ' + response.status);
+            }
+            return response.json();
+        });
+    }
+
+    function loadIndex() {
+        if (!indexPromise) {
+            indexPromise = fetchJSON(results.dataset.index);
+        }
+        return indexPromise;
+    }
+
+    function loadShard(path) {
+        if (!shards[path]) {
+            shards[path] = fetchJSON(base + path);
+        }
+        return shards[path];
+    }
+
+    function search(query) {
+        const seq = ++latest;
+        const terms = tokenize(query);
+
+        const url = query ? '?q=' + encodeURIComponent(query) : window.location.pathname;
+        history.replaceState(null, '', url);
+
+        if (terms.length === 0) {
+            results.innerHTML = '';
+            status.textContent = '';
+            return;
+        }
+        status.textContent = 'Searching…';
+
+        loadIndex().then(function(index) {
+            const albumHits = [];
+            const photoHits = index.albums.map(function() { return []; });
+            const pending = [];
+
+            index.albums.forEach(function(album, i) {
+                const words = albumWords(album);
+                if (matchesAll(terms, words)) {
+                    albumHits.push(album);
+                }
+
+                // Photos match when every term is found in the photo or its
+                // album and at least one in the photo itself
+                const photoTerms = album.w || [];
+                if (!album.s || !matchesAny(terms, photoTerms) || !matchesAll(terms, words.concat(photoTerms))) {
+                    return;
+                }
+                pending.push(loadShard(album.s).then(function(shard) {
+                    shard.photos.forEach(function(photo) {
+                        const own = photoWords(photo);
+                        if (matchesAny(terms, own) && matchesAll(terms, words.concat(own))) {
+                            photoHits[i].push({ photo: photo, album: album });
+                        }
+                    });
+                }));
+            });
+
+            return Promise.all(pending).then(function() {
+                if (seq === latest) {
+                    render(albumHits, [].concat.apply([], photoHits));
+                }
+            });
+        }).catch(function(err) {
+            if (seq === latest) {
+                console.error(err);
+                status.textContent = 'The search index could not be loaded.';
+            }
+        });
+    }
+
+    function card(url, thumb, title, meta) {
+        const link = document.createElement('a');
+        link.className = 'search-result';
+        link.href = base + url;
+
+        const figure = document.createElement('div');
+        figure.className = 'search-result-image';
+        if (thumb) {
+            const img = document.createElement('img');
+            img.src = base + thumb;
+            img.alt = '';
+            img.loading = 'lazy';
+            figure.appendChild(img);
+        }
+        link.appendChild(figure);
+
+        const name = document.createElement('span');
+        name.className = 'search-result-title';
+        name.textContent = title;
+        link.appendChild(name);
+
+        if (meta) {
+            const details = document.createElement('span');
+            details.className = 'search-result-meta';
+            details.textContent = meta;
+            link.appendChild(details);
+        }
+        return link;
+    }
+
+    function section(title, cards) {
+        const heading = document.createElement('h2');
+        heading.className = 'search-section-title';
+        heading.textContent = title;
+        results.appendChild(heading);
+
+        const grid = document.createElement('div');
+        grid.className = 'search-grid';
+        cards.forEach(function(c) { grid.appendChild(c); });
+        results.appendChild(grid);
+    }
+
+    function render(albums, photos) {
+        results.innerHTML = '';
+
+        if (albums.length === 0 && photos.length === 0) {
+            status.textContent = 'Nothing found.';
+            return;
+        }
+
+        const counts = [];
+        if (albums.length) {
+            counts.push(albums.length + (albums.length === 1 ? ' album' : ' albums'));
+        }
+        if (photos.length) {
+            counts.push(photos.length + (photos.length === 1 ? ' photo' : ' photos'));
+        }
+        status.textContent = 'Found ' + counts.join(' and ') +
+            (photos.length > maxPhotos ? ', showing the first ' + maxPhotos + ' photos' : '') + '.';
+
+        if (albums.length) {
+            section('Albums', albums.map(function(album) {
+                const parts = [];
+                if (album.n) {
+                    parts.push(album.n + (album.n === 1 ? ' photo' : ' photos'));
+                }
+                if (album.dt) {
+                    parts.push(album.dt);
+                }
+                const meta = parts.join(' · ');
+                return card(album.u, album.i, album.t, meta);
+            }));
+        }
+        if (photos.length) {
+            section('Photos', photos.slice(0, maxPhotos).map(function(hit) {
+                const meta = hit.album.t + (hit.photo.dt ? ' · ' + hit.photo.dt : '');
+                return card(hit.photo.u, hit.photo.i, hit.photo.t, meta);
+            }));
+        }
+    }
+
+    let timer;
+    input.addEventListener('input', function() {
+        clearTimeout(timer);
+        timer = setTimeout(function() { search(input.value.trim()); }, 150);
+    });
+    input.form.addEventListener('submit', function(e) {
+        e.preventDefault();
+        clearTimeout(timer);
+        search(input.value.trim());
+    });
+
+    const initial = new URLSearchParams(window.location.search).get('q');
+    if (initial) {
+        input.value = initial;
+        search(initial.trim());
+    }
+})();
@@ -0,0 +1,440 @@
+package gallery
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/image"
+	"github.com/zeebo/blake3"
+)
+
+// ManifestFile is the name of the build manifest kept in the output directory
+const ManifestFile = ".purtypics-manifest.json"
+
+// manifestVersion is bumped whenever the manifest layout or the meaning of
+// its entries changes, invalidating every cached entry
+const manifestVersion = 3
+
+// BuildManifest records what the previous build produced so that unchanged
+// photos and pages can be reused instead of regenerated
+type BuildManifest struct {
+	Version  int                     `json:"version"`
+	Settings string                  `json:"settings"` // processor settings the renditions were made with
+	Theme    string                  `json:"theme"`    // hash of the theme files and generator version
+	Photos   map[string]*CachedPhoto `json:"photos"`   // keyed by source path relative to the source root
+	Pages    map[string]string       `json:"pages"`    // output page path -> fingerprint of its inputs
+
+	mu              sync.Mutex
+	seenPhoto       map[string]bool
+	seenPage        map[string]bool
+	settingsChanged bool
+}
+
+// CachedPhoto holds the processing results for one source file
+type CachedPhoto struct {
+	Size       int64             `json:"size"`
+	ModTime    time.Time         `json:"mtime"`
+	Hash       string            `json:"hash"`
+	Width      int               `json:"width,omitempty"`
+	Height     int               `json:"height,omitempty"`
+	EXIF       *exif.EXIFData    `json:"exif,omitempty"`
+	Thumbnails map[string]string `json:"thumbnails,omitempty"`
+	Renditions []image.Rendition `json:"renditions,omitempty"`
+	VideoPath  string            `json:"video,omitempty"`
+	BlurHash   string            `json:"blurhash,omitempty"`
+	Color      string            `json:"color,omitempty"`
+	Options    string            `json:"options,omitempty"` // fingerprint of per-photo render settings, see renderOptions
+}
+
+// LoadManifest reads the manifest from the output directory. A missing or
+// unreadable manifest yields an empty one. Photo entries are discarded when
+// the processor settings changed and page fingerprints when the theme
+// changed; the pages themselves stay listed so stale ones are still pruned.
+func LoadManifest(outputPath, settings, theme string) *BuildManifest {
+	m := readManifest(outputPath)
+	if m.Version != manifestVersion {
+		m = &BuildManifest{Pages: m.Pages}
+		m.forgetPageFingerprints()
+	}
+	return m.reset(settings, theme)
+}
+
+// NewManifest returns a manifest for a build that ignores previous results.
+// Only the pages the previous build wrote are kept, without fingerprints, so
+// those this build doesn't write again can be pruned.
+func NewManifest(outputPath, settings, theme string) *BuildManifest {
+	m := &BuildManifest{Pages: readManifest(outputPath).Pages}
+	m.forgetPageFingerprints()
+	return m.reset(settings, theme)
+}
+
+// readManifest reads the manifest as it is on disk, or returns an empty one
+func readManifest(outputPath string) *BuildManifest {
+	m := &BuildManifest{}
+	if data, err := os.ReadFile(filepath.Join(outputPath, ManifestFile)); err == nil {
+		if err := json.Unmarshal(data, m); err != nil {
+			m = &BuildManifest{}
+		}
+	}
+	return m
+}
+
+// forgetPageFingerprints keeps the list of pages but marks each of them as
+// needing to be rendered again
+func (m *BuildManifest) forgetPageFingerprints() {
+	for key := range m.Pages {
+		m.Pages[key] = ""
+	}
+}
+
+// reset drops entries that no longer apply and prepares the manifest for a build
+func (m *BuildManifest) reset(settings, theme string) *BuildManifest {
+	if m.Settings != settings {
+		m.settingsChanged = m.Settings != ""
+		m.Photos = nil
+	}
+	if m.Theme != theme {
+		m.forgetPageFingerprints()
+	}
+	if m.Photos == nil {
+		m.Photos = make(map[string]*CachedPhoto)
+	}
+	if m.Pages == nil {
+		m.Pages = make(map[string]string)
+	}
+
+	m.Version = manifestVersion
+	m.Settings = settings
+	m.Theme = theme
+	m.seenPhoto = make(map[string]bool)
+	m.seenPage = make(map[string]bool)
+	return m
+}
+
+// SettingsChanged reports whether the previous build used other processor
+// settings, so renditions it left behind are stale
+func (m *BuildManifest) SettingsChanged() bool {
+	return m.settingsChanged
+}
+
+// Save writes the manifest to the output directory, dropping entries for
+// photos that were not part of this build
+func (m *BuildManifest) Save(outputPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.Photos {
+		if !m.seenPhoto[key] {
+			delete(m.Photos, key)
+		}
+	}
+	// Pages not written this build are forgotten once they are gone from
+	// disk; until then they stay listed so a later build can prune them
+	for key := range m.Pages {
+		if m.seenPage[key] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(outputPath, filepath.FromSlash(key))); err != nil {
+			delete(m.Pages, key)
+		}
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted build never leaves
+	// a truncated manifest behind
+	path := filepath.Join(outputPath, ManifestFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Photo returns the cached entry for a source file. fresh reports whether the
+// entry still describes the file on disk; changed reports that the file's
+// content differs from what was cached, so existing renditions are stale.
+// When only the timestamp moved but the content hash matches, the entry is
+// refreshed in place and treated as fresh.
+func (m *BuildManifest) Photo(key, sourcePath string) (entry *CachedPhoto, fresh, changed bool) {
+	m.mu.Lock()
+	entry = m.Photos[key]
+	m.mu.Unlock()
+	if entry == nil {
+		return nil, false, false
+	}
+
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return nil, false, false
+	}
+	if info.Size() == entry.Size && info.ModTime().Equal(entry.ModTime) {
+		return entry, true, false
+	}
+
+	hash, err := hashFile(sourcePath)
+	if err != nil {
+		return nil, false, false
+	}
+	if hash != entry.Hash {
+		return entry, false, true
+	}
+
+	m.mu.Lock()
+	entry.Size = info.Size()
+	entry.ModTime = info.ModTime()
+	m.mu.Unlock()
+	return entry, true, false
+}
+
+// SetPhoto stores the processing results for a source file
+func (m *BuildManifest) SetPhoto(key, sourcePath string, entry *CachedPhoto) error {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return err
+	}
+	hash, err := hashFile(sourcePath)
+	if err != nil {
+		return err
+	}
+	entry.Size = info.Size()
+	entry.ModTime = info.ModTime()
+	entry.Hash = hash
+
+	m.mu.Lock()
+	m.Photos[key] = entry
+	m.seenPhoto[key] = true
+	m.mu.Unlock()
+	return nil
+}
+
+// KeepPhoto marks a cached entry as still in use
+func (m *BuildManifest) KeepPhoto(key string) {
+	m.mu.Lock()
+	m.seenPhoto[key] = true
+	m.mu.Unlock()
+}
+
+// PageFresh reports whether the page at relPath was rendered from the same
+// inputs last time and still exists. The page is marked as in use either way.
+func (m *BuildManifest) PageFresh(outputPath, relPath, fingerprint string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seenPage[relPath] = true
+	if m.Pages[relPath] != fingerprint {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(outputPath, filepath.FromSlash(relPath)))
+	return err == nil
+}
+
+// SetPage records the fingerprint of a freshly rendered page. Pages that are
+// rendered on every build are recorded with an empty fingerprint.
+func (m *BuildManifest) SetPage(relPath, fingerprint string) {
+	m.mu.Lock()
+	m.Pages[relPath] = fingerprint
+	m.seenPage[relPath] = true
+	m.mu.Unlock()
+}
+
+// PageWritten reports whether the page at relPath is part of this build
+func (m *BuildManifest) PageWritten(relPath string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.seenPage[relPath]
+}
+
+// StalePages lists pages recorded by an earlier build that this build has
+// not written
+func (m *BuildManifest) StalePages() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var stale []string
+	for key := range m.Pages {
+		if !m.seenPage[key] {
+			stale = append(stale, key)
+		}
+	}
+	return stale
+}
+
+// newCachedPhoto captures the processing results of a photo
+func newCachedPhoto(photo *Photo) *CachedPhoto {
+	entry := &CachedPhoto{
+		Width:      photo.Width,
+		Height:     photo.Height,
+		EXIF:       copyEXIF(photo.EXIF),
+		Thumbnails: photo.Thumbnails,
+		Renditions: photo.Renditions,
+		BlurHash:   photo.BlurHash,
+		Color:      photo.Color,
+		Options:    renderOptions(photo),
+	}
+	// Only a copied video lives in the output directory; otherwise
+	// VideoPath still points at the source file
+	if photo.IsVideo && strings.HasPrefix(photo.VideoPath, "/static/") {
+		entry.VideoPath = photo.VideoPath
+	}
+	return entry
+}
+
+// renderOptions fingerprints the per-photo settings that change a photo's
+// renditions, so editing them regenerates that photo alone. Empty when the
+// photo has none.
+func renderOptions(photo *Photo) string {
+	var options []interface{}
+	if photo.focalPoint != nil {
+		options = append(options, photo.focalPoint)
+	}
+	if !photo.edit.IsZero() {
+		options = append(options, photo.edit)
+	}
+	if !photo.adjustments.IsZero() {
+		options = append(options, photo.adjustments)
+	}
+	if photo.stripped {
+		options = append(options, "stripped video")
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	return fingerprint(options...)
+}
+
+// apply copies cached processing results onto a photo
+func (c *CachedPhoto) apply(photo *Photo) {
+	photo.Width = c.Width
+	photo.Height = c.Height
+	photo.EXIF = copyEXIF(c.EXIF)
+	photo.Thumbnails = c.Thumbnails
+	photo.Renditions = c.Renditions
+	photo.BlurHash = c.BlurHash
+	photo.Color = c.Color
+	if c.VideoPath != "" {
+		photo.VideoPath = c.VideoPath
+	}
+}
+
+// copyEXIF returns a copy of the EXIF data so later edits to a photo, such
+// as scrubbing its location, never leak into the cache
+func copyEXIF(data *exif.EXIFData) *exif.EXIFData {
+	if data == nil {
+		return nil
+	}
+	dup := *data
+	if data.GPS != nil {
+		gps := *data.GPS
+		dup.GPS = &gps
+	}
+	return &dup
+}
+
+// outputsExist reports whether every rendition recorded in the entry is still
+// present in the output directory
+func (c *CachedPhoto) outputsExist(outputPath string) bool {
+	paths := make([]string, 0, len(c.Thumbnails)+len(c.Renditions)+1)
+	for _, p := range c.Thumbnails {
+		paths = append(paths, p)
+	}
+	for _, r := range c.Renditions {
+		paths = append(paths, r.Path)
+	}
+	if c.VideoPath != "" {
+		paths = append(paths, c.VideoPath)
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(outputFile(outputPath, p)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// removeOutputs deletes the renditions recorded in the entry
+func (c *CachedPhoto) removeOutputs(outputPath string) {
+	for _, p := range c.Thumbnails {
+		os.Remove(outputFile(outputPath, p))
+	}
+	for _, r := range c.Renditions {
+		os.Remove(outputFile(outputPath, r.Path))
+	}
+	if c.VideoPath != "" {
+		os.Remove(outputFile(outputPath, c.VideoPath))
+	}
+}
+
+// outputFile converts a site URL path such as /static/thumbs/a/b_small.jpg
+// into its location in the output directory
+func outputFile(outputPath, urlPath string) string {
+	return filepath.Join(outputPath, filepath.FromSlash(strings.TrimPrefix(urlPath, "/")))
+}
+
+// hashFile returns the hex blake3 hash of a file's content
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := blake3.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fingerprint hashes the JSON encoding of the given values
+func fingerprint(values ...interface{}) string {
+	h := blake3.New()
+	enc := json.NewEncoder(h)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			// Unencodable input: return a value that never matches
+			return fmt.Sprintf("unhashable-%d", time.Now().UnixNano())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// themeFingerprint hashes every file in the theme so edits to templates or
+// assets invalidate rendered pages
+func themeFingerprint(themeFS *ThemeFS) (string, error) {
+	root, err := themeFS.GetStaticFS()
+	if err != nil {
+		return "", err
+	}
+
+	h := blake3.New()
+	err = fs.WalkDir(root, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := fs.ReadFile(root, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", path, len(data))
+		h.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
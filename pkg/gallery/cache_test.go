@@ -0,0 +1,87 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildManifest_Photo(t *testing.T) {
+	src := t.TempDir()
+	out := t.TempDir()
+	photoPath := filepath.Join(src, "one.jpg")
+	if err := os.WriteFile(photoPath, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := LoadManifest(out, "settings", "theme")
+	if err := m.SetPhoto("one.jpg", photoPath, &CachedPhoto{Width: 10, Height: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Save(out); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same settings: the entry survives and is fresh
+	m = LoadManifest(out, "settings", "theme")
+	if entry, fresh, _ := m.Photo("one.jpg", photoPath); !fresh || entry.Width != 10 {
+		t.Fatalf("expected fresh cached entry, got %+v (fresh=%v)", entry, fresh)
+	}
+
+	// Touching the file without changing content keeps it fresh
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(photoPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, fresh, changed := m.Photo("one.jpg", photoPath); !fresh || changed {
+		t.Errorf("touched file: fresh=%v changed=%v, want fresh", fresh, changed)
+	}
+
+	// Rewriting the content marks it changed even with an older timestamp
+	if err := os.WriteFile(photoPath, []byte("replaced"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	earlier := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(photoPath, earlier, earlier); err != nil {
+		t.Fatal(err)
+	}
+	if _, fresh, changed := m.Photo("one.jpg", photoPath); fresh || !changed {
+		t.Errorf("rewritten file: fresh=%v changed=%v, want changed", fresh, changed)
+	}
+
+	// Different settings discard cached photos
+	m = LoadManifest(out, "other settings", "theme")
+	if entry, _, _ := m.Photo("one.jpg", photoPath); entry != nil {
+		t.Errorf("expected no entry after settings change, got %+v", entry)
+	}
+}
+
+func TestBuildManifest_PagesOutliveTheme(t *testing.T) {
+	out := t.TempDir()
+	m := LoadManifest(out, "settings", "theme")
+	m.SetPage("trip/b/index.html", "fingerprint")
+	if err := os.MkdirAll(filepath.Join(out, "trip", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(out, "trip", "b", "index.html"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Save(out); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new theme or generator version, and a build that ignores the cache,
+	// rerender every page but still know the old ones to prune them
+	for name, m := range map[string]*BuildManifest{
+		"theme change": LoadManifest(out, "settings", "new theme"),
+		"no cache":     NewManifest(out, "settings", "theme"),
+	} {
+		if stale := m.StalePages(); len(stale) != 1 || stale[0] != "trip/b/index.html" {
+			t.Errorf("%s: stale pages = %v", name, stale)
+		}
+		if m.PageFresh(out, "trip/b/index.html", "fingerprint") {
+			t.Errorf("%s: page still fresh", name)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package gallery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cjs/purtypics/pkg/image"
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+// DefaultDuplicateThreshold is how many of the 64 bits of a perceptual hash
+// may differ for two photos to count as near duplicates. Resized and
+// recompressed copies stay well below it; unrelated photos differ in about
+// half the bits.
+const DefaultDuplicateThreshold = 8
+
+// DuplicatePhoto is one copy in a group of duplicates
+type DuplicatePhoto struct {
+	Path     string `json:"path"`  // source file, also the key of its photo metadata
+	Album    string `json:"album"` // album ID
+	Filename string `json:"filename"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Size     int64  `json:"size"`
+	Hidden   bool   `json:"hidden"`
+}
+
+// DuplicateGroup is a set of photos that show the same picture
+type DuplicateGroup struct {
+	Exact  bool             `json:"exact"`  // every copy has identical content
+	Photos []DuplicatePhoto `json:"photos"` // best copy first: most pixels, then largest file
+}
+
+// DuplicateFinder groups the copies of each picture across albums. Hashes
+// are kept between runs, so the editor only reads new or changed files when
+// asked again.
+type DuplicateFinder struct {
+	Threshold int // see DefaultDuplicateThreshold
+
+	mu     sync.Mutex
+	hashes map[string]*photoHash
+}
+
+// photoHash is what the finder knows about one source file
+type photoHash struct {
+	size    int64
+	modTime time.Time
+	content string
+	image   image.ImageHash
+	width   int
+	height  int
+}
+
+// NewDuplicateFinder creates a finder that reports photos whose perceptual
+// hashes differ in at most threshold bits
+func NewDuplicateFinder(threshold int) *DuplicateFinder {
+	return &DuplicateFinder{
+		Threshold: threshold,
+		hashes:    make(map[string]*photoHash),
+	}
+}
+
+// Find hashes every photo in the albums and returns the groups of exact and
+// near duplicates, exact groups first. Videos are not compared. Photos that
+// can't be read are left out and returned as errors.
+func (f *DuplicateFinder) Find(albums []Album, meta *metadata.GalleryMetadata, progress ProgressCallback) ([]DuplicateGroup, []error) {
+	var photos []DuplicatePhoto
+	for _, album := range albums {
+		for _, photo := range album.Photos {
+			if photo.IsVideo {
+				continue
+			}
+			path := filepath.Join(album.Path, photo.Filename)
+			dup := DuplicatePhoto{Path: path, Album: album.ID, Filename: photo.Filename}
+			if meta != nil {
+				if photoMeta := meta.GetPhotoMetadata(path); photoMeta != nil {
+					dup.Hidden = photoMeta.Hidden
+				}
+			}
+			photos = append(photos, dup)
+		}
+	}
+
+	paths := make([]string, len(photos))
+	for i := range photos {
+		paths[i] = photos[i].Path
+	}
+	hashes, errs := f.hashAll(paths, progress)
+
+	// Join every pair of photos that match into one group
+	parent := make([]int, len(photos))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range photos {
+		if hashes[i] == nil {
+			continue
+		}
+		photos[i].Width, photos[i].Height = hashes[i].width, hashes[i].height
+		photos[i].Size = hashes[i].size
+		for j := i + 1; j < len(photos); j++ {
+			if hashes[j] == nil {
+				continue
+			}
+			if hashes[i].content == hashes[j].content || hashes[i].image.Distance(hashes[j].image) <= f.Threshold {
+				parent[root(j)] = root(i)
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range photos {
+		if hashes[i] != nil {
+			members[root(i)] = append(members[root(i)], i)
+		}
+	}
+
+	var groups []DuplicateGroup
+	for _, indexes := range members {
+		if len(indexes) < 2 {
+			continue
+		}
+		group := DuplicateGroup{Exact: true}
+		for _, i := range indexes {
+			group.Photos = append(group.Photos, photos[i])
+			if hashes[i].content != hashes[indexes[0]].content {
+				group.Exact = false
+			}
+		}
+		sort.Slice(group.Photos, func(a, b int) bool {
+			pa, pb := group.Photos[a], group.Photos[b]
+			if pa.Width*pa.Height != pb.Width*pb.Height {
+				return pa.Width*pa.Height > pb.Width*pb.Height
+			}
+			if pa.Size != pb.Size {
+				return pa.Size > pb.Size
+			}
+			return pa.Path < pb.Path
+		})
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(a, b int) bool {
+		if groups[a].Exact != groups[b].Exact {
+			return groups[a].Exact
+		}
+		return groups[a].Photos[0].Path < groups[b].Photos[0].Path
+	})
+	return groups, errs
+}
+
+// hashAll hashes the files concurrently. The hashes come back in the order
+// of paths, nil for files that can't be read, which are also returned as
+// errors.
+func (f *DuplicateFinder) hashAll(paths []string, progress ProgressCallback) ([]*photoHash, []error) {
+	hashes := make([]*photoHash, len(paths))
+	var errs []error
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	sem := make(chan struct{}, 4)
+	for i := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			hash, err := f.hash(paths[i])
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", paths[i], err))
+			}
+			hashes[i] = hash
+			done++
+			if progress != nil {
+				progress(done, len(paths), fmt.Sprintf("Hashing %s", filepath.Base(paths[i])))
+			}
+		}(i)
+	}
+	wg.Wait()
+	return hashes, errs
+}
+
+// hash returns the hashes of a source file, reading it only if it changed
+// since the last run
+func (f *DuplicateFinder) hash(path string) (*photoHash, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	cached := f.hashes[path]
+	f.mu.Unlock()
+	if cached != nil && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached, nil
+	}
+
+	content, err := hashFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, err := image.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	hash := &photoHash{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		content: content,
+		image:   image.HashImage(img),
+		width:   bounds.Dx(),
+		height:  bounds.Dy(),
+	}
+
+	f.mu.Lock()
+	f.hashes[path] = hash
+	f.mu.Unlock()
+	return hash, nil
+}
@@ -0,0 +1,68 @@
+package gallery
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cjs/purtypics/pkg/metadata"
+	"github.com/disintegration/imaging"
+)
+
+func TestDuplicateFinder(t *testing.T) {
+	dir := t.TempDir()
+	save := func(rel string, width int, flip bool) {
+		t.Helper()
+		img := imaging.New(1200, 800, color.NRGBA{30, 60, 90, 255})
+		for y := 500; y < 800; y++ {
+			for x := 0; x < 700; x++ {
+				img.Set(x, y, color.NRGBA{220, 180, 40, 255})
+			}
+		}
+		if flip {
+			img = imaging.FlipH(imaging.FlipV(img))
+		}
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := imaging.Save(imaging.Resize(img, width, 0, imaging.Lanczos), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("trip/beach.jpg", 1200, false)
+	save("trip/sunset.jpg", 1200, true)
+	save("best/web.jpg", 600, false) // smaller export of the same shot
+	data, err := os.ReadFile(filepath.Join(dir, "trip", "sunset.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "best", "sunset.jpg"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	albums, err := ScanDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := &metadata.GalleryMetadata{Photos: map[string]*metadata.PhotoMetadata{
+		filepath.Join(dir, "best", "sunset.jpg"): {Hidden: true},
+	}}
+	groups, errs := NewDuplicateFinder(DefaultDuplicateThreshold).Find(albums, meta, nil)
+	if len(errs) != 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2: %+v", len(groups), groups)
+	}
+
+	exact := groups[0]
+	if !exact.Exact || len(exact.Photos) != 2 || exact.Photos[0].Album != "best" || !exact.Photos[0].Hidden {
+		t.Errorf("exact group = %+v, want both sunsets with best/ first and hidden", exact)
+	}
+	near := groups[1]
+	if near.Exact || len(near.Photos) != 2 || near.Photos[0].Filename != "beach.jpg" || near.Photos[0].Width != 1200 {
+		t.Errorf("near group = %+v, want the 1200px beach before the web export", near)
+	}
+}
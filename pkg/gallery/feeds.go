@@ -0,0 +1,444 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultFeedSize is the number of albums listed in each feed when the
+// gallery metadata doesn't say otherwise
+const defaultFeedSize = 20
+
+// feedEntry is one album as it appears in every feed format
+type feedEntry struct {
+	Title     string
+	URL       string
+	Summary   string
+	Content   string // HTML
+	Published time.Time
+	Image     *feedImage
+}
+
+// feedImage is the cover image attached to an entry
+type feedImage struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+// feedsEnabled reports whether feeds are published. Feeds need absolute
+// URLs, so they are skipped when the gallery has no base URL.
+func (g *Generator) feedsEnabled() bool {
+	return g.BaseURL != "" && !g.feedsDisabled()
+}
+
+// feedsDisabled reports whether the gallery opted out of feeds
+func (g *Generator) feedsDisabled() bool {
+	return g.metadata != nil && g.metadata.Feeds != nil && g.metadata.Feeds.Disabled
+}
+
+// feedSize returns the number of albums to list in each feed
+func (g *Generator) feedSize() int {
+	if g.metadata != nil && g.metadata.Feeds != nil && g.metadata.Feeds.Size > 0 {
+		return g.metadata.Feeds.Size
+	}
+	return defaultFeedSize
+}
+
+// generateFeeds writes feed.xml (Atom), rss.xml and feed.json listing the
+// newest albums
+func (g *Generator) generateFeeds(albums []Album, galleryData *GalleryData) error {
+	if !g.feedsEnabled() {
+		if g.Verbose && !g.feedsDisabled() {
+			fmt.Println("Skipping feeds: set base_url in gallery.yaml to publish them")
+		}
+		return nil
+	}
+
+	// The feeds are dated by their newest entry, or the source folder when
+	// empty, so rebuilding an unchanged gallery leaves them unchanged
+	entries := g.feedEntries(albums)
+	var updated time.Time
+	for _, entry := range entries {
+		if entry.Published.After(updated) {
+			updated = entry.Published
+		}
+	}
+	if updated.IsZero() {
+		if info, err := os.Stat(g.SourcePath); err == nil {
+			updated = info.ModTime().UTC()
+		}
+	}
+
+	writers := []struct {
+		name  string
+		write func([]feedEntry, *GalleryData, time.Time) ([]byte, error)
+	}{
+		{"feed.xml", g.atomFeed},
+		{"rss.xml", g.rssFeed},
+		{"feed.json", g.jsonFeed},
+	}
+	for _, w := range writers {
+		data, err := w.write(entries, galleryData, updated)
+		if err != nil {
+			return fmt.Errorf("failed to build %s: %w", w.name, err)
+		}
+		if err := os.WriteFile(filepath.Join(g.OutputPath, w.name), data, 0644); err != nil {
+			return err
+		}
+		if g.cache != nil {
+			g.cache.SetPage(w.name, "")
+		}
+	}
+	return nil
+}
+
+// albumDate returns the date of an album's feed entry: the date albums are
+// sorted by or, for albums without one, their newest photo or their folder
+func albumDate(album *Album) time.Time {
+	if !album.CreatedAt.IsZero() {
+		return album.CreatedAt
+	}
+	var newest time.Time
+	for _, photo := range album.Photos {
+		if t := photoTime(photo); t.After(newest) {
+			newest = t
+		}
+	}
+	if newest.IsZero() {
+		if info, err := os.Stat(album.Path); err == nil {
+			newest = info.ModTime()
+		}
+	}
+	return newest
+}
+
+// feedEntries returns the newest albums with photos, newest first
+func (g *Generator) feedEntries(albums []Album) []feedEntry {
+	candidates := make([]*Album, 0, len(albums))
+	for i := range albums {
+		if len(albums[i].Photos) > 0 {
+			candidates = append(candidates, &albums[i])
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+	})
+	if size := g.feedSize(); len(candidates) > size {
+		candidates = candidates[:size]
+	}
+
+	entries := make([]feedEntry, 0, len(candidates))
+	for _, album := range candidates {
+		count := fmt.Sprintf("%d photos", len(album.Photos))
+		if len(album.Photos) == 1 {
+			count = "1 photo"
+		}
+		summary := count
+		if album.Description != "" {
+			summary = fmt.Sprintf("%s (%s)", stripTags(string(album.Description)), count)
+		}
+
+		entry := feedEntry{
+			Title:     album.Title,
+			URL:       absoluteURL(g.BaseURL, "/"+album.ID+"/"),
+			Summary:   summary,
+			Published: albumDate(album).UTC(),
+		}
+
+		var content strings.Builder
+		if cover := album.Cover(); cover != nil {
+			if thumb := cover.Rendition("large", "full", "medium", "poster", "small"); thumb != "" {
+				entry.Image = g.feedImage(thumb)
+				fmt.Fprintf(&content, `<p><a href="%s"><img src="%s" alt="%s"></a></p>`,
+					html.EscapeString(entry.URL), html.EscapeString(entry.Image.URL), html.EscapeString(cover.DisplayTitle()))
+			}
+		}
+		if album.Description != "" {
+			fmt.Fprintf(&content, "<p>%s</p>", album.Description)
+		}
+		fmt.Fprintf(&content, `<p><a href="%s">%s</a></p>`, html.EscapeString(entry.URL), html.EscapeString(count))
+		entry.Content = content.String()
+
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// feedImage describes a rendition as an enclosure
+func (g *Generator) feedImage(sitePath string) *feedImage {
+	image := &feedImage{
+		URL:  absoluteURL(g.BaseURL, sitePath),
+		Type: mime.TypeByExtension(path.Ext(sitePath)),
+	}
+	if image.Type == "" {
+		image.Type = "image/jpeg"
+	}
+	if info, err := os.Stat(outputFile(g.OutputPath, sitePath)); err == nil {
+		image.Length = info.Size()
+	}
+	return image
+}
+
+// stripTags removes HTML tags from album descriptions for plain-text fields
+func stripTags(s string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return html.UnescapeString(strings.TrimSpace(b.String()))
+}
+
+// Atom 1.0
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	ID        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Author    *atomAuthor `xml:"author,omitempty"`
+	Rights    string      `xml:"rights,omitempty"`
+	Generator string      `xml:"generator"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary,omitempty"`
+	Content   atomText   `xml:"content"`
+}
+
+func (g *Generator) atomFeed(entries []feedEntry, galleryData *GalleryData, updated time.Time) ([]byte, error) {
+	feed := atomFeed{
+		Title:    galleryData.Title,
+		Subtitle: galleryData.Description,
+		ID:       g.BaseURL + "/",
+		Updated:  updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: g.BaseURL + "/feed.xml"},
+			{Rel: "alternate", Type: "text/html", Href: g.BaseURL + "/"},
+		},
+		Rights:    galleryData.Copyright,
+		Generator: "Purtypics " + g.Version,
+	}
+	// Atom requires an author; fall back to the gallery title
+	feed.Author = &atomAuthor{Name: galleryData.Author}
+	if feed.Author.Name == "" {
+		feed.Author.Name = galleryData.Title
+	}
+
+	for _, e := range entries {
+		entry := atomEntry{
+			Title:     e.Title,
+			ID:        e.URL,
+			Updated:   e.Published.Format(time.RFC3339),
+			Published: e.Published.Format(time.RFC3339),
+			Links:     []atomLink{{Rel: "alternate", Type: "text/html", Href: e.URL}},
+			Summary:   e.Summary,
+			Content:   atomText{Type: "html", Body: e.Content},
+		}
+		if e.Image != nil {
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Type: e.Image.Type, Href: e.Image.URL, Length: e.Image.Length})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return marshalXML(feed)
+}
+
+// RSS 2.0
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	Copyright     string    `xml:"copyright,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Description string        `xml:"description"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+func (g *Generator) rssFeed(entries []feedEntry, galleryData *GalleryData, updated time.Time) ([]byte, error) {
+	description := galleryData.Description
+	if description == "" {
+		description = galleryData.Title
+	}
+	feed := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         galleryData.Title,
+			Link:          g.BaseURL + "/",
+			Description:   description,
+			AtomLink:      atomLink{Rel: "self", Type: "application/rss+xml", Href: g.BaseURL + "/rss.xml"},
+			Copyright:     galleryData.Copyright,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+			Generator:     "Purtypics " + g.Version,
+		},
+	}
+
+	for _, e := range entries {
+		item := rssItem{
+			Title:       e.Title,
+			Link:        e.URL,
+			GUID:        rssGUID{IsPermaLink: true, Value: e.URL},
+			PubDate:     e.Published.Format(time.RFC1123Z),
+			Description: e.Content,
+		}
+		if e.Image != nil {
+			item.Enclosure = &rssEnclosure{URL: e.Image.URL, Length: e.Image.Length, Type: e.Image.Type}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	return marshalXML(feed)
+}
+
+// JSON Feed 1.1
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	Summary       string               `json:"summary,omitempty"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+func (g *Generator) jsonFeed(entries []feedEntry, galleryData *GalleryData, updated time.Time) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       galleryData.Title,
+		HomePageURL: g.BaseURL + "/",
+		FeedURL:     g.BaseURL + "/feed.json",
+		Description: galleryData.Description,
+		Items:       make([]jsonFeedItem, 0, len(entries)),
+	}
+	if galleryData.Author != "" {
+		feed.Authors = []jsonFeedAuthor{{Name: galleryData.Author}}
+	}
+
+	for _, e := range entries {
+		item := jsonFeedItem{
+			ID:            e.URL,
+			URL:           e.URL,
+			Title:         e.Title,
+			ContentHTML:   e.Content,
+			Summary:       e.Summary,
+			DatePublished: e.Published.Format(time.RFC3339),
+		}
+		if e.Image != nil {
+			item.Image = e.Image.URL
+			item.Attachments = []jsonFeedAttachment{{URL: e.Image.URL, MimeType: e.Image.Type, SizeInBytes: e.Image.Length}}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalXML encodes v as an indented XML document
+func marshalXML(v interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
@@ -0,0 +1,84 @@
+package gallery
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+func TestGenerateFeeds(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	albums := []Album{
+		{ID: "old", Title: "Old", CreatedAt: day, Photos: []Photo{{ID: "a"}}},
+		{ID: "empty", Title: "Empty", CreatedAt: day.AddDate(0, 0, 3)},
+		{ID: "new", Title: "New", CreatedAt: day.AddDate(0, 0, 2), Photos: []Photo{{ID: "b"}}},
+		{ID: "middle", Title: "Middle", CreatedAt: day.AddDate(0, 0, 1), Photos: []Photo{{ID: "c"}}},
+	}
+	data := &GalleryData{Title: "Gallery"}
+
+	// Without a base URL there are no absolute links, so no feeds
+	out := t.TempDir()
+	g := &Generator{OutputPath: out, metadata: &metadata.GalleryMetadata{}}
+	if err := g.generateFeeds(albums, data); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"feed.xml", "rss.xml", "feed.json"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err == nil {
+			t.Errorf("%s written without a base URL", name)
+		}
+	}
+
+	g.BaseURL = "https://photos.example.com"
+	g.metadata.Feeds = &metadata.FeedSettings{Size: 2}
+	if err := g.generateFeeds(albums, data); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"feed.xml", "rss.xml"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("%s not written: %v", name, err)
+		}
+	}
+
+	raw, err := os.ReadFile(filepath.Join(out, "feed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed jsonFeed
+	if err := json.Unmarshal(raw, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Items) != 2 || feed.Items[0].Title != "New" || feed.Items[1].Title != "Middle" {
+		t.Fatalf("items = %+v, want the two newest albums with photos", feed.Items)
+	}
+	if feed.Items[0].URL != "https://photos.example.com/new/" {
+		t.Errorf("item URL = %q", feed.Items[0].URL)
+	}
+
+	// Undated albums are dated by their newest photo, not by the build
+	photoPath := filepath.Join(t.TempDir(), "d.jpg")
+	if err := os.WriteFile(photoPath, []byte("photo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	taken := day.AddDate(0, 0, 5)
+	if err := os.Chtimes(photoPath, taken, taken); err != nil {
+		t.Fatal(err)
+	}
+	undated := []Album{{ID: "undated", Title: "Undated", Photos: []Photo{{ID: "d", Path: photoPath}}}}
+	if err := g.generateFeeds(undated, data); err != nil {
+		t.Fatal(err)
+	}
+	if raw, err = os.ReadFile(filepath.Join(out, "feed.json")); err != nil {
+		t.Fatal(err)
+	}
+	feed = jsonFeed{}
+	if err := json.Unmarshal(raw, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if want := taken.Format(time.RFC3339); len(feed.Items) != 1 || feed.Items[0].DatePublished != want {
+		t.Errorf("items = %+v, want one published %s", feed.Items, want)
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"log"
 	"path/filepath"
 	"runtime/debug"
+	"strings"
 	"sync"
 
 	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/heif"
 	"github.com/cjs/purtypics/pkg/image"
 	"github.com/cjs/purtypics/pkg/metadata"
 	"github.com/cjs/purtypics/pkg/video"
@@ -27,9 +29,13 @@ type Generator struct {
 	MetadataPath     string
 	Version          string
 	CommitHash       string
+	NoCache          bool // ignore the build manifest and reprocess everything
+	NoPrune          bool // keep output files that this build no longer produces
 	metadata         *metadata.GalleryMetadata
+	cache            *BuildManifest
 	imageProcessor   *image.Processor
 	videoProcessor   *video.Processor
+	cardCrop         string // crop of album grids and covers, empty for the full frame
 	ProgressCallback ProgressCallback
 }
 
@@ -81,13 +87,27 @@ func (g *Generator) Generate() error {
 	if meta.Title != "" {
 		g.SiteTitle = meta.Title
 	}
+	if g.BaseURL == "" {
+		g.BaseURL = meta.BaseURL
+	}
+	g.BaseURL = strings.TrimRight(g.BaseURL, "/")
+	g.checkPrivacyZones()
+	g.videoProcessor.SetStripMetadata(g.stripVideos())
+	g.configureRendering()
+	g.configureImageMetadata()
+	g.configureImageFormats()
 	
+	// Load the build manifest so unchanged photos and pages can be reused
+	if err := g.loadCache(); err != nil {
+		return err
+	}
+
 	if g.Verbose {
 		fmt.Printf("Scanning albums in %s\n", g.SourcePath)
 	}
 
 	// Find all albums
-	albums, err := ScanDirectory(g.SourcePath)
+	albums, err := ScanDirectory(g.SourcePath, g.OutputPath)
 	if err != nil {
 		return fmt.Errorf("failed to scan directory: %w", err)
 	}
@@ -97,23 +117,38 @@ func (g *Generator) Generate() error {
 	}
 
 	fmt.Printf("Found %d albums\n", len(albums))
+	warnMissingDecoders(albums)
+
+	// Remember every album in the source, hidden or not, so pages of
+	// albums that are no longer published can be pruned
+	scannedIDs := make([]string, len(albums))
+	for i := range albums {
+		scannedIDs[i] = albums[i].ID
+	}
 
 	// Report initial progress
 	if g.ProgressCallback != nil {
 		g.ProgressCallback(0, len(albums), "Starting album processing")
 	}
 
-	// Process each album and build filtered list
+	// Process each album and build filtered list. Albums arrive parents
+	// first, so hiding a parent can hide its whole subtree.
+	hiddenAlbums := make(map[string]bool)
+	noIndexAlbums := make(map[string]bool)
 	filteredAlbums := make([]Album, 0, len(albums))
 	for i := range albums {
 		album := &albums[i]
-		
-		// Apply album metadata (try relative path first, fall back to basename)
-		relPath, _ := filepath.Rel(g.SourcePath, album.Path)
-		albumMeta := g.metadata.GetAlbumMetadata(relPath)
-		if albumMeta == nil {
-			albumMeta = g.metadata.GetAlbumMetadata(album.ID)
+
+		if hiddenAlbums[album.ParentID] {
+			hiddenAlbums[album.ID] = true
+			continue
 		}
+
+		// Search engine opt-outs also cover nested albums
+		album.NoIndex = noIndexAlbums[album.ParentID]
+
+		// Apply album metadata, keyed by the album's relative path
+		albumMeta := g.metadata.GetAlbumMetadata(album.ID)
 		if albumMeta != nil {
 			if albumMeta.Title != "" {
 				album.Title = albumMeta.Title
@@ -122,14 +157,19 @@ func (g *Generator) Generate() error {
 				album.Description = template.HTML(albumMeta.Description)
 			}
 			if albumMeta.Hidden {
+				hiddenAlbums[album.ID] = true
 				continue // Skip hidden albums
 			}
+			album.Tags = albumMeta.Tags
+			album.NoIndex = album.NoIndex || albumMeta.NoIndex
 			album.CoverPhoto = albumMeta.CoverPhoto
 			if album.CoverPhoto != "" {
 				fmt.Printf("  Using cover photo: %s\n", album.CoverPhoto)
 			}
 		}
 		
+		noIndexAlbums[album.ID] = album.NoIndex
+
 		fmt.Printf("Processing %s\n", album.Title)
 		
 		// Report progress
@@ -150,21 +190,25 @@ func (g *Generator) Generate() error {
 			}
 		}
 		album.Photos = visiblePhotos
+		g.applyLocationPrivacy(album)
 		
-		// Only include albums with visible photos
-		if len(album.Photos) > 0 {
+		if albumMeta != nil {
+			album.SortPhotos(albumMeta.SortOrder, albumMeta.CustomOrder)
+		} else {
 			album.SortPhotosByDate()
-			album.SetCreatedAtFromPhotos()
-			filteredAlbums = append(filteredAlbums, *album)
 		}
+		applyStacks(album, g.metadata.Stacks)
+		album.SetCreatedAtFromPhotos()
+		filteredAlbums = append(filteredAlbums, *album)
 	}
-	albums = filteredAlbums
+	albums = pruneEmptyAlbums(filteredAlbums)
 
 	// Sort albums by original photo dates (newest first), then apply custom order if set
 	SortAlbumsByDate(albums)
 	if len(g.metadata.AlbumOrder) > 0 {
 		SortAlbumsByCustomOrder(albums, g.metadata.AlbumOrder, g.SourcePath)
 	}
+	LinkAlbums(albums)
 
 	// Report HTML generation progress
 	if g.ProgressCallback != nil {
@@ -172,7 +216,7 @@ func (g *Generator) Generate() error {
 	}
 
 	// Generate HTML site using new template system
-	if err := g.GenerateHTMLFromTemplates(filteredAlbums); err != nil {
+	if err := g.GenerateHTMLFromTemplates(albums); err != nil {
 		return fmt.Errorf("failed to generate HTML site: %w", err)
 	}
 
@@ -181,24 +225,178 @@ func (g *Generator) Generate() error {
 		g.ProgressCallback(1, 1, "Gallery generation complete")
 	}
 
+	// Remove output left behind by deleted or hidden photos and albums
+	var pruneErr error
+	if !g.NoPrune {
+		var removed []string
+		removed, pruneErr = g.pruneOutput(albums, scannedIDs)
+		printPruneReport(removed, g.Verbose)
+	}
+
+	if err := g.cache.Save(g.OutputPath); err != nil {
+		log.Printf("Warning: failed to save build manifest: %v", err)
+	}
+
+	if pruneErr != nil {
+		return fmt.Errorf("failed to prune output: %w", pruneErr)
+	}
 	return nil
 }
 
+// loadCache reads the build manifest from the output directory. Cached photo
+// results are only trusted when the image settings match, and cached pages
+// only when the theme and generator version match.
+func (g *Generator) loadCache() error {
+	themeName := ""
+	if g.metadata != nil {
+		themeName = g.metadata.Theme
+	}
+	themeFS, err := NewThemeFS(themeName, g.SourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to load theme: %w", err)
+	}
+	themeHash, err := themeFingerprint(themeFS)
+	if err != nil {
+		return fmt.Errorf("failed to read theme: %w", err)
+	}
+
+	settings := g.imageProcessor.Settings()
+	if g.imageProcessor.EmbedsLocations() && g.metadata != nil {
+		// Embedded locations depend on the privacy settings too
+		settings += " locations=" + fingerprint(g.metadata.ShowLocations, g.metadata.PrivacyZones)
+	}
+	theme := fingerprint(themeName, themeHash, g.Version, g.CommitHash)
+	if g.NoCache {
+		g.cache = NewManifest(g.OutputPath, settings, theme)
+	} else {
+		g.cache = LoadManifest(g.OutputPath, settings, theme)
+	}
+
+	// Thumbnails on disk were made with other settings and must be redone
+	// even where they look newer than their source
+	g.imageProcessor.SetRegenerate(g.NoCache || g.cache.SettingsChanged())
+	return nil
+}
+
+// photoKey returns the manifest key for a photo: its source path relative to
+// the source root
+func (g *Generator) photoKey(photo *Photo) string {
+	rel, err := filepath.Rel(g.SourcePath, photo.Path)
+	if err != nil {
+		return filepath.ToSlash(photo.Path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// pruneEmptyAlbums drops albums with no visible photos unless a surviving
+// descendant needs them as a parent page. Parents inherit the newest
+// CreatedAt of their children when they have no photos of their own.
+func pruneEmptyAlbums(albums []Album) []Album {
+	keep := make(map[string]bool, len(albums))
+	byID := make(map[string]*Album, len(albums))
+	for i := range albums {
+		byID[albums[i].ID] = &albums[i]
+	}
+
+	for i := range albums {
+		if len(albums[i].Photos) == 0 {
+			continue
+		}
+		keep[albums[i].ID] = true
+		for parent := byID[albums[i].ParentID]; parent != nil; parent = byID[parent.ParentID] {
+			keep[parent.ID] = true
+			if len(parent.Photos) == 0 && albums[i].CreatedAt.After(parent.CreatedAt) {
+				parent.CreatedAt = albums[i].CreatedAt
+			}
+		}
+	}
+
+	kept := make([]Album, 0, len(albums))
+	for _, album := range albums {
+		if keep[album.ID] {
+			kept = append(kept, album)
+		}
+	}
+	return kept
+}
+
 func (g *Generator) processAlbum(album *Album) error {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	errors := make([]error, 0)
 	processedCount := 0
 
+	// Apply photo metadata and reuse cached results for unchanged photos.
+	// Only the remaining photos need their files read.
+	pending := make([]int, 0, len(album.Photos))
+	for i := range album.Photos {
+		photo := &album.Photos[i]
+
+		photoPath := filepath.Join(album.Path, photo.Filename)
+		photoMeta := g.metadata.GetPhotoMetadata(photoPath)
+		if photoMeta != nil {
+			if photoMeta.Title != "" {
+				photo.Title = photoMeta.Title
+			}
+			if photoMeta.Description != "" {
+				photo.Description = photoMeta.Description
+			}
+			photo.SortIndex = photoMeta.SortIndex
+			photo.Tags = photoMeta.Tags
+			if fp := photoMeta.FocalPoint; fp != nil {
+				photo.focalPoint = &image.FocalPoint{X: fp.X, Y: fp.Y}
+			}
+			photo.edit = PhotoEdit(photoMeta)
+			if photoMeta.Hidden {
+				// Mark photo for removal
+				photo.Path = ""
+				continue
+			}
+		}
+		if photo.IsVideo {
+			photo.stripped = g.stripVideos()
+		} else {
+			adjustments, err := PhotoAdjustments(g.metadata, album.ID, photoMeta)
+			if err != nil {
+				log.Printf("Warning: %s: %v", photo.Filename, err)
+			}
+			photo.adjustments = adjustments
+		}
+
+		photo.cardCrop = g.cardCrop
+
+		key := g.photoKey(photo)
+		entry, fresh, changed := g.cache.Photo(key, photo.Path)
+		if fresh && entry.Options == renderOptions(photo) && entry.outputsExist(g.OutputPath) {
+			entry.apply(photo)
+			g.cache.KeepPhoto(key)
+			continue
+		}
+		if changed || (fresh && entry.Options != renderOptions(photo)) {
+			// The source was replaced or is to be rendered differently; its
+			// old renditions may look newer than the source, so remove them
+			// to force regeneration
+			entry.removeOutputs(g.OutputPath)
+		}
+		pending = append(pending, i)
+	}
+
+	if len(pending) == 0 {
+		if g.Verbose {
+			fmt.Printf("  %s unchanged, skipped\n", album.Title)
+		}
+		return nil
+	}
+
 	// Report photo processing start
 	if g.ProgressCallback != nil {
-		g.ProgressCallback(0, len(album.Photos), fmt.Sprintf("Processing photos in %s", album.Title))
+		g.ProgressCallback(0, len(pending), fmt.Sprintf("Processing photos in %s", album.Title))
 	}
 
 	// Limit concurrent processing
 	sem := make(chan struct{}, 4)
 
-	for i := range album.Photos {
+	for _, i := range pending {
 		wg.Add(1)
 		sem <- struct{}{}
 
@@ -207,22 +405,6 @@ func (g *Generator) processAlbum(album *Album) error {
 			defer func() { <-sem }()
 
 			photo := &album.Photos[idx]
-			
-			// Apply photo metadata
-			photoPath := filepath.Join(album.Path, photo.Filename)
-			if photoMeta := g.metadata.GetPhotoMetadata(photoPath); photoMeta != nil {
-				if photoMeta.Title != "" {
-					photo.Title = photoMeta.Title
-				}
-				if photoMeta.Description != "" {
-					photo.Description = photoMeta.Description
-				}
-				if photoMeta.Hidden {
-					// Mark photo for removal
-					photo.Path = ""
-					return
-				}
-			}
 
 			if photo.IsVideo {
 				// Handle video processing
@@ -238,14 +420,22 @@ func (g *Generator) processAlbum(album *Album) error {
 						"poster": posterPath,
 					}
 					
-					// Copy video to static directory
-					if videoPath, err := g.videoProcessor.CopyVideoToStatic(photo.Path, album.ID, photo.ID); err == nil {
-						photo.VideoPath = videoPath
+					// Copy video to static directory. A video whose location
+					// can't be removed is left out rather than published with it.
+					videoPath, err := g.videoProcessor.CopyVideoToStatic(photo.Path, album.ID, photo.ID)
+					if err != nil {
+						mu.Lock()
+						errors = append(errors, fmt.Errorf("video %s: %v", photo.Filename, err))
+						photo.Path = ""
+						mu.Unlock()
+						return
 					}
+					photo.VideoPath = videoPath
 				} else {
 					// If thumbnail extraction fails, skip this video
 					mu.Lock()
 					errors = append(errors, fmt.Errorf("video %s: %v", photo.Filename, err))
+					photo.Path = ""
 					mu.Unlock()
 					return
 				}
@@ -253,8 +443,7 @@ func (g *Generator) processAlbum(album *Album) error {
 				// Handle image processing
 				// Get image dimensions
 				if width, height, err := image.GetImageDimensions(photo.Path); err == nil {
-					photo.Width = width
-					photo.Height = height
+					photo.Width, photo.Height = photo.edit.Dimensions(width, height)
 				}
 
 				// Extract EXIF data
@@ -263,21 +452,40 @@ func (g *Generator) processAlbum(album *Album) error {
 				}
 
 				// Generate thumbnails
-				thumbs, err := g.imageProcessor.ProcessImage(photo.Path, album.ID, photo.ID)
+				renditions, err := g.imageProcessor.ProcessImage(photo.Path, album.ID, photo.ID, g.photoOptions(photo))
 				if err != nil {
 					mu.Lock()
-					errors = append(errors, err)
+					errors = append(errors, fmt.Errorf("%s: %v", photo.Filename, err))
+					photo.Path = ""
 					mu.Unlock()
 					return
 				}
-				photo.Thumbnails = thumbs
+				photo.Thumbnails = image.Thumbnails(renditions)
+
+				// Animated GIFs also get moving renditions; the stills
+				// of their first frame remain as posters. Edits and
+				// adjustments only apply to stills, so an edited GIF
+				// stays still rather than move unedited.
+				if image.IsAnimated(photo.Path) && photo.edit.IsZero() && photo.adjustments.IsZero() {
+					animations, err := g.imageProcessor.ProcessAnimation(photo.Path, album.ID, photo.ID)
+					if err != nil {
+						log.Printf("Warning: %s will not move: %v", photo.Filename, err)
+					}
+					renditions = append(renditions, animations...)
+				}
+				photo.Renditions = renditions
 			}
-			
+			g.setPlaceholder(photo)
+
+			if err := g.cache.SetPhoto(g.photoKey(photo), photo.Path, newCachedPhoto(photo)); err != nil && g.Verbose {
+				fmt.Printf("  ! could not cache %s: %v\n", photo.Filename, err)
+			}
+
 			// Report progress
 			mu.Lock()
 			processedCount++
 			if g.ProgressCallback != nil {
-				g.ProgressCallback(processedCount, len(album.Photos), 
+				g.ProgressCallback(processedCount, len(pending), 
 					fmt.Sprintf("Processing %s: %s", album.Title, photo.Filename))
 			}
 			mu.Unlock()
@@ -290,10 +498,33 @@ func (g *Generator) processAlbum(album *Album) error {
 
 	wg.Wait()
 
+	// Photos that failed are left out rather than taking the album with them
+	for _, err := range errors {
+		log.Printf("Warning: skipping %s", err)
+	}
 	if len(errors) > 0 {
-		return fmt.Errorf("encountered %d errors processing photos", len(errors))
+		log.Printf("Warning: left %d of %d photos out of %s", len(errors), len(album.Photos), album.Title)
 	}
 
 	return nil
 }
 
+// warnMissingDecoders warns once when the albums hold HEIC/HEIF photos but no
+// decoder for them is installed
+func warnMissingDecoders(albums []Album) {
+	if image.HEIFDecoder() != "" {
+		return
+	}
+	count := 0
+	for _, album := range albums {
+		for _, photo := range album.Photos {
+			if heif.IsHEIF(photo.Path) {
+				count++
+			}
+		}
+	}
+	if count > 0 {
+		log.Printf("Warning: %d HEIC/HEIF photos found but neither heif-convert (libheif) nor ffmpeg is installed; they will be skipped", count)
+	}
+}
+
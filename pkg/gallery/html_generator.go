@@ -7,7 +7,9 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
 // GalleryData represents gallery data for templates
@@ -17,6 +19,8 @@ type GalleryData struct {
 	Author      string
 	Copyright   string
 	Albums      []Album
+	Map         bool // whether the gallery has a /map/ page
+	Archive     bool // whether the gallery has /archive/ pages
 }
 
 // HTMLTemplateData represents the data passed to HTML templates
@@ -27,10 +31,26 @@ type HTMLTemplateData struct {
 	Content     template.HTML
 	Gallery     *GalleryData
 	Album       *Album
+	Breadcrumbs []Breadcrumb
+	Tags        []*Tag // every tag in the gallery, sorted by name
+	Tag         *Tag   // the tag being rendered on a tag page
+	Photo       *Photo // the photo being rendered on a photo page
+	Archive     *ArchivePage
+	PrevPhoto   *Photo
+	NextPhoto   *Photo
+	Social      *SocialMeta // Open Graph and Twitter Card values, nil if the page has none
+	Feeds       bool        // whether the site publishes feed.xml, rss.xml and feed.json
+	NoIndex     bool        // ask search engines not to index the page
+	JSONLD      template.JS // schema.org JSON-LD describing the page, empty if it has none
 	Version     string
 	CommitHash  string
 }
 
+// templateFuncs are the helper functions available to theme templates
+var templateFuncs = template.FuncMap{
+	"tagSlug": TagSlug,
+}
+
 // GenerateHTMLFromTemplates generates the gallery HTML using the embedded templates
 func (g *Generator) GenerateHTMLFromTemplates(albums []Album) error {
 	// Resolve theme
@@ -50,7 +70,7 @@ func (g *Generator) GenerateHTMLFromTemplates(albums []Album) error {
 	}
 
 	// Parse all templates
-	tmpl, err := template.ParseFS(templateFS, "*.html")
+	tmpl, err := template.New("").Funcs(templateFuncs).ParseFS(templateFS, "*.html")
 	if err != nil {
 		return fmt.Errorf("failed to parse templates: %w", err)
 	}
@@ -64,7 +84,7 @@ func (g *Generator) GenerateHTMLFromTemplates(albums []Album) error {
 	galleryData := &GalleryData{
 		Title:       g.SiteTitle,
 		Description: "",
-		Albums:      albums,
+		Albums:      TopLevelAlbums(albums),
 	}
 
 	// Use metadata if available
@@ -77,21 +97,97 @@ func (g *Generator) GenerateHTMLFromTemplates(albums []Album) error {
 		galleryData.Copyright = g.metadata.Copyright
 	}
 
+	assignPhotoPages(albums)
+	tags := CollectTags(albums)
+	points := g.mapPoints(albums)
+	galleryData.Map = len(points) > 0
+	years := CollectArchive(albums)
+	galleryData.Archive = len(years) > 0
+
+	// Albums can't take the place of the pages this build writes
+	reserved := []string{"css", "js", "search", "static"}
+	if len(years) > 0 {
+		reserved = append(reserved, "archive")
+	}
+	if len(points) > 0 {
+		reserved = append(reserved, "map")
+	}
+	if len(tags) > 0 {
+		reserved = append(reserved, "tags")
+	}
+	if err := checkReservedIDs(albums, reserved); err != nil {
+		return err
+	}
+
 	// Generate index page
-	if err := g.generateIndexPage(tmpl, galleryData); err != nil {
+	if err := g.generateIndexPage(tmpl, galleryData, tags); err != nil {
 		return fmt.Errorf("failed to generate index page: %w", err)
 	}
 
 	// Generate album pages
+	byID := make(map[string]*Album, len(albums))
+	for i := range albums {
+		byID[albums[i].ID] = &albums[i]
+	}
 	for i := range albums {
-		if err := g.generateAlbumPage(tmpl, &albums[i], galleryData); err != nil {
+		breadcrumbs := albumBreadcrumbs(&albums[i], byID, galleryData.Title)
+		if err := g.generateAlbumPage(tmpl, &albums[i], galleryData, breadcrumbs); err != nil {
 			return fmt.Errorf("failed to generate album page for %s: %w", albums[i].ID, err)
 		}
+		if err := g.generatePhotoPages(tmpl, &albums[i], galleryData, breadcrumbs); err != nil {
+			return fmt.Errorf("failed to generate photo pages for %s: %w", albums[i].ID, err)
+		}
+	}
+
+	// Generate feeds of new albums
+	if err := g.generateFeeds(albums, galleryData); err != nil {
+		return fmt.Errorf("failed to generate feeds: %w", err)
+	}
+
+	// Generate the date archive
+	if err := g.generateArchivePages(tmpl, years, galleryData); err != nil {
+		return fmt.Errorf("failed to generate archive pages: %w", err)
+	}
+
+	// Generate the gallery map
+	if err := g.generateMapPage(tmpl, points, galleryData); err != nil {
+		return fmt.Errorf("failed to generate map page: %w", err)
+	}
+
+	// Generate the search index and search page
+	if err := g.generateSearch(tmpl, albums, galleryData); err != nil {
+		return fmt.Errorf("failed to generate search index: %w", err)
+	}
+
+	// Generate sitemap.xml and robots.txt
+	if err := g.generateSitemap(albums, tags); err != nil {
+		return fmt.Errorf("failed to generate sitemap: %w", err)
+	}
+
+	// Generate tag pages
+	if len(tags) > 0 {
+		if err := g.generateTagPages(tmpl, tags, galleryData); err != nil {
+			return fmt.Errorf("failed to generate tag pages: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// pageData returns the base.html data shared by every page
+func (g *Generator) pageData(title, description, basePath string, content template.HTML) HTMLTemplateData {
+	return HTMLTemplateData{
+		Title:       title,
+		Description: description,
+		BasePath:    basePath,
+		Content:     content,
+		Feeds:       g.feedsEnabled(),
+		NoIndex:     g.robotsPolicy().NoIndex,
+		Version:     g.Version,
+		CommitHash:  g.CommitHash,
+	}
+}
+
 // copyThemeAssets copies CSS and JS files from the theme to the output directory
 func (g *Generator) copyThemeAssets(themeFS *ThemeFS) error {
 	staticFS, err := themeFS.GetStaticFS()
@@ -136,70 +232,108 @@ func (g *Generator) copyThemeAssets(themeFS *ThemeFS) error {
 }
 
 // generateIndexPage generates the gallery index page
-func (g *Generator) generateIndexPage(tmpl *template.Template, galleryData *GalleryData) error {
+func (g *Generator) generateIndexPage(tmpl *template.Template, galleryData *GalleryData, tags []*Tag) error {
 
 	// Render the index content
 	var contentBuf bytes.Buffer
 	if err := tmpl.ExecuteTemplate(&contentBuf, "index.html", HTMLTemplateData{
-		Gallery: galleryData,
+		BasePath: ".",
+		Gallery:  galleryData,
+		Tags:     tags,
 	}); err != nil {
 		return fmt.Errorf("failed to render index content: %w", err)
 	}
 
 	// Render the full page
 	var pageBuf bytes.Buffer
-	if err := tmpl.ExecuteTemplate(&pageBuf, "base.html", HTMLTemplateData{
-		Title:       galleryData.Title,
-		Description: galleryData.Description,
-		BasePath:    ".",
-		Content:     template.HTML(contentBuf.String()),
-		Version:     g.Version,
-		CommitHash:  g.CommitHash,
-	}); err != nil {
+	pageData := g.pageData(galleryData.Title, galleryData.Description, ".", template.HTML(contentBuf.String()))
+	pageData.JSONLD = g.indexStructuredData(galleryData, ".")
+	if err := tmpl.ExecuteTemplate(&pageBuf, "base.html", pageData); err != nil {
 		return fmt.Errorf("failed to render index page: %w", err)
 	}
 
 	// Write to file
 	indexPath := filepath.Join(g.OutputPath, "index.html")
-	return os.WriteFile(indexPath, pageBuf.Bytes(), 0644)
+	if err := os.WriteFile(indexPath, pageBuf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if g.cache != nil {
+		g.cache.SetPage("index.html", "")
+	}
+	return nil
+}
+
+// albumBasePath returns the relative path from an album page back to the site root
+func albumBasePath(album *Album) string {
+	return strings.TrimSuffix(strings.Repeat("../", album.Depth()), "/")
+}
+
+// albumBreadcrumbs builds the trail from the gallery index down to the album.
+// URLs are relative to the album page; the current album has no URL.
+func albumBreadcrumbs(album *Album, byID map[string]*Album, galleryTitle string) []Breadcrumb {
+	basePath := albumBasePath(album)
+	var trail []Breadcrumb
+	for a := byID[album.ParentID]; a != nil; a = byID[a.ParentID] {
+		trail = append([]Breadcrumb{{Title: a.Title, URL: basePath + "/" + a.ID + "/"}}, trail...)
+	}
+	trail = append([]Breadcrumb{{Title: galleryTitle, URL: basePath + "/"}}, trail...)
+	return append(trail, Breadcrumb{Title: album.Title})
 }
 
 // generateAlbumPage generates a single album page
-func (g *Generator) generateAlbumPage(tmpl *template.Template, album *Album, galleryData *GalleryData) error {
+func (g *Generator) generateAlbumPage(tmpl *template.Template, album *Album, galleryData *GalleryData, breadcrumbs []Breadcrumb) error {
 	// Create album directory
-	albumDir := filepath.Join(g.OutputPath, album.ID)
+	albumDir := filepath.Join(g.OutputPath, filepath.FromSlash(album.ID))
 	if err := os.MkdirAll(albumDir, 0755); err != nil {
 		return err
 	}
 
+	basePath := albumBasePath(album)
+	title := fmt.Sprintf("%s - %s", album.Title, g.SiteTitle)
+	// Use metadata title if available
+	if g.metadata != nil && g.metadata.Title != "" {
+		title = fmt.Sprintf("%s - %s", album.Title, g.metadata.Title)
+	}
+
+	// Skip rendering when nothing the page shows has changed. The album list
+	// is left out of the gallery data since album pages only show the
+	// album's own subtree.
+	galleryInfo := *galleryData
+	galleryInfo.Albums = nil
+	pageData := g.pageData(title, string(album.Description), basePath, "")
+	pageData.NoIndex = pageData.NoIndex || album.NoIndex
+	pageData.JSONLD = g.albumStructuredData(album, galleryData, basePath)
+	pageKey := path.Join(album.ID, "index.html")
+	pageHash := fingerprint(pageData, album, breadcrumbs, galleryInfo)
+	if g.cache != nil && g.cache.PageFresh(g.OutputPath, pageKey, pageHash) {
+		return nil
+	}
+
 	// Render the album content
 	var contentBuf bytes.Buffer
 	if err := tmpl.ExecuteTemplate(&contentBuf, "album.html", HTMLTemplateData{
-		Album:   album,
-		Gallery: galleryData,
+		BasePath:    basePath,
+		Album:       album,
+		Gallery:     galleryData,
+		Breadcrumbs: breadcrumbs,
 	}); err != nil {
 		return fmt.Errorf("failed to render album content: %w", err)
 	}
 
 	// Render the full page
 	var pageBuf bytes.Buffer
-	title := fmt.Sprintf("%s - %s", album.Title, g.SiteTitle)
-	// Use metadata title if available
-	if g.metadata != nil && g.metadata.Title != "" {
-		title = fmt.Sprintf("%s - %s", album.Title, g.metadata.Title)
-	}
-	if err := tmpl.ExecuteTemplate(&pageBuf, "base.html", HTMLTemplateData{
-		Title:       title,
-		Description: string(album.Description),
-		BasePath:    "..",
-		Content:     template.HTML(contentBuf.String()),
-		Version:     g.Version,
-		CommitHash:  g.CommitHash,
-	}); err != nil {
+	pageData.Content = template.HTML(contentBuf.String())
+	if err := tmpl.ExecuteTemplate(&pageBuf, "base.html", pageData); err != nil {
 		return fmt.Errorf("failed to render album page: %w", err)
 	}
 
 	// Write to file
 	albumIndexPath := filepath.Join(albumDir, "index.html")
-	return os.WriteFile(albumIndexPath, pageBuf.Bytes(), 0644)
+	if err := os.WriteFile(albumIndexPath, pageBuf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if g.cache != nil {
+		g.cache.SetPage(pageKey, pageHash)
+	}
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,87 @@
+package gallery
+
+import (
+	"log"
+
+	"github.com/cjs/purtypics/pkg/image"
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+// configureImageMetadata hands the gallery's image_metadata settings to the
+// image processor. Author and copyright come from the gallery metadata.
+func (g *Generator) configureImageMetadata() {
+	settings := &metadata.ImageMetadataSettings{}
+	if g.metadata != nil && g.metadata.ImageMetadata != nil {
+		settings = g.metadata.ImageMetadata
+	}
+
+	g.imageProcessor.SetMetadataPolicy("", g.metadataPolicy(settings.ImageMetadataPolicy))
+	for size, override := range settings.Sizes {
+		if !g.imageProcessor.HasSize(size) {
+			log.Printf("Warning: image_metadata has a policy for unknown size %q", size)
+			continue
+		}
+		if override == nil {
+			continue
+		}
+		g.imageProcessor.SetMetadataPolicy(size, g.metadataPolicy(mergePolicy(settings.ImageMetadataPolicy, *override)))
+	}
+}
+
+// mergePolicy returns base with every field set in override replaced
+func mergePolicy(base, override metadata.ImageMetadataPolicy) metadata.ImageMetadataPolicy {
+	if override.Color != "" {
+		base.Color = override.Color
+	}
+	if override.Copyright != nil {
+		base.Copyright = override.Copyright
+	}
+	if override.Camera != nil {
+		base.Camera = override.Camera
+	}
+	if override.SerialNumbers != nil {
+		base.SerialNumbers = override.SerialNumbers
+	}
+	if override.GPS != nil {
+		base.GPS = override.GPS
+	}
+	return base
+}
+
+// metadataPolicy fills in the defaults of a configured policy
+func (g *Generator) metadataPolicy(config metadata.ImageMetadataPolicy) image.MetadataPolicy {
+	policy := image.DefaultMetadataPolicy()
+
+	switch config.Color {
+	case "", metadata.ColorKeep:
+	case metadata.ColorSRGB:
+		policy.ConvertToSRGB = true
+	default:
+		log.Printf("Warning: unknown image_metadata color %q, keeping ICC profiles", config.Color)
+	}
+
+	if (config.Copyright == nil || *config.Copyright) && g.metadata != nil {
+		policy.Artist = g.metadata.Author
+		policy.Copyright = g.metadata.Copyright
+	}
+	if config.Camera != nil {
+		policy.Camera = *config.Camera
+	}
+	if config.SerialNumbers != nil {
+		policy.SerialNumbers = *config.SerialNumbers
+	}
+	if config.GPS != nil {
+		policy.GPS = *config.GPS
+	}
+	return policy
+}
+
+// photoOptions returns the per-photo input for the image processor. Only the
+// location that may be published is handed over.
+func (g *Generator) photoOptions(photo *Photo) image.PhotoOptions {
+	opts := image.PhotoOptions{FocalPoint: photo.focalPoint, Edit: photo.edit, Adjustments: photo.adjustments}
+	if photo.EXIF != nil {
+		opts.Location = g.publishedLocation(photo.EXIF.GPS)
+	}
+	return opts
+}
@@ -0,0 +1,94 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+)
+
+// mapPoint is one geotagged photo on the gallery map
+type mapPoint struct {
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	Title    string  `json:"title"`
+	Album    string  `json:"album"`
+	AlbumURL string  `json:"albumUrl"`
+	URL      string  `json:"url,omitempty"` // photo page, empty if the photo has none
+	Thumb    string  `json:"thumb,omitempty"`
+}
+
+// mapPoints collects every geotagged photo in the published albums. Photo
+// locations are only published when the gallery enables show_locations.
+func (g *Generator) mapPoints(albums []Album) []mapPoint {
+	if !g.showLocations() {
+		return nil
+	}
+
+	var points []mapPoint
+	for i := range albums {
+		album := &albums[i]
+		for j := range album.Photos {
+			photo := &album.Photos[j]
+			if photo.EXIF == nil || photo.EXIF.GPS == nil {
+				continue
+			}
+			points = append(points, mapPoint{
+				Lat:      photo.EXIF.GPS.Latitude,
+				Lng:      photo.EXIF.GPS.Longitude,
+				Title:    photo.DisplayTitle(),
+				Album:    album.Title,
+				AlbumURL: "/" + album.ID + "/",
+				URL:      photo.PagePath,
+				Thumb:    photo.Rendition("small", "medium", "poster"),
+			})
+		}
+	}
+	return points
+}
+
+// generateMapPage writes the gallery map at /map/ along with the photo
+// locations it plots. Nothing is written when no photo has a location.
+func (g *Generator) generateMapPage(tmpl *template.Template, points []mapPoint, galleryData *GalleryData) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	mapDir := filepath.Join(g.OutputPath, "map")
+	if err := os.MkdirAll(mapDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(points)
+	if err != nil {
+		return fmt.Errorf("failed to build map data: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(mapDir, "photos.json"), data, 0644); err != nil {
+		return err
+	}
+
+	var contentBuf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&contentBuf, "map.html", HTMLTemplateData{
+		BasePath: "..",
+		Gallery:  galleryData,
+	}); err != nil {
+		return fmt.Errorf("failed to render map content: %w", err)
+	}
+
+	var pageBuf bytes.Buffer
+	pageData := g.pageData(fmt.Sprintf("Map - %s", galleryData.Title), galleryData.Description, "..", template.HTML(contentBuf.String()))
+	if err := tmpl.ExecuteTemplate(&pageBuf, "base.html", pageData); err != nil {
+		return fmt.Errorf("failed to render map page: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(mapDir, "index.html"), pageBuf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	if g.cache != nil {
+		g.cache.SetPage("map/photos.json", "")
+		g.cache.SetPage("map/index.html", "")
+	}
+	return nil
+}
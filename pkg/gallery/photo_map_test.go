@@ -0,0 +1,41 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+func TestMapPoints(t *testing.T) {
+	albums := []Album{{ID: "trip", Title: "Trip", Photos: []Photo{
+		{ID: "beach", Title: "Beach", PagePath: "/trip/beach/", EXIF: &exif.EXIFData{GPS: &exif.GPSData{Latitude: 45.5, Longitude: -122.6}}},
+		{ID: "indoors", EXIF: &exif.EXIFData{}},
+		{ID: "scan"},
+	}}}
+
+	// Without show_locations there is nothing to plot and no map is written
+	out := t.TempDir()
+	g := &Generator{OutputPath: out, metadata: &metadata.GalleryMetadata{}}
+	points := g.mapPoints(albums)
+	if len(points) != 0 {
+		t.Errorf("points with show_locations off = %+v", points)
+	}
+	if err := g.generateMapPage(nil, points, &GalleryData{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "map", "photos.json")); err == nil {
+		t.Error("photos.json written with show_locations off")
+	}
+
+	g.metadata.ShowLocations = true
+	points = g.mapPoints(albums)
+	if len(points) != 1 {
+		t.Fatalf("points = %+v, want only the geotagged photo", points)
+	}
+	if p := points[0]; p.Lat != 45.5 || p.Lng != -122.6 || p.Title != "Beach" || p.AlbumURL != "/trip/" || p.URL != "/trip/beach/" {
+		t.Errorf("point = %+v", p)
+	}
+}
@@ -0,0 +1,180 @@
+package gallery
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SocialMeta holds the Open Graph and Twitter Card values for a page. URL
+// and Image are absolute and left empty when the gallery has no base URL.
+type SocialMeta struct {
+	Type        string // og:type
+	SiteName    string
+	Title       string
+	Description string
+	URL         string
+	Image       string
+	ImageAlt    string
+}
+
+// Rendition returns the first of the named thumbnails that exists, or an
+// empty string when none do
+func (p *Photo) Rendition(names ...string) string {
+	for _, name := range names {
+		if thumb := p.Thumbnails[name]; thumb != "" {
+			return thumb
+		}
+	}
+	return ""
+}
+
+// DisplayTitle returns the photo's title, falling back to its filename
+func (p *Photo) DisplayTitle() string {
+	if p.Title != "" {
+		return p.Title
+	}
+	return p.Filename
+}
+
+// assignPhotoPages sets the permalink page path of every photo to
+// /<album>/<photo-id>/. Photos whose ID clashes with a nested album or an
+// earlier photo in the same album get no page.
+func assignPhotoPages(albums []Album) {
+	for i := range albums {
+		album := &albums[i]
+		taken := make(map[string]bool, len(album.Children)+len(album.Photos))
+		for _, child := range album.Children {
+			taken[path.Base(child.ID)] = true
+		}
+		for j := range album.Photos {
+			photo := &album.Photos[j]
+			if taken[photo.ID] {
+				log.Printf("Warning: %s/%s has the same name as another photo or album, skipping its page", album.ID, photo.Filename)
+				photo.PagePath = ""
+				continue
+			}
+			taken[photo.ID] = true
+			photo.PagePath = "/" + album.ID + "/" + photo.ID + "/"
+		}
+	}
+}
+
+// absoluteURL joins the base URL with a site path, escaping each segment
+func absoluteURL(baseURL, sitePath string) string {
+	if baseURL == "" {
+		return ""
+	}
+	return strings.TrimRight(baseURL, "/") + (&url.URL{Path: sitePath}).EscapedPath()
+}
+
+// photoSocialMeta builds the social preview values for a photo page
+func (g *Generator) photoSocialMeta(photo *Photo, album *Album, galleryData *GalleryData) *SocialMeta {
+	description := photo.Description
+	if description == "" {
+		description = fmt.Sprintf("From %s", album.Title)
+	}
+	meta := &SocialMeta{
+		Type:        "article",
+		SiteName:    galleryData.Title,
+		Title:       photo.DisplayTitle(),
+		Description: description,
+		ImageAlt:    photo.DisplayTitle(),
+	}
+	if g.BaseURL != "" {
+		meta.URL = absoluteURL(g.BaseURL, photo.PagePath)
+		if image := photo.Rendition("large", "full", "medium", "poster", "small"); image != "" {
+			meta.Image = absoluteURL(g.BaseURL, image)
+		}
+	}
+	return meta
+}
+
+// generatePhotoPages writes a permalink page for every photo in the album
+func (g *Generator) generatePhotoPages(tmpl *template.Template, album *Album, galleryData *GalleryData, albumCrumbs []Breadcrumb) error {
+	basePath := "../" + albumBasePath(album)
+
+	// Photo pages sit one level below the album, so every crumb URL needs
+	// one more step up and the album itself becomes a link
+	crumbs := make([]Breadcrumb, 0, len(albumCrumbs)+1)
+	for _, crumb := range albumCrumbs[:len(albumCrumbs)-1] {
+		crumbs = append(crumbs, Breadcrumb{Title: crumb.Title, URL: "../" + crumb.URL})
+	}
+	crumbs = append(crumbs, Breadcrumb{Title: album.Title, URL: "../"})
+
+	galleryInfo := *galleryData
+	galleryInfo.Albums = nil
+
+	for i := range album.Photos {
+		photo := &album.Photos[i]
+		if photo.PagePath == "" {
+			continue
+		}
+
+		var prev, next *Photo
+		for j := i - 1; j >= 0 && prev == nil; j-- {
+			if album.Photos[j].PagePath != "" {
+				prev = &album.Photos[j]
+			}
+		}
+		for j := i + 1; j < len(album.Photos) && next == nil; j++ {
+			if album.Photos[j].PagePath != "" {
+				next = &album.Photos[j]
+			}
+		}
+
+		breadcrumbs := append(crumbs[:len(crumbs):len(crumbs)], Breadcrumb{Title: photo.DisplayTitle()})
+		title := fmt.Sprintf("%s - %s", photo.DisplayTitle(), galleryData.Title)
+		social := g.photoSocialMeta(photo, album, galleryData)
+
+		pageKey := strings.TrimPrefix(photo.PagePath, "/") + "index.html"
+		pageData := g.pageData(title, social.Description, basePath, "")
+		pageData.Social = social
+		pageData.NoIndex = pageData.NoIndex || album.NoIndex
+		pageData.JSONLD = g.photoStructuredData(photo, galleryData, basePath)
+		pageHash := fingerprint(pageData, photo, prev, next, breadcrumbs, galleryInfo)
+		if g.cache != nil && g.cache.PageFresh(g.OutputPath, pageKey, pageHash) {
+			continue
+		}
+
+		// Render the photo content
+		var contentBuf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&contentBuf, "photo.html", HTMLTemplateData{
+			BasePath:    basePath,
+			Gallery:     galleryData,
+			Album:       album,
+			Photo:       photo,
+			PrevPhoto:   prev,
+			NextPhoto:   next,
+			Breadcrumbs: breadcrumbs,
+		}); err != nil {
+			return fmt.Errorf("failed to render photo %s content: %w", photo.Filename, err)
+		}
+
+		// Render the full page
+		var pageBuf bytes.Buffer
+		pageData.Content = template.HTML(contentBuf.String())
+		if err := tmpl.ExecuteTemplate(&pageBuf, "base.html", pageData); err != nil {
+			return fmt.Errorf("failed to render photo %s page: %w", photo.Filename, err)
+		}
+
+		pagePath := filepath.Join(g.OutputPath, filepath.FromSlash(pageKey))
+		if err := os.MkdirAll(filepath.Dir(pagePath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(pagePath, pageBuf.Bytes(), 0644); err != nil {
+			return err
+		}
+		if g.cache != nil {
+			g.cache.SetPage(pageKey, pageHash)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package gallery
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/cjs/purtypics/pkg/image"
+)
+
+// PictureSource is one <source> of a <picture> element
+type PictureSource struct {
+	Type   string // MIME type, e.g. image/avif
+	SrcSet string
+}
+
+// Picture is what a theme needs to render a responsive <picture>: one
+// source per modern format, best first, and a JPEG <img> fallback. URLs are
+// already prefixed with the page's base path.
+type Picture struct {
+	Sources []PictureSource
+	Src     string // JPEG for browsers without srcset support
+	SrcSet  string // every JPEG rendition
+	Sizes   string // the sizes attribute, which depends on the layout
+	Width   int    // dimensions of Src, so browsers reserve space before it loads
+	Height  int
+	Alt     string
+}
+
+// pictureFormats orders the formats offered in <source> elements, best first
+var pictureFormats = []string{image.FormatAVIF, image.FormatWebP}
+
+// configureImageFormats enables the image_formats the gallery asks for,
+// warning about those no installed encoder can write
+func (g *Generator) configureImageFormats() {
+	if g.metadata == nil || len(g.metadata.ImageFormats) == 0 {
+		return
+	}
+	for _, format := range g.metadata.ImageFormats {
+		switch strings.ToLower(format) {
+		case image.FormatJPEG, image.FormatWebP, image.FormatAVIF:
+		default:
+			log.Printf("Warning: unknown image format %q in image_formats", format)
+		}
+	}
+	for _, format := range g.imageProcessor.SetFormats(g.metadata.ImageFormats) {
+		switch format {
+		case image.FormatWebP:
+			log.Printf("Warning: no WebP encoder found (install cwebp, or ffmpeg with libwebp), writing JPEG only")
+		case image.FormatAVIF:
+			log.Printf("Warning: no AVIF encoder found (install avifenc, or ffmpeg with libaom), skipping AVIF")
+		}
+	}
+}
+
+// Picture returns the responsive image data for the photo's full-frame
+// renditions, or nil when it has none, as for videos. Src is the first of
+// the preferred sizes that exists.
+func (p *Photo) Picture(basePath, sizes string, preferred ...string) *Picture {
+	return p.picture(basePath, "", sizes, preferred)
+}
+
+// CroppedPicture is Picture for the renditions of one of the gallery's
+// crops, such as "square" or "4:3", or nil if the crop wasn't generated
+func (p *Photo) CroppedPicture(basePath, crop, sizes string, preferred ...string) *Picture {
+	if crop == "" {
+		return nil
+	}
+	return p.picture(basePath, crop, sizes, preferred)
+}
+
+// CardPicture is the picture for album grids and covers: the gallery's
+// card_crop when it sets one, the full frame otherwise
+func (p *Photo) CardPicture(basePath, sizes string, preferred ...string) *Picture {
+	if pic := p.CroppedPicture(basePath, p.cardCrop, sizes, preferred...); pic != nil {
+		return pic
+	}
+	return p.Picture(basePath, sizes, preferred...)
+}
+
+func (p *Photo) picture(basePath, crop, sizes string, preferred []string) *Picture {
+	byFormat := make(map[string][]image.Rendition)
+	for _, r := range p.Renditions {
+		if r.Crop == crop {
+			byFormat[r.Format] = append(byFormat[r.Format], r)
+		}
+	}
+	jpegs := byFormat[image.FormatJPEG]
+	if len(jpegs) == 0 {
+		return nil
+	}
+
+	pic := &Picture{
+		SrcSet: srcSet(basePath, jpegs),
+		Sizes:  sizes,
+		Alt:    p.DisplayTitle(),
+	}
+	for _, format := range pictureFormats {
+		if renditions := byFormat[format]; len(renditions) > 0 {
+			pic.Sources = append(pic.Sources, PictureSource{
+				Type:   image.FormatMIME(format),
+				SrcSet: srcSet(basePath, renditions),
+			})
+		}
+	}
+
+	src := jpegs[0]
+	for _, name := range preferred {
+		if i := indexOfSize(jpegs, name); i >= 0 {
+			src = jpegs[i]
+			break
+		}
+	}
+	pic.Src = basePath + src.Path
+	pic.Width = src.Width
+	pic.Height = src.Height
+	return pic
+}
+
+// srcSet builds a srcset value listing each rendition with its width,
+// smallest first
+func srcSet(basePath string, renditions []image.Rendition) string {
+	sorted := append([]image.Rendition(nil), renditions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Width < sorted[j].Width })
+
+	var entries []string
+	seen := make(map[int]bool)
+	for _, r := range sorted {
+		if seen[r.Width] {
+			continue
+		}
+		seen[r.Width] = true
+		entries = append(entries, fmt.Sprintf("%s%s %dw", basePath, r.Path, r.Width))
+	}
+	return strings.Join(entries, ", ")
+}
+
+// indexOfSize returns the index of the rendition of the named size, or -1
+func indexOfSize(renditions []image.Rendition, size string) int {
+	for i, r := range renditions {
+		if r.Size == size {
+			return i
+		}
+	}
+	return -1
+}
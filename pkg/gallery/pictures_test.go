@@ -0,0 +1,69 @@
+package gallery
+
+import (
+	"testing"
+
+	"github.com/cjs/purtypics/pkg/image"
+)
+
+func TestPhotoPicture(t *testing.T) {
+	photo := &Photo{Filename: "sunset.jpg"}
+	if photo.Picture("..", "100vw", "medium") != nil {
+		t.Error("photo without renditions has a picture")
+	}
+
+	for _, size := range []struct {
+		name          string
+		width, height int
+	}{{"large", 1600, 1200}, {"small", 400, 300}, {"medium", 800, 600}} {
+		for _, format := range []string{image.FormatJPEG, image.FormatWebP} {
+			ext := map[string]string{image.FormatJPEG: ".jpg", image.FormatWebP: ".webp"}[format]
+			photo.Renditions = append(photo.Renditions, image.Rendition{
+				Size:   size.name,
+				Format: format,
+				Path:   "/static/thumbs/a/sunset_" + size.name + ext,
+				Width:  size.width,
+				Height: size.height,
+			})
+		}
+	}
+
+	pic := photo.Picture("..", "50vw", "medium", "small")
+	if pic.Src != "../static/thumbs/a/sunset_medium.jpg" || pic.Width != 800 || pic.Height != 600 {
+		t.Errorf("fallback = %s %dx%d", pic.Src, pic.Width, pic.Height)
+	}
+	if want := "../static/thumbs/a/sunset_small.jpg 400w, ../static/thumbs/a/sunset_medium.jpg 800w, ../static/thumbs/a/sunset_large.jpg 1600w"; pic.SrcSet != want {
+		t.Errorf("srcset = %q, want %q", pic.SrcSet, want)
+	}
+	if len(pic.Sources) != 1 || pic.Sources[0].Type != "image/webp" {
+		t.Fatalf("sources = %+v, want one WebP source", pic.Sources)
+	}
+	if want := "../static/thumbs/a/sunset_small.webp 400w, ../static/thumbs/a/sunset_medium.webp 800w, ../static/thumbs/a/sunset_large.webp 1600w"; pic.Sources[0].SrcSet != want {
+		t.Errorf("WebP srcset = %q, want %q", pic.Sources[0].SrcSet, want)
+	}
+	if pic.Alt != "sunset.jpg" || pic.Sizes != "50vw" {
+		t.Errorf("alt = %q, sizes = %q", pic.Alt, pic.Sizes)
+	}
+}
+
+func TestPhotoCardPicture(t *testing.T) {
+	photo := &Photo{Filename: "dunes.jpg", Renditions: []image.Rendition{
+		{Size: "small", Format: image.FormatJPEG, Path: "/static/thumbs/a/dunes_small.jpg", Width: 400, Height: 267},
+		{Size: "small", Format: image.FormatJPEG, Crop: "square", Path: "/static/thumbs/a/dunes_small_square.jpg", Width: 400, Height: 400},
+	}}
+
+	if pic := photo.CardPicture("", "25vw", "small"); pic.Src != "/static/thumbs/a/dunes_small.jpg" {
+		t.Errorf("card without card_crop = %s, want the full frame", pic.Src)
+	}
+	if pic := photo.Picture("", "25vw", "small"); pic.SrcSet != "/static/thumbs/a/dunes_small.jpg 400w" {
+		t.Errorf("picture srcset = %q, want the full frame only", pic.SrcSet)
+	}
+
+	photo.cardCrop = "square"
+	if pic := photo.CardPicture("", "25vw", "small"); pic.Src != "/static/thumbs/a/dunes_small_square.jpg" || pic.Height != 400 {
+		t.Errorf("card = %s %dx%d, want the square crop", pic.Src, pic.Width, pic.Height)
+	}
+	if photo.CroppedPicture("", "16:9", "25vw") != nil {
+		t.Error("picture for a crop that wasn't generated")
+	}
+}
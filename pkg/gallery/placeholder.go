@@ -0,0 +1,35 @@
+package gallery
+
+import (
+	"fmt"
+
+	"github.com/cjs/purtypics/pkg/image"
+)
+
+// setPlaceholder computes what pages show while the photo loads from its
+// smallest still, which is much quicker to read than the original
+func (g *Generator) setPlaceholder(photo *Photo) {
+	still := photo.Thumbnails["poster"]
+	if !photo.IsVideo {
+		still = ""
+		width := 0
+		for _, r := range photo.Renditions {
+			if r.Format == image.FormatJPEG && r.Crop == "" && (still == "" || r.Width < width) {
+				still, width = r.Path, r.Width
+			}
+		}
+	}
+	if still == "" {
+		return
+	}
+
+	placeholder, err := image.ReadPlaceholder(outputFile(g.OutputPath, still))
+	if err != nil {
+		if g.Verbose {
+			fmt.Printf("  ! no placeholder for %s: %v\n", photo.Filename, err)
+		}
+		return
+	}
+	photo.BlurHash = placeholder.BlurHash
+	photo.Color = placeholder.Color
+}
@@ -0,0 +1,112 @@
+package gallery
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+
+	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+// earthRadius is the mean radius of the Earth in meters
+const earthRadius = 6371000.0
+
+// applyLocationPrivacy removes or coarsens photo locations before anything
+// is rendered. Photos carry their own copy of the EXIF data, so the build
+// cache keeps the original coordinates.
+func (g *Generator) applyLocationPrivacy(album *Album) {
+	for i := range album.Photos {
+		photo := &album.Photos[i]
+		if photo.EXIF == nil || photo.EXIF.GPS == nil {
+			continue
+		}
+		photo.EXIF.GPS = g.publishedLocation(photo.EXIF.GPS)
+	}
+}
+
+// publishedLocation returns the location that may be published for a photo
+// taken at gps, or nil. Without show_locations every location is dropped;
+// otherwise locations inside a privacy zone are dropped or fuzzed as the
+// zone says.
+func (g *Generator) publishedLocation(gps *exif.GPSData) *exif.GPSData {
+	if gps == nil || !g.showLocations() {
+		return nil
+	}
+	for _, zone := range g.metadata.PrivacyZones {
+		if zone.Radius <= 0 || !zoneContains(zone, gps) {
+			continue
+		}
+		if zone.Action == metadata.PrivacyFuzz {
+			lat, lng := fuzzedLocation(zone)
+			return &exif.GPSData{Latitude: lat, Longitude: lng}
+		}
+		return nil
+	}
+	return gps
+}
+
+// stripVideos reports whether videos must be published without their
+// metadata. Their recording location can't be dropped or fuzzed by a privacy
+// zone, so it goes with the rest unless locations are shown and no zone is set.
+func (g *Generator) stripVideos() bool {
+	return !g.showLocations() || len(g.metadata.PrivacyZones) > 0
+}
+
+// checkPrivacyZones warns about zones that can never match
+func (g *Generator) checkPrivacyZones() {
+	if g.metadata == nil {
+		return
+	}
+	for i, zone := range g.metadata.PrivacyZones {
+		name := zone.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		switch {
+		case zone.Radius <= 0:
+			log.Printf("Warning: privacy zone %s has no radius and is ignored", name)
+		case zone.Action != "" && zone.Action != metadata.PrivacyDrop && zone.Action != metadata.PrivacyFuzz:
+			log.Printf("Warning: privacy zone %s has unknown action %q, dropping locations inside it", name, zone.Action)
+		}
+	}
+}
+
+// zoneContains reports whether a location lies inside the zone
+func zoneContains(zone metadata.PrivacyZone, gps *exif.GPSData) bool {
+	return distance(zone.Latitude, zone.Longitude, gps.Latitude, gps.Longitude) <= zone.Radius
+}
+
+// fuzzedLocation returns the point every location inside a fuzzing zone is
+// moved to. It lies between half and the full radius away from the zone's
+// center in a direction derived from the zone itself, so it is stable across
+// builds and never reveals the center.
+func fuzzedLocation(zone metadata.PrivacyZone) (lat, lng float64) {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%f|%f|%f", zone.Name, zone.Latitude, zone.Longitude, zone.Radius)
+	sum := h.Sum64()
+
+	bearing := float64(sum%3600) / 10 * math.Pi / 180
+	dist := zone.Radius * (0.5 + 0.5*float64((sum>>16)%1000)/1000)
+	return destination(zone.Latitude, zone.Longitude, bearing, dist)
+}
+
+// distance returns the great-circle distance in meters between two points
+func distance(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dPhi := phi2 - phi1
+	dLambda := (lng2 - lng1) * math.Pi / 180
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// destination returns the point dist meters from a start point along a
+// bearing given in radians
+func destination(lat, lng, bearing, dist float64) (float64, float64) {
+	phi1, lambda1 := lat*math.Pi/180, lng*math.Pi/180
+	delta := dist / earthRadius
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(bearing))
+	lambda2 := lambda1 + math.Atan2(math.Sin(bearing)*math.Sin(delta)*math.Cos(phi1), math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+	return phi2 * 180 / math.Pi, math.Mod(lambda2*180/math.Pi+540, 360) - 180
+}
@@ -0,0 +1,76 @@
+package gallery
+
+import (
+	"testing"
+
+	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+func TestApplyLocationPrivacy(t *testing.T) {
+	home := metadata.PrivacyZone{Name: "home", Latitude: 45.5200, Longitude: -122.6800, Radius: 500}
+	cabin := metadata.PrivacyZone{Name: "cabin", Latitude: 46.0000, Longitude: -121.0000, Radius: 1000, Action: metadata.PrivacyFuzz}
+
+	newAlbum := func() *Album {
+		return &Album{Photos: []Photo{
+			{ID: "home", EXIF: &exif.EXIFData{GPS: &exif.GPSData{Latitude: 45.5210, Longitude: -122.6805}}},
+			{ID: "cabin", EXIF: &exif.EXIFData{GPS: &exif.GPSData{Latitude: 46.0010, Longitude: -121.0010, Altitude: 900}}},
+			{ID: "away", EXIF: &exif.EXIFData{GPS: &exif.GPSData{Latitude: 48.8584, Longitude: 2.2945}}},
+		}}
+	}
+
+	// Locations are never published without show_locations
+	g := &Generator{metadata: &metadata.GalleryMetadata{PrivacyZones: []metadata.PrivacyZone{home, cabin}}}
+	album := newAlbum()
+	g.applyLocationPrivacy(album)
+	for _, p := range album.Photos {
+		if p.EXIF.GPS != nil {
+			t.Errorf("%s: location kept with show_locations off", p.ID)
+		}
+	}
+
+	g.metadata.ShowLocations = true
+	album = newAlbum()
+	g.applyLocationPrivacy(album)
+
+	if album.Photos[0].EXIF.GPS != nil {
+		t.Error("location inside a drop zone was kept")
+	}
+
+	fuzzed := album.Photos[1].EXIF.GPS
+	if fuzzed == nil {
+		t.Fatal("location inside a fuzz zone was dropped")
+	}
+	if fuzzed.Altitude != 0 {
+		t.Error("fuzzed location kept its altitude")
+	}
+	if d := distance(cabin.Latitude, cabin.Longitude, fuzzed.Latitude, fuzzed.Longitude); d < cabin.Radius/2-1 || d > cabin.Radius+1 {
+		t.Errorf("fuzzed location is %.0fm from the zone center, want %.0f-%.0fm", d, cabin.Radius/2, cabin.Radius)
+	}
+	if lat, lng := fuzzedLocation(cabin); lat != fuzzed.Latitude || lng != fuzzed.Longitude {
+		t.Error("fuzzed location is not stable")
+	}
+
+	if gps := album.Photos[2].EXIF.GPS; gps == nil || gps.Latitude != 48.8584 {
+		t.Error("location outside every zone was changed")
+	}
+}
+
+func TestStripVideos(t *testing.T) {
+	zone := metadata.PrivacyZone{Name: "home", Latitude: 45.52, Longitude: -122.68, Radius: 500}
+	for _, tc := range []struct {
+		show  bool
+		zones []metadata.PrivacyZone
+		want  bool
+	}{
+		{false, nil, true},
+		{true, nil, false},
+		// A video's location can't be checked against the zones
+		{true, []metadata.PrivacyZone{zone}, true},
+	} {
+		g := &Generator{metadata: &metadata.GalleryMetadata{ShowLocations: tc.show, PrivacyZones: tc.zones}}
+		if got := g.stripVideos(); got != tc.want {
+			t.Errorf("show_locations %v with %d zones: stripVideos = %v, want %v", tc.show, len(tc.zones), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package gallery
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pruneOutput removes files that earlier builds wrote but this build did not:
+// renditions of deleted or hidden photos, and pages of deleted or hidden
+// albums. scannedIDs lists every album found in the source, including the
+// hidden ones. It returns the removed paths relative to the output directory.
+func (g *Generator) pruneOutput(albums []Album, scannedIDs []string) ([]string, error) {
+	// Every rendition referenced by a published photo
+	live := make(map[string]bool)
+	for _, album := range albums {
+		for _, photo := range album.Photos {
+			for _, thumb := range photo.Thumbnails {
+				live[strings.TrimPrefix(thumb, "/")] = true
+			}
+			for _, r := range photo.Renditions {
+				live[strings.TrimPrefix(r.Path, "/")] = true
+			}
+			if photo.IsVideo && strings.HasPrefix(photo.VideoPath, "/static/") {
+				live[strings.TrimPrefix(photo.VideoPath, "/")] = true
+			}
+		}
+	}
+
+	var removed []string
+
+	// static/thumbs and static/videos belong to the generator, so anything
+	// not referenced by a published photo can go
+	for _, dir := range []string{"static/thumbs", "static/videos"} {
+		root := filepath.Join(g.OutputPath, filepath.FromSlash(dir))
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(g.OutputPath, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if live[rel] {
+				return nil
+			}
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+			removed = append(removed, rel)
+			return nil
+		})
+		if err != nil {
+			return removed, fmt.Errorf("pruning %s: %w", dir, err)
+		}
+		removeEmptyDirs(root)
+	}
+
+	// Pages from the previous build that were not written this time, and
+	// pages of albums that exist in the source but are no longer published
+	stalePages := g.cache.StalePages()
+	for _, id := range scannedIDs {
+		stalePages = append(stalePages, path.Join(id, "index.html"))
+	}
+	sort.Strings(stalePages)
+	for _, page := range stalePages {
+		if g.cache.PageWritten(page) {
+			continue
+		}
+		p := filepath.Join(g.OutputPath, filepath.FromSlash(page))
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			return removed, fmt.Errorf("pruning %s: %w", page, err)
+		}
+		removed = append(removed, page)
+		removeEmptyParents(filepath.Dir(p), g.OutputPath)
+	}
+
+	return removed, nil
+}
+
+// removeEmptyDirs deletes empty directories beneath root, deepest first.
+// root itself is kept.
+func removeEmptyDirs(root string) {
+	var dirs []string
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && p != root {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i]) // fails harmlessly on non-empty directories
+	}
+}
+
+// removeEmptyParents deletes dir and its ancestors while they are empty,
+// stopping at stop
+func removeEmptyParents(dir, stop string) {
+	prefix := filepath.Clean(stop) + string(filepath.Separator)
+	for dir = filepath.Clean(dir); strings.HasPrefix(dir, prefix); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+// printPruneReport summarises removed files by directory
+func printPruneReport(removed []string, verbose bool) {
+	if len(removed) == 0 {
+		return
+	}
+
+	counts := make(map[string]int)
+	var dirs []string
+	for _, rel := range removed {
+		dir := path.Dir(rel)
+		if counts[dir] == 0 {
+			dirs = append(dirs, dir)
+		}
+		counts[dir]++
+	}
+	sort.Strings(dirs)
+
+	fmt.Printf("Pruned %d stale files from the output:\n", len(removed))
+	if verbose {
+		for _, rel := range removed {
+			fmt.Printf("  - %s\n", rel)
+		}
+		return
+	}
+	for _, dir := range dirs {
+		fmt.Printf("  - %s/ (%d)\n", dir, counts[dir])
+	}
+}
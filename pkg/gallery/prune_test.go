@@ -0,0 +1,73 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPruneOutput(t *testing.T) {
+	out := t.TempDir()
+	files := []string{
+		"static/thumbs/trip/a_small.jpg",
+		"static/thumbs/trip/b_small.jpg",
+		"static/thumbs/gone/c_small.jpg",
+		"static/videos/trip/clip.mp4",
+		"trip/index.html",
+		"trip/b/index.html",
+		"hidden/index.html",
+		"about.html",
+	}
+	for _, f := range files {
+		p := filepath.Join(out, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The previous build wrote a page for b, which has since been deleted
+	previous := LoadManifest(out, "settings", "theme")
+	previous.SetPage("trip/index.html", "")
+	previous.SetPage("trip/b/index.html", "")
+	if err := previous.Save(out); err != nil {
+		t.Fatal(err)
+	}
+
+	g := &Generator{OutputPath: out, cache: NewManifest(out, "settings", "theme")}
+	g.cache.SetPage("trip/index.html", "")
+	albums := []Album{{ID: "trip", Photos: []Photo{{
+		Thumbnails: map[string]string{"small": "/static/thumbs/trip/a_small.jpg"},
+	}}}}
+
+	removed, err := g.pruneOutput(albums, []string{"trip", "hidden"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(removed)
+	want := []string{
+		"hidden/index.html",
+		"static/thumbs/gone/c_small.jpg",
+		"static/thumbs/trip/b_small.jpg",
+		"static/videos/trip/clip.mp4",
+		"trip/b/index.html",
+	}
+	if strings.Join(removed, " ") != strings.Join(want, " ") {
+		t.Errorf("removed %v, want %v", removed, want)
+	}
+
+	for _, kept := range []string{"static/thumbs/trip/a_small.jpg", "trip/index.html", "about.html"} {
+		if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(kept))); err != nil {
+			t.Errorf("%s was removed", kept)
+		}
+	}
+	for _, dir := range []string{"static/thumbs/gone", "trip/b", "hidden"} {
+		if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(dir))); err == nil {
+			t.Errorf("empty directory %s left behind", dir)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package gallery
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/cjs/purtypics/pkg/image"
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+// defaultQuality is the JPEG quality of sizes the gallery doesn't configure
+const defaultQuality = 95
+
+// RenderingSizes returns the image sizes a gallery generates, smallest
+// first: the built-in sizes with the gallery's rendering settings applied.
+// The editor previews use the same sizes. Problems with the settings are
+// returned as messages; the offending entries are ignored.
+func RenderingSizes(meta *metadata.GalleryMetadata) ([]image.Size, []string) {
+	var problems []string
+	sizes := make(map[string]image.Size)
+	for _, size := range image.DefaultSizes() {
+		sizes[size.Name] = size
+	}
+
+	quality := defaultQuality
+	if meta != nil && meta.Rendering != nil {
+		rendering := meta.Rendering
+		switch {
+		case rendering.Quality >= 1 && rendering.Quality <= 100:
+			quality = rendering.Quality
+		case rendering.Quality != 0:
+			problems = append(problems, fmt.Sprintf("rendering quality %d is not between 1 and 100", rendering.Quality))
+		}
+
+		for name, config := range rendering.Sizes {
+			if config == nil {
+				continue
+			}
+			if config.Disabled {
+				delete(sizes, name)
+				continue
+			}
+
+			size := sizes[name]
+			size.Name = name
+			switch {
+			case config.Width > 0:
+				size.Width, size.LongEdge = config.Width, 0
+			case config.LongEdge > 0:
+				size.Width, size.LongEdge = 0, config.LongEdge
+			}
+			if size.Width == 0 && size.LongEdge == 0 {
+				problems = append(problems, fmt.Sprintf("rendering size %q has neither long_edge nor width", name))
+				continue
+			}
+			switch {
+			case config.Quality >= 1 && config.Quality <= 100:
+				size.Quality = config.Quality
+			case config.Quality != 0:
+				problems = append(problems, fmt.Sprintf("rendering size %q has quality %d, which is not between 1 and 100", name, config.Quality))
+			}
+			if config.Sharpen > 0 {
+				size.Sharpen = config.Sharpen
+			}
+			sizes[name] = size
+		}
+	}
+
+	if len(sizes) == 0 {
+		problems = append(problems, "rendering disables every size, using the built-in sizes")
+		defaults, _ := RenderingSizes(nil)
+		return defaults, problems
+	}
+
+	ordered := make([]image.Size, 0, len(sizes))
+	for _, size := range sizes {
+		if size.Quality == 0 {
+			size.Quality = quality
+		}
+		ordered = append(ordered, size)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		bi, bj := sizeBound(ordered[i]), sizeBound(ordered[j])
+		if bi != bj {
+			return bi < bj
+		}
+		return ordered[i].Name < ordered[j].Name
+	})
+	return ordered, problems
+}
+
+// sizeBound returns the pixel limit that orders sizes from small to large
+func sizeBound(size image.Size) int {
+	if size.Width > 0 {
+		return size.Width
+	}
+	return size.LongEdge
+}
+
+// RenderingCrops returns the cropped renditions a gallery generates and the
+// one album grids use, empty for the full frame. Problems are returned as
+// messages like RenderingSizes does.
+func RenderingCrops(meta *metadata.GalleryMetadata) ([]image.Crop, string, []string) {
+	if meta == nil || meta.Rendering == nil {
+		return nil, "", nil
+	}
+
+	var problems []string
+	var crops []image.Crop
+	seen := make(map[string]bool)
+	for _, name := range meta.Rendering.Crops {
+		crop, err := image.ParseCrop(name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("rendering %v", err))
+			continue
+		}
+		if !seen[crop.Name] {
+			seen[crop.Name] = true
+			crops = append(crops, crop)
+		}
+	}
+
+	cardCrop := meta.Rendering.CardCrop
+	if cardCrop != "" && !seen[cardCrop] {
+		problems = append(problems, fmt.Sprintf("rendering card_crop %q is not one of the crops, using the full frame", cardCrop))
+		cardCrop = ""
+	}
+	return crops, cardCrop, problems
+}
+
+// configureRendering hands the gallery's image sizes and crops to the image
+// processor
+func (g *Generator) configureRendering() {
+	sizes, problems := RenderingSizes(g.metadata)
+	crops, cardCrop, cropProblems := RenderingCrops(g.metadata)
+	for _, problem := range append(problems, cropProblems...) {
+		log.Printf("Warning: %s", problem)
+	}
+	g.imageProcessor.SetSizes(sizes)
+	g.imageProcessor.SetCrops(crops)
+	g.cardCrop = cardCrop
+}
+
+// PhotoEdit returns the framing a photo's metadata asks for: its rotation,
+// straightening and crop. The editor previews use the same edit.
+func PhotoEdit(meta *metadata.PhotoMetadata) image.Edit {
+	if meta == nil {
+		return image.Edit{}
+	}
+	var crop *image.Region
+	if meta.Crop != nil {
+		crop = &image.Region{X: meta.Crop.X, Y: meta.Crop.Y, Width: meta.Crop.Width, Height: meta.Crop.Height}
+	}
+	return image.NewEdit(meta.Rotate, meta.Straighten, crop)
+}
+
+// PhotoAdjustments returns the tonal adjustments of a photo: its own if it
+// has any, even empty ones, or else its album's. Named presets are filled in
+// from the gallery's adjustment_presets, with the values set alongside taking
+// precedence. An unknown preset is returned as an error and left out.
+func PhotoAdjustments(meta *metadata.GalleryMetadata, albumID string, photoMeta *metadata.PhotoMetadata) (image.Adjustments, error) {
+	var adj *metadata.Adjustments
+	if photoMeta != nil {
+		adj = photoMeta.Adjustments
+	}
+	if adj == nil && meta != nil {
+		if albumMeta := meta.GetAlbumMetadata(albumID); albumMeta != nil {
+			adj = albumMeta.Adjustments
+		}
+	}
+	if adj == nil {
+		return image.Adjustments{}, nil
+	}
+
+	values := *adj
+	var err error
+	if adj.Preset != "" {
+		var preset *metadata.Adjustments
+		if meta != nil {
+			preset = meta.AdjustmentPresets[adj.Preset]
+		}
+		if preset != nil {
+			values = *preset
+			if adj.Gamma != 0 {
+				values.Gamma = adj.Gamma
+			}
+			if adj.Brightness != 0 {
+				values.Brightness = adj.Brightness
+			}
+			if adj.Contrast != 0 {
+				values.Contrast = adj.Contrast
+			}
+			if adj.Saturation != 0 {
+				values.Saturation = adj.Saturation
+			}
+			values.Grayscale = values.Grayscale || adj.Grayscale
+		} else {
+			err = fmt.Errorf("unknown adjustment preset %q", adj.Preset)
+		}
+	}
+	return image.NewAdjustments(values.Gamma, values.Brightness, values.Contrast, values.Saturation, values.Grayscale), err
+}
@@ -0,0 +1,108 @@
+package gallery
+
+import (
+	"testing"
+
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+func TestRenderingSizes(t *testing.T) {
+	sizes, problems := RenderingSizes(nil)
+	if len(sizes) != 4 || sizes[0].Name != "small" || sizes[3].Name != "full" || len(problems) != 0 {
+		t.Fatalf("default sizes = %+v, problems %v", sizes, problems)
+	}
+	for _, size := range sizes {
+		if size.Quality != defaultQuality {
+			t.Errorf("%s quality = %d, want %d", size.Name, size.Quality, defaultQuality)
+		}
+	}
+
+	meta := &metadata.GalleryMetadata{Rendering: &metadata.RenderingSettings{
+		Quality: 85,
+		Sizes: map[string]*metadata.RenderSize{
+			"full":   {Disabled: true},
+			"medium": {Width: 1000, Quality: 90, Sharpen: 0.5},
+			"hero":   {LongEdge: 3200},
+			"broken": {Quality: 80},
+		},
+	}}
+	sizes, problems = RenderingSizes(meta)
+
+	var names []string
+	for _, size := range sizes {
+		names = append(names, size.Name)
+	}
+	if got := len(names); got != 4 || names[0] != "small" || names[1] != "medium" || names[2] != "large" || names[3] != "hero" {
+		t.Fatalf("sizes = %v, want small medium large hero", names)
+	}
+	if medium := sizes[1]; medium.Width != 1000 || medium.LongEdge != 0 || medium.Quality != 90 || medium.Sharpen != 0.5 {
+		t.Errorf("medium = %+v", medium)
+	}
+	if small := sizes[0]; small.LongEdge != 400 || small.Quality != 85 {
+		t.Errorf("small = %+v", small)
+	}
+	if len(problems) != 1 {
+		t.Errorf("problems = %v, want one about the broken size", problems)
+	}
+
+	w, h, larger := sizes[1].Dimensions(800, 1200)
+	if w != 1000 || h != 1500 || larger {
+		t.Errorf("width-based size of a portrait = %dx%d larger=%v", w, h, larger)
+	}
+}
+
+func TestRenderingCrops(t *testing.T) {
+	meta := &metadata.GalleryMetadata{Rendering: &metadata.RenderingSettings{
+		Crops:    []string{"square", "16:9", "wide", "square"},
+		CardCrop: "square",
+	}}
+	crops, cardCrop, problems := RenderingCrops(meta)
+	if len(crops) != 2 || crops[0].Name != "square" || crops[1].Name != "16:9" {
+		t.Errorf("crops = %+v, want square and 16:9", crops)
+	}
+	if cardCrop != "square" {
+		t.Errorf("card crop = %q, want square", cardCrop)
+	}
+	if len(problems) != 1 {
+		t.Errorf("problems = %v, want one for \"wide\"", problems)
+	}
+
+	meta.Rendering.CardCrop = "4:3"
+	if _, cardCrop, problems = RenderingCrops(meta); cardCrop != "" || len(problems) != 2 {
+		t.Errorf("card crop outside crops = %q, problems %v", cardCrop, problems)
+	}
+}
+
+func TestPhotoAdjustments(t *testing.T) {
+	meta := &metadata.GalleryMetadata{
+		AdjustmentPresets: map[string]*metadata.Adjustments{
+			"film": {Contrast: 20, Saturation: -30},
+		},
+		Albums: map[string]*metadata.AlbumMetadata{
+			"trip": {Adjustments: &metadata.Adjustments{Preset: "film"}},
+		},
+	}
+
+	adj, err := PhotoAdjustments(meta, "trip", nil)
+	if err != nil || adj.Contrast != 20 || adj.Saturation != -30 {
+		t.Errorf("album preset = %+v, %v", adj, err)
+	}
+
+	own := &metadata.PhotoMetadata{Adjustments: &metadata.Adjustments{Preset: "film", Contrast: 5, Grayscale: true}}
+	adj, _ = PhotoAdjustments(meta, "trip", own)
+	if adj.Contrast != 5 || adj.Saturation != -30 || !adj.Grayscale {
+		t.Errorf("photo values over the preset = %+v", adj)
+	}
+
+	// Empty adjustments of the photo's own keep the album's away
+	none := &metadata.PhotoMetadata{Adjustments: &metadata.Adjustments{}}
+	if adj, _ := PhotoAdjustments(meta, "trip", none); !adj.IsZero() {
+		t.Errorf("explicitly unadjusted photo = %+v", adj)
+	}
+
+	unknown := &metadata.PhotoMetadata{Adjustments: &metadata.Adjustments{Preset: "missing", Brightness: 10}}
+	adj, err = PhotoAdjustments(meta, "other", unknown)
+	if err == nil || adj.Brightness != 10 {
+		t.Errorf("unknown preset = %+v, %v; want its own values and an error", adj, err)
+	}
+}
@@ -0,0 +1,195 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// searchIndexFile is the top-level search index, listing every album along
+// with the words found in its photos. Photo entries live in one shard per
+// album under search/, fetched only for albums that can match a query.
+const searchIndexFile = "search-index.json"
+
+// searchIndex is the top-level search index
+type searchIndex struct {
+	Version int            `json:"v"`
+	Albums  []*searchAlbum `json:"albums"`
+}
+
+// searchAlbum is one album in the top-level index. Keys are kept short since
+// the index lists every album in the gallery.
+type searchAlbum struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"t"`
+	Description string   `json:"d,omitempty"`
+	Tags        []string `json:"g,omitempty"`
+	Date        string   `json:"dt,omitempty"`
+	URL         string   `json:"u"`
+	Thumb       string   `json:"i,omitempty"`
+	Photos      int      `json:"n"`
+	Shard       string   `json:"s,omitempty"` // path of the album's photo shard, empty when it has no photos
+	Terms       []string `json:"w,omitempty"` // distinct words found in the album's photos
+}
+
+// searchShard holds the photo entries of one album
+type searchShard struct {
+	Album  string         `json:"album"`
+	Photos []*searchPhoto `json:"photos"`
+}
+
+// searchPhoto is one photo in an album shard
+type searchPhoto struct {
+	Title       string   `json:"t"`
+	Description string   `json:"d,omitempty"`
+	Tags        []string `json:"g,omitempty"`
+	Camera      string   `json:"c,omitempty"`
+	Lens        string   `json:"l,omitempty"`
+	Date        string   `json:"dt,omitempty"`
+	URL         string   `json:"u"`
+	Thumb       string   `json:"i,omitempty"`
+}
+
+// generateSearch writes the search index, one shard per album and the
+// search page at /search/
+func (g *Generator) generateSearch(tmpl *template.Template, albums []Album, galleryData *GalleryData) error {
+	index := searchIndex{Version: 1, Albums: make([]*searchAlbum, 0, len(albums))}
+
+	for i := range albums {
+		album := &albums[i]
+		entry := &searchAlbum{
+			ID:          album.ID,
+			Title:       album.Title,
+			Description: stripTags(string(album.Description)),
+			Tags:        album.Tags,
+			URL:         "/" + album.ID + "/",
+			Photos:      len(album.Photos),
+		}
+		if !album.CreatedAt.IsZero() {
+			entry.Date = album.CreatedAt.Format("2006-01-02")
+		}
+		if cover := album.Cover(); cover != nil {
+			entry.Thumb = cover.Rendition("small", "medium", "poster")
+		}
+		index.Albums = append(index.Albums, entry)
+
+		if len(album.Photos) == 0 {
+			continue
+		}
+
+		shard := searchShard{Album: album.ID, Photos: make([]*searchPhoto, 0, len(album.Photos))}
+		terms := make(map[string]bool)
+		for j := range album.Photos {
+			photo := &album.Photos[j]
+			sp := &searchPhoto{
+				Title:       photo.DisplayTitle(),
+				Description: photo.Description,
+				Tags:        photo.Tags,
+				URL:         photo.PagePath,
+				Thumb:       photo.Rendition("small", "medium", "poster"),
+			}
+			if sp.URL == "" {
+				sp.URL = entry.URL
+			}
+			if photo.EXIF != nil {
+				sp.Camera = photo.EXIF.Camera
+				sp.Lens = photo.EXIF.Lens
+			}
+			if t := photoTime(*photo); !t.IsZero() {
+				sp.Date = t.Format("2006-01-02")
+			}
+			shard.Photos = append(shard.Photos, sp)
+
+			for _, field := range append([]string{sp.Title, sp.Description, sp.Camera, sp.Lens, sp.Date}, sp.Tags...) {
+				for _, term := range searchTerms(field) {
+					terms[term] = true
+				}
+			}
+		}
+
+		entry.Shard = path.Join("/search", album.ID+".json")
+		for term := range terms {
+			entry.Terms = append(entry.Terms, term)
+		}
+		sort.Strings(entry.Terms)
+
+		if err := g.writeSearchFile(strings.TrimPrefix(entry.Shard, "/"), shard); err != nil {
+			return err
+		}
+	}
+
+	if err := g.writeSearchFile(searchIndexFile, index); err != nil {
+		return err
+	}
+	return g.generateSearchPage(tmpl, galleryData)
+}
+
+// searchTerms splits text into the lowercase words the search page matches
+// queries against. search.js must tokenize queries the same way.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// writeSearchFile writes a JSON file of the search index, leaving it
+// untouched when its content has not changed
+func (g *Generator) writeSearchFile(relPath string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to build %s: %w", relPath, err)
+	}
+	hash := fingerprint(string(data))
+	if g.cache != nil && g.cache.PageFresh(g.OutputPath, relPath, hash) {
+		return nil
+	}
+
+	outPath := filepath.Join(g.OutputPath, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outPath, data, 0644); err != nil {
+		return err
+	}
+	if g.cache != nil {
+		g.cache.SetPage(relPath, hash)
+	}
+	return nil
+}
+
+// generateSearchPage writes the search page at /search/
+func (g *Generator) generateSearchPage(tmpl *template.Template, galleryData *GalleryData) error {
+	var contentBuf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&contentBuf, "search.html", HTMLTemplateData{
+		BasePath: "..",
+		Gallery:  galleryData,
+	}); err != nil {
+		return fmt.Errorf("failed to render search content: %w", err)
+	}
+
+	var pageBuf bytes.Buffer
+	pageData := g.pageData(fmt.Sprintf("Search - %s", galleryData.Title), galleryData.Description, "..", template.HTML(contentBuf.String()))
+	pageData.NoIndex = true // result pages are built in the browser
+	if err := tmpl.ExecuteTemplate(&pageBuf, "base.html", pageData); err != nil {
+		return fmt.Errorf("failed to render search page: %w", err)
+	}
+
+	searchDir := filepath.Join(g.OutputPath, "search")
+	if err := os.MkdirAll(searchDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(searchDir, "index.html"), pageBuf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if g.cache != nil {
+		g.cache.SetPage("search/index.html", "")
+	}
+	return nil
+}
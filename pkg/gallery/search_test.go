@@ -0,0 +1,128 @@
+package gallery
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/metadata"
+	"github.com/disintegration/imaging"
+)
+
+func TestGenerateSearch(t *testing.T) {
+	src := t.TempDir()
+	out := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "trip"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"beach.jpg", "secret.jpg"} {
+		if err := imaging.Save(imaging.New(64, 48, color.NRGBA{90, 140, 200, 255}), filepath.Join(src, "trip", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	yaml := fmt.Sprintf("photos:\n  %q:\n    title: Sunny Beach\n  %q:\n    title: Hidden Garden\n    hidden: true\n",
+		filepath.Join(src, "trip", "beach.jpg"), filepath.Join(src, "trip", "secret.jpg"))
+	if err := os.WriteFile(filepath.Join(src, "gallery.yaml"), []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGenerator(src, out, "Test", "", "dev", false)
+	if err := g.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var index searchIndex
+	readJSON(t, filepath.Join(out, searchIndexFile), &index)
+	if len(index.Albums) != 1 || index.Albums[0].Photos != 1 || index.Albums[0].Shard != "/search/trip.json" {
+		t.Fatalf("index albums = %+v", index.Albums)
+	}
+	var shard searchShard
+	readJSON(t, filepath.Join(out, "search", "trip.json"), &shard)
+	if len(shard.Photos) != 1 || shard.Photos[0].Title != "Sunny Beach" {
+		t.Fatalf("shard photos = %+v, want only the published photo", shard.Photos)
+	}
+
+	// Only the published photo's words are searchable
+	terms := strings.Join(index.Albums[0].Terms, " ")
+	if !strings.Contains(terms, "beach") || strings.Contains(terms, "garden") {
+		t.Errorf("index terms = %v, want the published photo's only", index.Albums[0].Terms)
+	}
+
+	// No entry in either file carries a location
+	for _, name := range []string{searchIndexFile, "search/trip.json"} {
+		var entries interface{}
+		readJSON(t, filepath.Join(out, filepath.FromSlash(name)), &entries)
+		if fields := coordinateFields(entries); len(fields) > 0 {
+			t.Errorf("%s has coordinate fields %v", name, fields)
+		}
+	}
+}
+
+func TestGenerateSearchLeavesOutLocations(t *testing.T) {
+	out := t.TempDir()
+	g := &Generator{OutputPath: out, metadata: &metadata.GalleryMetadata{ShowLocations: true}}
+	tmpl := template.Must(template.New("").Parse(`{{define "search.html"}}{{end}}{{define "base.html"}}{{end}}`))
+	albums := []Album{{ID: "trip", Title: "Trip", Photos: []Photo{{
+		ID:   "beach",
+		EXIF: &exif.EXIFData{Camera: "X100V", GPS: &exif.GPSData{Latitude: 45.123456, Longitude: -122.654321}},
+	}}}}
+	if err := g.generateSearch(tmpl, albums, &GalleryData{Title: "Test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "search", "trip.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "X100V") {
+		t.Errorf("shard is missing the camera: %s", data)
+	}
+	var shard interface{}
+	if err := json.Unmarshal(data, &shard); err != nil {
+		t.Fatal(err)
+	}
+	if fields := coordinateFields(shard); len(fields) > 0 {
+		t.Errorf("shard has coordinate fields %v: %s", fields, data)
+	}
+	if strings.Contains(string(data), "45.12") || strings.Contains(string(data), "122.65") {
+		t.Errorf("shard publishes the location: %s", data)
+	}
+}
+
+// coordinateFields returns the keys anywhere in decoded JSON that could hold
+// a location
+func coordinateFields(v interface{}) []string {
+	var fields []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			switch strings.ToLower(key) {
+			case "lat", "lng", "lon", "latitude", "longitude", "gps", "geo", "location", "coordinates":
+				fields = append(fields, key)
+			}
+			fields = append(fields, coordinateFields(value)...)
+		}
+	case []interface{}:
+		for _, value := range v {
+			fields = append(fields, coordinateFields(value)...)
+		}
+	}
+	return fields
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
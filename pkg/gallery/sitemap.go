@@ -0,0 +1,190 @@
+package gallery
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+// maxSitemapURLs is the most URLs a single sitemap file may list. Larger
+// galleries get a sitemap index pointing at numbered sitemap files.
+const maxSitemapURLs = 50000
+
+// sitemapURL is one <url> entry, with image sitemap extensions
+type sitemapURL struct {
+	Loc     string         `xml:"loc"`
+	LastMod string         `xml:"lastmod,omitempty"`
+	Images  []sitemapImage `xml:"image:image"`
+}
+
+// sitemapImage is an <image:image> entry
+type sitemapImage struct {
+	Loc string `xml:"image:loc"`
+}
+
+// urlSet is the root element of a sitemap
+type urlSet struct {
+	XMLName    xml.Name     `xml:"urlset"`
+	Xmlns      string       `xml:"xmlns,attr"`
+	XmlnsImage string       `xml:"xmlns:image,attr"`
+	URLs       []sitemapURL `xml:"url"`
+}
+
+// sitemapIndex is the root element of a sitemap index
+type sitemapIndex struct {
+	XMLName  xml.Name         `xml:"sitemapindex"`
+	Xmlns    string           `xml:"xmlns,attr"`
+	Sitemaps []sitemapPointer `xml:"sitemap"`
+}
+
+// sitemapPointer is one <sitemap> entry of a sitemap index
+type sitemapPointer struct {
+	Loc string `xml:"loc"`
+}
+
+// robotsPolicy returns the gallery's robots policy, or an empty one
+func (g *Generator) robotsPolicy() metadata.RobotsPolicy {
+	if g.metadata != nil && g.metadata.Robots != nil {
+		return *g.metadata.Robots
+	}
+	return metadata.RobotsPolicy{}
+}
+
+// generateSitemap writes robots.txt and, when the gallery has a base URL and
+// allows indexing, sitemap.xml listing every indexable page and its photos
+func (g *Generator) generateSitemap(albums []Album, tags []*Tag) error {
+	policy := g.robotsPolicy()
+	sitemap := g.BaseURL != "" && !policy.NoIndex
+
+	if sitemap {
+		if err := g.writeSitemap(g.sitemapURLs(albums, tags)); err != nil {
+			return err
+		}
+	} else if g.Verbose && !policy.NoIndex {
+		fmt.Println("Skipping sitemap: set base_url in gallery.yaml to publish it")
+	}
+
+	var robots strings.Builder
+	robots.WriteString("User-agent: *\n")
+	if policy.NoIndex {
+		robots.WriteString("Disallow: /\n")
+	} else if len(policy.Disallow) == 0 {
+		robots.WriteString("Disallow:\n")
+	}
+	if !policy.NoIndex {
+		for _, p := range policy.Disallow {
+			if p = strings.TrimSpace(p); p != "" {
+				if !strings.HasPrefix(p, "/") {
+					p = "/" + p
+				}
+				fmt.Fprintf(&robots, "Disallow: %s\n", p)
+			}
+		}
+	}
+	if sitemap {
+		fmt.Fprintf(&robots, "\nSitemap: %s\n", absoluteURL(g.BaseURL, "/sitemap.xml"))
+	}
+	return g.writeRootFile("robots.txt", []byte(robots.String()))
+}
+
+// sitemapURLs lists the index page, every album, photo and tag page that
+// search engines may index
+func (g *Generator) sitemapURLs(albums []Album, tags []*Tag) []sitemapURL {
+	urls := []sitemapURL{{Loc: absoluteURL(g.BaseURL, "/")}}
+
+	for i := range albums {
+		album := &albums[i]
+		if album.NoIndex {
+			continue
+		}
+
+		entry := sitemapURL{Loc: absoluteURL(g.BaseURL, "/"+album.ID+"/")}
+		if !album.CreatedAt.IsZero() {
+			entry.LastMod = album.CreatedAt.UTC().Format(time.RFC3339)
+		}
+		for j := range album.Photos {
+			if image := album.Photos[j].Rendition("full", "large", "medium", "poster"); image != "" {
+				entry.Images = append(entry.Images, sitemapImage{Loc: absoluteURL(g.BaseURL, image)})
+			}
+		}
+		urls = append(urls, entry)
+
+		for j := range album.Photos {
+			photo := &album.Photos[j]
+			if photo.PagePath == "" {
+				continue
+			}
+			entry := sitemapURL{Loc: absoluteURL(g.BaseURL, photo.PagePath)}
+			if image := photo.Rendition("full", "large", "medium", "poster"); image != "" {
+				entry.Images = []sitemapImage{{Loc: absoluteURL(g.BaseURL, image)}}
+			}
+			urls = append(urls, entry)
+		}
+	}
+
+	if len(tags) > 0 {
+		urls = append(urls, sitemapURL{Loc: absoluteURL(g.BaseURL, "/tags/")})
+		for _, tag := range tags {
+			if tag.NoIndex {
+				continue
+			}
+			urls = append(urls, sitemapURL{Loc: absoluteURL(g.BaseURL, "/tags/"+tag.Slug+"/")})
+		}
+	}
+	return urls
+}
+
+// writeSitemap writes sitemap.xml, splitting the URLs across numbered
+// sitemap files behind a sitemap index when there are too many for one
+func (g *Generator) writeSitemap(urls []sitemapURL) error {
+	const ns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	const imageNS = "http://www.google.com/schemas/sitemap-image/1.1"
+
+	if len(urls) <= maxSitemapURLs {
+		data, err := marshalXML(urlSet{Xmlns: ns, XmlnsImage: imageNS, URLs: urls})
+		if err != nil {
+			return fmt.Errorf("failed to build sitemap.xml: %w", err)
+		}
+		return g.writeRootFile("sitemap.xml", data)
+	}
+
+	index := sitemapIndex{Xmlns: ns}
+	for start, n := 0, 1; start < len(urls); start, n = start+maxSitemapURLs, n+1 {
+		end := start + maxSitemapURLs
+		if end > len(urls) {
+			end = len(urls)
+		}
+		name := fmt.Sprintf("sitemap-%d.xml", n)
+		data, err := marshalXML(urlSet{Xmlns: ns, XmlnsImage: imageNS, URLs: urls[start:end]})
+		if err != nil {
+			return fmt.Errorf("failed to build %s: %w", name, err)
+		}
+		if err := g.writeRootFile(name, data); err != nil {
+			return err
+		}
+		index.Sitemaps = append(index.Sitemaps, sitemapPointer{Loc: absoluteURL(g.BaseURL, "/"+name)})
+	}
+
+	data, err := marshalXML(index)
+	if err != nil {
+		return fmt.Errorf("failed to build sitemap.xml: %w", err)
+	}
+	return g.writeRootFile("sitemap.xml", data)
+}
+
+// writeRootFile writes a file at the top of the output directory and records
+// it in the build manifest so it is pruned once no longer generated
+func (g *Generator) writeRootFile(name string, data []byte) error {
+	if err := os.WriteFile(filepath.Join(g.OutputPath, name), data, 0644); err != nil {
+		return err
+	}
+	if g.cache != nil {
+		g.cache.SetPage(name, "")
+	}
+	return nil
+}
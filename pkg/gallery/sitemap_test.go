@@ -0,0 +1,66 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+func TestGenerateSitemap(t *testing.T) {
+	albums := []Album{
+		{ID: "public", Photos: []Photo{{PagePath: "/public/a/", Tags: []string{"beach"}}}},
+		{ID: "private", NoIndex: true, Photos: []Photo{{PagePath: "/private/b/", Tags: []string{"home"}}}},
+	}
+	out := t.TempDir()
+	g := &Generator{
+		OutputPath: out,
+		BaseURL:    "https://photos.example.com",
+		metadata:   &metadata.GalleryMetadata{Robots: &metadata.RobotsPolicy{Disallow: []string{"static/videos/"}}},
+	}
+	if err := g.generateSitemap(albums, CollectTags(albums)); err != nil {
+		t.Fatal(err)
+	}
+
+	sitemap, err := os.ReadFile(filepath.Join(out, "sitemap.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"https://photos.example.com/public/", "https://photos.example.com/public/a/", "https://photos.example.com/tags/beach/"} {
+		if !strings.Contains(string(sitemap), "<loc>"+want+"</loc>") {
+			t.Errorf("sitemap is missing %s", want)
+		}
+	}
+	if strings.Contains(string(sitemap), "/private/") {
+		t.Errorf("sitemap lists the noindex album:\n%s", sitemap)
+	}
+	if strings.Contains(string(sitemap), "/tags/home/") {
+		t.Errorf("sitemap lists a tag page showing the noindex album's photos:\n%s", sitemap)
+	}
+
+	robots, err := os.ReadFile(filepath.Join(out, "robots.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "User-agent: *\nDisallow: /static/videos/\n\nSitemap: https://photos.example.com/sitemap.xml\n"
+	if string(robots) != want {
+		t.Errorf("robots.txt = %q, want %q", robots, want)
+	}
+
+	// A gallery that opts out of indexing has no sitemap and turns crawlers away
+	out = t.TempDir()
+	g.OutputPath = out
+	g.metadata.Robots = &metadata.RobotsPolicy{NoIndex: true}
+	if err := g.generateSitemap(albums, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "sitemap.xml")); err == nil {
+		t.Error("sitemap.xml written for a noindex gallery")
+	}
+	robots, _ = os.ReadFile(filepath.Join(out, "robots.txt"))
+	if string(robots) != "User-agent: *\nDisallow: /\n" {
+		t.Errorf("noindex robots.txt = %q", robots)
+	}
+}
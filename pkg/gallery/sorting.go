@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/cjs/purtypics/pkg/exif"
@@ -46,6 +47,99 @@ func (a *Album) SortPhotosByDate() {
 	})
 }
 
+// Photo sort orders accepted in an album's sort_order metadata
+const (
+	SortByDate     = "date"      // oldest first (default)
+	SortByDateDesc = "date_desc" // newest first
+	SortByName     = "name"      // natural filename order
+	SortByCustom   = "custom"    // custom_order, then sort_index, then date
+)
+
+// SortPhotos orders the album's photos according to sortOrder. For custom
+// ordering, photos listed in customOrder come first in that order, followed
+// by photos with a SortIndex (ascending) and then the rest by date.
+// Unknown or empty orders sort by date.
+func (a *Album) SortPhotos(sortOrder string, customOrder []string) {
+	switch sortOrder {
+	case SortByDateDesc:
+		a.SortPhotosByDate()
+		for i, j := 0, len(a.Photos)-1; i < j; i, j = i+1, j-1 {
+			a.Photos[i], a.Photos[j] = a.Photos[j], a.Photos[i]
+		}
+	case SortByName:
+		sort.SliceStable(a.Photos, func(i, j int) bool {
+			return naturalLess(a.Photos[i].Filename, a.Photos[j].Filename)
+		})
+	case SortByCustom:
+		a.SortPhotosByDate()
+		pos := make(map[string]int, len(customOrder))
+		for i, name := range customOrder {
+			pos[name] = i
+		}
+		sort.SliceStable(a.Photos, func(i, j int) bool {
+			pi, okI := pos[a.Photos[i].Filename]
+			pj, okJ := pos[a.Photos[j].Filename]
+			if okI || okJ {
+				if okI && okJ {
+					return pi < pj
+				}
+				return okI
+			}
+			si, sj := a.Photos[i].SortIndex, a.Photos[j].SortIndex
+			if si != 0 && sj != 0 {
+				return si < sj
+			}
+			return si != 0 && sj == 0
+		})
+	default:
+		a.SortPhotosByDate()
+	}
+}
+
+// naturalLess compares strings case-insensitively, treating runs of digits
+// as numbers so that "IMG_2" sorts before "IMG_10".
+func naturalLess(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	for a != "" && b != "" {
+		ca, cb := a[0], b[0]
+		if isDigit(ca) && isDigit(cb) {
+			na, restA := splitDigits(a)
+			nb, restB := splitDigits(b)
+			// Compare numerically by length first, then lexically
+			ta, tb := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(ta) != len(tb) {
+				return len(ta) < len(tb)
+			}
+			if ta != tb {
+				return ta < tb
+			}
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			a, b = restA, restB
+			continue
+		}
+		if ca != cb {
+			return ca < cb
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// splitDigits splits s into its leading run of ASCII digits and the remainder
+func splitDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
 func photoTime(p Photo) time.Time {
 	if p.EXIF != nil && !p.EXIF.DateTime.IsZero() {
 		return p.EXIF.DateTime
@@ -92,7 +186,7 @@ func SortAlbumsByCustomOrder(albums []Album, order []string, sourcePath string)
 	albumKey := func(a Album) string {
 		if sourcePath != "" {
 			if rel, err := filepath.Rel(sourcePath, a.Path); err == nil {
-				return rel
+				return filepath.ToSlash(rel)
 			}
 		}
 		return a.ID
@@ -0,0 +1,39 @@
+package gallery
+
+import "testing"
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"IMG_2.jpg", "IMG_10.jpg", true},
+		{"IMG_10.jpg", "IMG_2.jpg", false},
+		{"img_002.jpg", "IMG_2.jpg", false},
+		{"a.jpg", "B.jpg", true},
+		{"photo.jpg", "photo1.jpg", true},
+	}
+	for _, tt := range tests {
+		if got := naturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("naturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSortPhotos_Custom(t *testing.T) {
+	album := Album{Photos: []Photo{
+		{Filename: "a.jpg"},
+		{Filename: "b.jpg", SortIndex: 2},
+		{Filename: "c.jpg"},
+		{Filename: "d.jpg", SortIndex: 1},
+	}}
+
+	album.SortPhotos(SortByCustom, []string{"c.jpg"})
+
+	want := []string{"c.jpg", "d.jpg", "b.jpg", "a.jpg"}
+	for i, name := range want {
+		if album.Photos[i].Filename != name {
+			t.Errorf("photo[%d] = %q, want %q", i, album.Photos[i].Filename, name)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package gallery
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+// DefaultStackGap is the longest pause between two shots of one stack.
+// Bursts run at several frames a second, and a few seconds also covers
+// reframing the same shot by hand.
+const DefaultStackGap = 5 * time.Second
+
+// DefaultStackThreshold is how many of the 64 bits of a perceptual hash may
+// differ between neighbouring shots of a stack. It is looser than
+// DefaultDuplicateThreshold since subjects move between frames; the short
+// time gap keeps unrelated photos out.
+const DefaultStackThreshold = 16
+
+// FindStacks suggests stacks for an album: runs of photos taken at most gap
+// apart where each looks like the one before, within threshold bits. The
+// first shot of each run is its pick. Videos, hidden photos, photos without
+// a capture time and photos already in a stack are left out. Photos that
+// can't be read are returned as errors.
+func (f *DuplicateFinder) FindStacks(album Album, meta *metadata.GalleryMetadata, gap time.Duration, threshold int) ([]metadata.PhotoStack, []error) {
+	stacked := make(map[string]bool)
+	if meta != nil {
+		for _, stack := range meta.Stacks {
+			for _, path := range stack.Photos {
+				stacked[path] = true
+			}
+		}
+	}
+
+	type shot struct {
+		path  string
+		taken time.Time
+	}
+	var shots []shot
+	for _, photo := range album.Photos {
+		path := filepath.Join(album.Path, photo.Filename)
+		if photo.IsVideo || stacked[path] {
+			continue
+		}
+		if meta != nil {
+			if photoMeta := meta.GetPhotoMetadata(path); photoMeta != nil && photoMeta.Hidden {
+				continue
+			}
+		}
+		data := photo.EXIF
+		if data == nil {
+			data, _ = exif.ExtractMetadata(path)
+		}
+		if data == nil || data.DateTime.IsZero() {
+			continue
+		}
+		shots = append(shots, shot{path: path, taken: data.DateTime})
+	}
+	sort.SliceStable(shots, func(i, j int) bool {
+		return shots[i].taken.Before(shots[j].taken)
+	})
+
+	paths := make([]string, len(shots))
+	for i := range shots {
+		paths[i] = shots[i].path
+	}
+	hashes, errs := f.hashAll(paths, nil)
+
+	var stacks []metadata.PhotoStack
+	var run []string
+	flush := func() {
+		if len(run) > 1 {
+			stacks = append(stacks, metadata.PhotoStack{Photos: run, Pick: run[0]})
+		}
+		run = nil
+	}
+	for i := range shots {
+		if hashes[i] == nil {
+			flush()
+			continue
+		}
+		if len(run) > 0 {
+			prev := i - 1
+			if shots[i].taken.Sub(shots[prev].taken) > gap || hashes[i].image.Distance(hashes[prev].image) > threshold {
+				flush()
+			}
+		}
+		run = append(run, shots[i].path)
+	}
+	flush()
+	return stacks, errs
+}
+
+// applyStacks hides the album's stacked photos behind their picks. Each pick
+// gets the rest of its stack in album order, and the rest are marked Stacked.
+// Stacks that keep fewer than two visible photos in the album are ignored, as
+// is a photo's second stack. A pick that isn't visible falls to the first
+// visible photo.
+func applyStacks(album *Album, stacks []metadata.PhotoStack) {
+	index := make(map[string]int, len(album.Photos))
+	for i, photo := range album.Photos {
+		index[filepath.Join(album.Path, photo.Filename)] = i
+	}
+
+	inStack := make(map[int]bool)
+	for _, stack := range stacks {
+		var members []int
+		for _, path := range stack.Photos {
+			if i, ok := index[path]; ok && !inStack[i] {
+				members = append(members, i)
+				inStack[i] = true
+			}
+		}
+		if len(members) < 2 {
+			for _, i := range members {
+				delete(inStack, i)
+			}
+			continue
+		}
+		sort.Ints(members)
+
+		pick := members[0]
+		for _, m := range members {
+			if filepath.Join(album.Path, album.Photos[m].Filename) == stack.Pick {
+				pick = m
+			}
+		}
+		for _, m := range members {
+			if m == pick {
+				continue
+			}
+			album.Photos[m].Stacked = true
+			album.Photos[pick].Stack = append(album.Photos[pick].Stack, &album.Photos[m])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package gallery
+
+import (
+	"image/color"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/metadata"
+	"github.com/disintegration/imaging"
+)
+
+func TestFindStacks(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	album := Album{ID: "beach", Path: dir}
+	add := func(name string, offset time.Duration, subjectX int, sky color.NRGBA) {
+		t.Helper()
+		img := imaging.New(600, 400, sky)
+		for y := 250; y < 400; y++ {
+			for x := subjectX; x < subjectX+200; x++ {
+				img.Set(x, y, color.NRGBA{220, 180, 40, 255})
+			}
+		}
+		if err := imaging.Save(img, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+		album.Photos = append(album.Photos, Photo{
+			Filename: name,
+			EXIF:     &exif.EXIFData{DateTime: start.Add(offset)},
+		})
+	}
+	blue := color.NRGBA{30, 60, 90, 255}
+	add("burst1.jpg", 0, 100, blue)
+	add("burst2.jpg", time.Second, 104, blue)
+	add("burst3.jpg", 2*time.Second, 108, blue)
+	add("later.jpg", time.Minute, 108, blue)                                       // same scene, but much later
+	add("turned.jpg", time.Minute+time.Second, 300, color.NRGBA{200, 40, 40, 255}) // right after, but a different picture
+	add("again1.jpg", 2*time.Minute, 100, blue)
+	add("again2.jpg", 2*time.Minute+time.Second, 100, blue)
+
+	meta := &metadata.GalleryMetadata{
+		Stacks: []metadata.PhotoStack{{Photos: []string{filepath.Join(dir, "again1.jpg")}}},
+	}
+	stacks, errs := NewDuplicateFinder(DefaultDuplicateThreshold).FindStacks(album, meta, DefaultStackGap, DefaultStackThreshold)
+	if len(errs) != 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+	if len(stacks) != 1 {
+		t.Fatalf("got %d stacks, want 1: %+v", len(stacks), stacks)
+	}
+	want := []string{filepath.Join(dir, "burst1.jpg"), filepath.Join(dir, "burst2.jpg"), filepath.Join(dir, "burst3.jpg")}
+	if len(stacks[0].Photos) != len(want) || stacks[0].Pick != want[0] {
+		t.Fatalf("stack = %+v, want %v picking the first", stacks[0], want)
+	}
+	for i := range want {
+		if stacks[0].Photos[i] != want[i] {
+			t.Errorf("stack photo %d = %s, want %s", i, stacks[0].Photos[i], want[i])
+		}
+	}
+}
+
+func TestApplyStacks(t *testing.T) {
+	album := &Album{Path: "/src/trip"}
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"} {
+		album.Photos = append(album.Photos, Photo{ID: name, Filename: name})
+	}
+	applyStacks(album, []metadata.PhotoStack{
+		{Photos: []string{"/src/trip/d.jpg", "/src/trip/b.jpg", "/src/trip/gone.jpg"}, Pick: "/src/trip/d.jpg"},
+		{Photos: []string{"/src/trip/a.jpg", "/src/trip/gone.jpg"}},              // one visible photo left
+		{Photos: []string{"/src/trip/c.jpg", "/src/trip/b.jpg"}, Pick: "/x.jpg"}, // b is already stacked
+	})
+
+	a, b, c, d := album.Photos[0], album.Photos[1], album.Photos[2], album.Photos[3]
+	if len(d.Stack) != 1 || d.Stack[0].Filename != "b.jpg" || d.Stacked {
+		t.Errorf("pick d: Stack = %v, Stacked = %v; want [b.jpg], false", d.Stack, d.Stacked)
+	}
+	if !b.Stacked {
+		t.Error("b should be stacked behind d")
+	}
+	for _, photo := range []Photo{a, c} {
+		if photo.Stacked || len(photo.Stack) != 0 {
+			t.Errorf("%s should stand alone: Stack = %v, Stacked = %v", photo.Filename, photo.Stack, photo.Stacked)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package gallery
+
+import (
+	"encoding/json"
+	"html/template"
+	"strings"
+)
+
+// ldContext is the vocabulary every JSON-LD block refers to
+const ldContext = "https://schema.org"
+
+// ldCollection describes the gallery index or an album page
+type ldCollection struct {
+	Context         string          `json:"@context,omitempty"`
+	Type            string          `json:"@type"`
+	Name            string          `json:"name"`
+	Description     string          `json:"description,omitempty"`
+	URL             string          `json:"url,omitempty"`
+	Keywords        string          `json:"keywords,omitempty"`
+	Creator         *ldPerson       `json:"creator,omitempty"`
+	CopyrightNotice string          `json:"copyrightNotice,omitempty"`
+	Image           []*ldPhoto      `json:"image,omitempty"`
+	HasPart         []*ldCollection `json:"hasPart,omitempty"`
+}
+
+// ldPhoto describes a single photo
+type ldPhoto struct {
+	Context         string    `json:"@context,omitempty"`
+	Type            []string  `json:"@type"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description,omitempty"`
+	URL             string    `json:"url,omitempty"`
+	ContentURL      string    `json:"contentUrl"`
+	ThumbnailURL    string    `json:"thumbnailUrl,omitempty"`
+	Keywords        string    `json:"keywords,omitempty"`
+	Creator         *ldPerson `json:"creator,omitempty"`
+	CopyrightNotice string    `json:"copyrightNotice,omitempty"`
+	DateCreated     string    `json:"dateCreated,omitempty"`
+	ContentLocation *ldPlace  `json:"contentLocation,omitempty"`
+}
+
+// ldPerson is the photographer credited as creator
+type ldPerson struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+// ldPlace is where a photo was taken
+type ldPlace struct {
+	Type string        `json:"@type"`
+	Geo  ldCoordinates `json:"geo"`
+}
+
+// ldCoordinates holds GPS coordinates
+type ldCoordinates struct {
+	Type      string  `json:"@type"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Elevation float64 `json:"elevation,omitempty"`
+}
+
+// showLocations reports whether the gallery publishes photo locations
+func (g *Generator) showLocations() bool {
+	return g.metadata != nil && g.metadata.ShowLocations
+}
+
+// ldURL returns a site path as an absolute URL when the gallery has a base
+// URL, or relative to the page otherwise
+func (g *Generator) ldURL(basePath, sitePath string) string {
+	if sitePath == "" {
+		return ""
+	}
+	if g.BaseURL != "" {
+		return absoluteURL(g.BaseURL, sitePath)
+	}
+	return basePath + sitePath
+}
+
+// ldCreator returns the gallery author as a schema.org Person
+func ldCreator(galleryData *GalleryData) *ldPerson {
+	if galleryData.Author == "" {
+		return nil
+	}
+	return &ldPerson{Type: "Person", Name: galleryData.Author}
+}
+
+// ldAlbum describes an album. Albums holding photos are image galleries;
+// albums that only group other albums are plain collection pages.
+func (g *Generator) ldAlbum(album *Album, galleryData *GalleryData, basePath string, withPhotos bool) *ldCollection {
+	ld := &ldCollection{
+		Type:        "CollectionPage",
+		Name:        album.Title,
+		Description: stripTags(string(album.Description)),
+		URL:         g.ldURL(basePath, "/"+album.ID+"/"),
+		Keywords:    strings.Join(album.Tags, ", "),
+	}
+	if len(album.Photos) > 0 {
+		ld.Type = "ImageGallery"
+	}
+	if !withPhotos {
+		return ld
+	}
+
+	ld.Creator = ldCreator(galleryData)
+	ld.CopyrightNotice = galleryData.Copyright
+	for i := range album.Photos {
+		if photo := g.ldPhoto(&album.Photos[i], galleryData, basePath); photo != nil {
+			ld.Image = append(ld.Image, photo)
+		}
+	}
+	for _, child := range album.Children {
+		ld.HasPart = append(ld.HasPart, g.ldAlbum(child, galleryData, basePath, false))
+	}
+	return ld
+}
+
+// ldPhoto describes a photo, or returns nil for videos and photos without
+// renditions
+func (g *Generator) ldPhoto(photo *Photo, galleryData *GalleryData, basePath string) *ldPhoto {
+	if photo.IsVideo {
+		return nil
+	}
+	content := photo.Rendition("full", "large", "medium")
+	if content == "" {
+		return nil
+	}
+
+	ld := &ldPhoto{
+		Type:            []string{"ImageObject", "Photograph"},
+		Name:            photo.DisplayTitle(),
+		Description:     photo.Description,
+		URL:             g.ldURL(basePath, photo.PagePath),
+		ContentURL:      g.ldURL(basePath, content),
+		ThumbnailURL:    g.ldURL(basePath, photo.Rendition("medium", "small")),
+		Keywords:        strings.Join(photo.Tags, ", "),
+		Creator:         ldCreator(galleryData),
+		CopyrightNotice: galleryData.Copyright,
+	}
+	if photo.EXIF != nil {
+		// EXIF times carry no zone, so they are written as local time
+		if !photo.EXIF.DateTime.IsZero() {
+			ld.DateCreated = photo.EXIF.DateTime.Format("2006-01-02T15:04:05")
+		}
+		if gps := photo.EXIF.GPS; gps != nil && g.showLocations() {
+			ld.ContentLocation = &ldPlace{
+				Type: "Place",
+				Geo: ldCoordinates{
+					Type:      "GeoCoordinates",
+					Latitude:  gps.Latitude,
+					Longitude: gps.Longitude,
+					Elevation: gps.Altitude,
+				},
+			}
+		}
+	}
+	return ld
+}
+
+// indexStructuredData describes the gallery index and its top-level albums
+func (g *Generator) indexStructuredData(galleryData *GalleryData, basePath string) template.JS {
+	ld := &ldCollection{
+		Context:         ldContext,
+		Type:            "ImageGallery",
+		Name:            galleryData.Title,
+		Description:     galleryData.Description,
+		URL:             g.ldURL(basePath, "/"),
+		Creator:         ldCreator(galleryData),
+		CopyrightNotice: galleryData.Copyright,
+	}
+	for i := range galleryData.Albums {
+		ld.HasPart = append(ld.HasPart, g.ldAlbum(&galleryData.Albums[i], galleryData, basePath, false))
+	}
+	return marshalJSONLD(ld)
+}
+
+// albumStructuredData describes an album page and the photos on it
+func (g *Generator) albumStructuredData(album *Album, galleryData *GalleryData, basePath string) template.JS {
+	ld := g.ldAlbum(album, galleryData, basePath, true)
+	ld.Context = ldContext
+	return marshalJSONLD(ld)
+}
+
+// photoStructuredData describes a photo page
+func (g *Generator) photoStructuredData(photo *Photo, galleryData *GalleryData, basePath string) template.JS {
+	ld := g.ldPhoto(photo, galleryData, basePath)
+	if ld == nil {
+		return ""
+	}
+	ld.Context = ldContext
+	return marshalJSONLD(ld)
+}
+
+// marshalJSONLD encodes a JSON-LD value for a <script> element. json.Marshal
+// escapes <, > and &, so the result can never close the element early.
+func marshalJSONLD(v interface{}) template.JS {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return template.JS(data)
+}
@@ -0,0 +1,63 @@
+package gallery
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/metadata"
+)
+
+func TestPhotoStructuredData(t *testing.T) {
+	photo := &Photo{
+		ID:         "sunset",
+		Filename:   "sunset.jpg",
+		Title:      "Sunset </script>",
+		PagePath:   "/trips/sunset/",
+		Thumbnails: map[string]string{"medium": "/static/thumbs/trips/sunset_medium.jpg", "full": "/static/thumbs/trips/sunset_full.jpg"},
+		EXIF: &exif.EXIFData{
+			DateTime: time.Date(2024, 6, 1, 20, 15, 0, 0, time.UTC),
+			GPS:      &exif.GPSData{Latitude: 45.5, Longitude: -122.6},
+		},
+	}
+	galleryData := &GalleryData{Title: "Photos", Author: "Jane Doe", Copyright: "© 2024 Jane Doe"}
+
+	decode := func(g *Generator) map[string]interface{} {
+		t.Helper()
+		var ld map[string]interface{}
+		if err := json.Unmarshal([]byte(g.photoStructuredData(photo, galleryData, "../..")), &ld); err != nil {
+			t.Fatal(err)
+		}
+		return ld
+	}
+
+	g := &Generator{BaseURL: "https://photos.example.com", metadata: &metadata.GalleryMetadata{}}
+	ld := decode(g)
+	if ld["contentUrl"] != "https://photos.example.com/static/thumbs/trips/sunset_full.jpg" {
+		t.Errorf("contentUrl = %v", ld["contentUrl"])
+	}
+	if ld["dateCreated"] != "2024-06-01T20:15:00" {
+		t.Errorf("dateCreated = %v", ld["dateCreated"])
+	}
+	if creator, _ := ld["creator"].(map[string]interface{}); creator["name"] != "Jane Doe" {
+		t.Errorf("creator = %v", ld["creator"])
+	}
+	if ld["copyrightNotice"] != "© 2024 Jane Doe" {
+		t.Errorf("copyrightNotice = %v", ld["copyrightNotice"])
+	}
+	if _, ok := ld["contentLocation"]; ok {
+		t.Error("contentLocation published while show_locations is off")
+	}
+
+	g.metadata.ShowLocations = true
+	if _, ok := decode(g)["contentLocation"]; !ok {
+		t.Error("contentLocation missing while show_locations is on")
+	}
+
+	// Without a base URL, URLs are relative to the page
+	g.BaseURL = ""
+	if got := decode(g)["url"]; got != "../../trips/sunset/" {
+		t.Errorf("relative url = %v", got)
+	}
+}
@@ -0,0 +1,164 @@
+package gallery
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Tag groups the albums and photos that share a tag
+type Tag struct {
+	Name    string
+	Slug    string
+	Albums  []*Album
+	Photos  []TaggedPhoto
+	NoIndex bool // lists albums or photos kept out of search engines
+}
+
+// TaggedPhoto is a photo listed on a tag page along with the album it belongs to
+type TaggedPhoto struct {
+	Photo *Photo
+	Album *Album
+}
+
+// Count returns the number of albums and photos carrying the tag
+func (t *Tag) Count() int {
+	return len(t.Albums) + len(t.Photos)
+}
+
+// TagSlug converts a tag name into a URL-safe path segment
+func TagSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// CollectTags gathers tags from every album and photo, sorted by name.
+// Tags that differ only in case or punctuation are merged under one slug.
+// A tag listing anything from a noindex album is noindex too.
+func CollectTags(albums []Album) []*Tag {
+	bySlug := make(map[string]*Tag)
+	lookup := func(name string) *Tag {
+		slug := TagSlug(name)
+		if slug == "" {
+			return nil
+		}
+		tag, ok := bySlug[slug]
+		if !ok {
+			tag = &Tag{Name: strings.TrimSpace(name), Slug: slug}
+			bySlug[slug] = tag
+		}
+		return tag
+	}
+
+	for i := range albums {
+		album := &albums[i]
+		seen := make(map[*Tag]bool)
+		for _, name := range album.Tags {
+			if tag := lookup(name); tag != nil && !seen[tag] {
+				tag.Albums = append(tag.Albums, album)
+				tag.NoIndex = tag.NoIndex || album.NoIndex
+				seen[tag] = true
+			}
+		}
+		for j := range album.Photos {
+			photo := &album.Photos[j]
+			seen := make(map[*Tag]bool)
+			for _, name := range photo.Tags {
+				if tag := lookup(name); tag != nil && !seen[tag] {
+					tag.Photos = append(tag.Photos, TaggedPhoto{Photo: photo, Album: album})
+					tag.NoIndex = tag.NoIndex || album.NoIndex
+					seen[tag] = true
+				}
+			}
+		}
+	}
+
+	tags := make([]*Tag, 0, len(bySlug))
+	for _, tag := range bySlug {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return naturalLess(tags[i].Name, tags[j].Name)
+	})
+	return tags
+}
+
+// generateTagPages writes the tag index at /tags/ and one page per tag
+func (g *Generator) generateTagPages(tmpl *template.Template, tags []*Tag, galleryData *GalleryData) error {
+	tagsDir := filepath.Join(g.OutputPath, "tags")
+	if err := os.MkdirAll(tagsDir, 0755); err != nil {
+		return err
+	}
+
+	// Render the tag index
+	var contentBuf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&contentBuf, "tags.html", HTMLTemplateData{
+		BasePath: "..",
+		Gallery:  galleryData,
+		Tags:     tags,
+	}); err != nil {
+		return fmt.Errorf("failed to render tag index content: %w", err)
+	}
+
+	var pageBuf bytes.Buffer
+	pageData := g.pageData(fmt.Sprintf("Tags - %s", galleryData.Title), galleryData.Description, "..", template.HTML(contentBuf.String()))
+	if err := tmpl.ExecuteTemplate(&pageBuf, "base.html", pageData); err != nil {
+		return fmt.Errorf("failed to render tag index page: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tagsDir, "index.html"), pageBuf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if g.cache != nil {
+		g.cache.SetPage("tags/index.html", "")
+	}
+
+	// Render one page per tag
+	for _, tag := range tags {
+		tagDir := filepath.Join(tagsDir, tag.Slug)
+		if err := os.MkdirAll(tagDir, 0755); err != nil {
+			return err
+		}
+
+		contentBuf.Reset()
+		if err := tmpl.ExecuteTemplate(&contentBuf, "tag.html", HTMLTemplateData{
+			BasePath: "../..",
+			Gallery:  galleryData,
+			Tags:     tags,
+			Tag:      tag,
+		}); err != nil {
+			return fmt.Errorf("failed to render tag %s content: %w", tag.Name, err)
+		}
+
+		pageBuf.Reset()
+		pageData := g.pageData(fmt.Sprintf("%s - %s", tag.Name, galleryData.Title), fmt.Sprintf("Photos tagged %s", tag.Name), "../..", template.HTML(contentBuf.String()))
+		pageData.NoIndex = pageData.NoIndex || tag.NoIndex
+		if err := tmpl.ExecuteTemplate(&pageBuf, "base.html", pageData); err != nil {
+			return fmt.Errorf("failed to render tag %s page: %w", tag.Name, err)
+		}
+
+		if err := os.WriteFile(filepath.Join(tagDir, "index.html"), pageBuf.Bytes(), 0644); err != nil {
+			return err
+		}
+		if g.cache != nil {
+			g.cache.SetPage("tags/"+tag.Slug+"/index.html", "")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package gallery
+
+import "testing"
+
+func TestCollectTags(t *testing.T) {
+	albums := []Album{
+		{ID: "beach", Tags: []string{"Summer"}, Photos: []Photo{
+			{Filename: "one.jpg", Tags: []string{"sunset", "summer"}},
+			{Filename: "two.jpg"},
+		}},
+		{ID: "2024/japan", Photos: []Photo{
+			{Filename: "tokyo.jpg", Tags: []string{"Sunset!", " "}},
+		}},
+	}
+
+	tags := CollectTags(albums)
+
+	if len(tags) != 2 {
+		t.Fatalf("expected 2 tags, got %d", len(tags))
+	}
+	summer, sunset := tags[0], tags[1]
+	if summer.Slug != "summer" || len(summer.Albums) != 1 || len(summer.Photos) != 1 {
+		t.Errorf("summer = %q with %d albums, %d photos", summer.Slug, len(summer.Albums), len(summer.Photos))
+	}
+	if sunset.Slug != "sunset" || len(sunset.Photos) != 2 {
+		t.Errorf("sunset = %q with %d photos, want 2", sunset.Slug, len(sunset.Photos))
+	}
+	if sunset.Photos[1].Album.ID != "2024/japan" {
+		t.Errorf("tagged photo album = %q, want 2024/japan", sunset.Photos[1].Album.ID)
+	}
+	if summer.NoIndex || sunset.NoIndex {
+		t.Error("tag marked noindex without noindex albums")
+	}
+
+	// Listing a photo of a noindex album keeps the whole tag page out
+	albums[1].NoIndex = true
+	tags = CollectTags(albums)
+	if tags[0].NoIndex || !tags[1].NoIndex {
+		t.Errorf("noindex = %v for summer, %v for sunset; want false, true", tags[0].NoIndex, tags[1].NoIndex)
+	}
+}
+
+func TestTagSlug(t *testing.T) {
+	tests := map[string]string{
+		"Sunset":       "sunset",
+		"  New York  ": "new-york",
+		"rock & roll!": "rock-roll",
+		"Zürich":       "zürich",
+		"---":          "",
+	}
+	for in, want := range tests {
+		if got := TagSlug(in); got != want {
+			t.Errorf("TagSlug(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+// Package heif reads the metadata of HEIF and HEIC images: their displayed
+// size, EXIF block and ICC color profile. Decoding the pixels is left to an
+// external converter.
+package heif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Info is the metadata of a HEIF image
+type Info struct {
+	Width  int    // displayed width, after cropping and rotation
+	Height int    // displayed height, after cropping and rotation
+	EXIF   []byte // EXIF data starting at its TIFF header, nil if none
+	ICC    []byte // ICC profile, nil if none
+}
+
+// IsHEIF reports whether a file is a HEIF image, judging by its extension
+func IsHEIF(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".heic", ".heif", ".hif":
+		return true
+	}
+	return false
+}
+
+// maxMetaSize caps the meta box, which holds no pixel data
+const maxMetaSize = 16 << 20
+
+// box is an ISO base media file format box
+type box struct {
+	typ  string
+	data []byte // payload after the header
+}
+
+// Read reads the metadata of the HEIF image at path
+func Read(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := findMeta(f)
+	if err != nil {
+		return nil, err
+	}
+	return parseMeta(f, uint64(stat.Size()), meta)
+}
+
+// findMeta returns the payload of the top-level meta box
+func findMeta(r io.ReadSeeker) ([]byte, error) {
+	var offset int64
+	for {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, errors.New("heif: no meta box")
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		if size == 1 {
+			var large [8]byte
+			if _, err := io.ReadFull(r, large[:]); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(large[:]))
+			headerSize = 16
+		}
+		if offset == 0 && typ != "ftyp" {
+			return nil, errors.New("heif: not an ISO media file")
+		}
+		// A size of 0 runs to the end of the file; anything else must at
+		// least cover the header, which a 64-bit size past 2^63 doesn't
+		if size != 0 && size < headerSize {
+			return nil, fmt.Errorf("heif: %q box has invalid size %d", typ, size)
+		}
+		if typ == "meta" {
+			if size == 0 || size-headerSize > maxMetaSize {
+				return nil, errors.New("heif: meta box too large")
+			}
+			data := make([]byte, size-headerSize)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, err
+			}
+			return data, nil
+		}
+		if size == 0 {
+			return nil, errors.New("heif: no meta box")
+		}
+		offset += size
+	}
+}
+
+// children splits a payload into boxes
+func children(data []byte) []box {
+	var boxes []box
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		header := 8
+		if size == 1 && len(data) >= 16 {
+			size = int(binary.BigEndian.Uint64(data[8:]))
+			header = 16
+		} else if size == 0 {
+			size = len(data)
+		}
+		if size < header || size > len(data) {
+			break
+		}
+		boxes = append(boxes, box{typ, data[header:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// reader reads big-endian fields from a payload, remembering the first
+// out-of-range read
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) uint(n int) uint64 {
+	if r.err != nil || n > len(r.data) {
+		r.err = errors.New("heif: truncated box")
+		return 0
+	}
+	var v uint64
+	for _, b := range r.data[:n] {
+		v = v<<8 | uint64(b)
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// item is an entry of the iloc box
+type item struct {
+	method  int // 0: file offset, 1: idat offset
+	extents [][2]uint64
+}
+
+// parseMeta collects the primary item's size and the EXIF and ICC data
+func parseMeta(f io.ReaderAt, fileSize uint64, meta []byte) (*Info, error) {
+	if len(meta) < 4 {
+		return nil, errors.New("heif: empty meta box")
+	}
+
+	var primary uint64
+	var exifID uint64
+	haveExif := false
+	items := make(map[uint64]item)
+	var idat []byte
+	var properties []box
+	associations := make(map[uint64][]int)
+
+	for _, b := range children(meta[4:]) { // meta is a full box
+		r := &reader{data: b.data}
+		switch b.typ {
+		case "pitm":
+			version := r.uint(1)
+			r.uint(3)
+			if version == 0 {
+				primary = r.uint(2)
+			} else {
+				primary = r.uint(4)
+			}
+
+		case "iinf":
+			version := r.uint(1)
+			r.uint(3)
+			if version == 0 {
+				r.uint(2)
+			} else {
+				r.uint(4)
+			}
+			if r.err != nil {
+				break
+			}
+			for _, infe := range children(r.data) {
+				e := &reader{data: infe.data}
+				version := e.uint(1)
+				e.uint(3)
+				if infe.typ != "infe" || version < 2 {
+					continue
+				}
+				var id uint64
+				if version == 2 {
+					id = e.uint(2)
+				} else {
+					id = e.uint(4)
+				}
+				e.uint(2) // protection index
+				// The first item of type "Exif" holds the EXIF block
+				if typ := e.uint(4); e.err == nil && typ == 0x45786966 && !haveExif {
+					exifID, haveExif = id, true
+				}
+			}
+
+		case "iloc":
+			version := r.uint(1)
+			r.uint(3)
+			sizes := r.uint(1)
+			offsetSize, lengthSize := int(sizes>>4), int(sizes&15)
+			sizes = r.uint(1)
+			baseSize, indexSize := int(sizes>>4), int(sizes&15)
+			if version == 0 {
+				indexSize = 0
+			}
+			var count uint64
+			if version < 2 {
+				count = r.uint(2)
+			} else {
+				count = r.uint(4)
+			}
+			for i := uint64(0); i < count && r.err == nil; i++ {
+				var id uint64
+				if version < 2 {
+					id = r.uint(2)
+				} else {
+					id = r.uint(4)
+				}
+				var it item
+				if version >= 1 {
+					it.method = int(r.uint(2) & 15)
+				}
+				r.uint(2) // data reference index
+				base := r.uint(baseSize)
+				extents := r.uint(2)
+				for j := uint64(0); j < extents && r.err == nil; j++ {
+					r.uint(indexSize)
+					offset := r.uint(offsetSize)
+					length := r.uint(lengthSize)
+					it.extents = append(it.extents, [2]uint64{base + offset, length})
+				}
+				items[id] = it
+			}
+
+		case "idat":
+			idat = b.data
+
+		case "iprp":
+			for _, child := range children(b.data) {
+				switch child.typ {
+				case "ipco":
+					properties = children(child.data)
+				case "ipma":
+					p := &reader{data: child.data}
+					version := p.uint(1)
+					flags := p.uint(3)
+					count := p.uint(4)
+					for i := uint64(0); i < count && p.err == nil; i++ {
+						var id uint64
+						if version < 1 {
+							id = p.uint(2)
+						} else {
+							id = p.uint(4)
+						}
+						n := p.uint(1)
+						for j := uint64(0); j < n && p.err == nil; j++ {
+							var index uint64
+							if flags&1 != 0 {
+								index = p.uint(2) & 0x7FFF
+							} else {
+								index = p.uint(1) & 0x7F
+							}
+							associations[id] = append(associations[id], int(index))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	info := &Info{}
+	var cropWidth, cropHeight int
+	rotated := false
+	for _, index := range associations[primary] {
+		if index < 1 || index > len(properties) {
+			continue
+		}
+		prop := properties[index-1]
+		switch prop.typ {
+		case "ispe":
+			r := &reader{data: prop.data}
+			r.uint(4)
+			width, height := r.uint(4), r.uint(4)
+			if r.err == nil {
+				info.Width, info.Height = int(width), int(height)
+			}
+		case "clap":
+			// The clean aperture crops the image; its size is a fraction
+			r := &reader{data: prop.data}
+			widthN, widthD := r.uint(4), r.uint(4)
+			heightN, heightD := r.uint(4), r.uint(4)
+			if r.err == nil && widthD != 0 && heightD != 0 {
+				cropWidth = int((widthN + widthD/2) / widthD)
+				cropHeight = int((heightN + heightD/2) / heightD)
+			}
+		case "irot":
+			if len(prop.data) > 0 && prop.data[0]&1 == 1 {
+				rotated = true // 90 or 270 degrees
+			}
+		case "colr":
+			if len(prop.data) > 4 && info.ICC == nil {
+				if kind := string(prop.data[:4]); kind == "prof" || kind == "rICC" {
+					info.ICC = prop.data[4:]
+				}
+			}
+		}
+	}
+	if cropWidth > 0 && cropHeight > 0 && cropWidth <= info.Width && cropHeight <= info.Height {
+		info.Width, info.Height = cropWidth, cropHeight
+	}
+	if rotated {
+		info.Width, info.Height = info.Height, info.Width
+	}
+	if info.Width == 0 || info.Height == 0 {
+		return nil, errors.New("heif: primary image has no size")
+	}
+
+	if haveExif {
+		if data, err := readItem(f, fileSize, items[exifID], idat); err == nil && len(data) > 4 {
+			// The block starts with the offset of the TIFF header
+			skip := 4 + int(binary.BigEndian.Uint32(data))
+			if skip < len(data) {
+				tiff := data[skip:]
+				if i := bytes.Index(tiff, []byte("Exif\x00\x00")); i == 0 {
+					tiff = tiff[6:]
+				}
+				info.EXIF = tiff
+			}
+		}
+	}
+	return info, nil
+}
+
+// readItem returns the data of an item stored in a file of fileSize bytes
+func readItem(f io.ReaderAt, fileSize uint64, it item, idat []byte) ([]byte, error) {
+	var data []byte
+	for _, extent := range it.extents {
+		offset, length := extent[0], extent[1]
+		if length > maxMetaSize {
+			return nil, fmt.Errorf("heif: item of %d bytes too large", length)
+		}
+		switch it.method {
+		case 0:
+			// Written so that a huge offset can't wrap around
+			if offset > fileSize || length > fileSize-offset {
+				return nil, errors.New("heif: item outside file")
+			}
+			buf := make([]byte, length)
+			if _, err := f.ReadAt(buf, int64(offset)); err != nil {
+				return nil, err
+			}
+			data = append(data, buf...)
+		case 1:
+			if offset > uint64(len(idat)) || length > uint64(len(idat))-offset {
+				return nil, errors.New("heif: item outside idat")
+			}
+			data = append(data, idat[offset:offset+length]...)
+		default:
+			return nil, errors.New("heif: unsupported item construction")
+		}
+	}
+	return data, nil
+}
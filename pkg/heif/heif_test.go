@@ -0,0 +1,168 @@
+package heif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeBox builds a box from its type and payload parts
+func makeBox(typ string, parts ...[]byte) []byte {
+	payload := bytes.Join(parts, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(out, typ...), payload...)
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+func TestRead(t *testing.T) {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x00")
+	exifItem := append(u32(0), tiff...)
+	fullBox := []byte{0, 0, 0, 0}
+
+	meta := makeBox("meta", fullBox,
+		makeBox("pitm", fullBox, u16(1)),
+		makeBox("iinf", fullBox, u16(2),
+			makeBox("infe", []byte{2, 0, 0, 0}, u16(1), u16(0), []byte("hvc1\x00")),
+			makeBox("infe", []byte{2, 0, 0, 0}, u16(2), u16(0), []byte("Exif\x00")),
+		),
+		// version 1, 4-byte offsets and lengths, no base offset
+		makeBox("iloc", []byte{1, 0, 0, 0}, []byte{0x44, 0x00}, u16(1),
+			u16(2), u16(1), u16(0), u16(1), u32(0), u32(uint32(len(exifItem))),
+		),
+		makeBox("iprp",
+			makeBox("ipco",
+				makeBox("ispe", fullBox, u32(4032), u32(3024)),
+				makeBox("irot", []byte{1}),
+				makeBox("colr", []byte("prof"), []byte("profile")),
+			),
+			makeBox("ipma", fullBox, u32(1), u16(1), []byte{3, 0x81, 0x02, 0x83}),
+		),
+		makeBox("idat", exifItem),
+	)
+	file := append(makeBox("ftyp", []byte("heic"), u32(0), []byte("mif1heic")), meta...)
+
+	path := filepath.Join(t.TempDir(), "photo.heic")
+	if err := os.WriteFile(path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if info.Width != 3024 || info.Height != 4032 {
+		t.Errorf("size = %dx%d, want 3024x4032 after rotation", info.Width, info.Height)
+	}
+	if string(info.ICC) != "profile" {
+		t.Errorf("ICC = %q, want %q", info.ICC, "profile")
+	}
+	if !bytes.Equal(info.EXIF, tiff) {
+		t.Errorf("EXIF = %q, want %q", info.EXIF, tiff)
+	}
+}
+
+func TestReadAppliesCleanAperture(t *testing.T) {
+	fullBox := []byte{0, 0, 0, 0}
+	meta := makeBox("meta", fullBox,
+		makeBox("pitm", fullBox, u16(1)),
+		makeBox("iprp",
+			makeBox("ipco",
+				makeBox("ispe", fullBox, u32(4032), u32(3024)),
+				// 4000x3001/2, centered
+				makeBox("clap", u32(4000), u32(1), u32(3001), u32(2), u32(0), u32(1), u32(0), u32(1)),
+				makeBox("irot", []byte{1}),
+			),
+			makeBox("ipma", fullBox, u32(1), u16(1), []byte{3, 0x81, 0x82, 0x83}),
+		),
+	)
+	file := append(makeBox("ftyp", []byte("heic"), u32(0), []byte("mif1heic")), meta...)
+
+	path := filepath.Join(t.TempDir(), "photo.heic")
+	if err := os.WriteFile(path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if info.Width != 1501 || info.Height != 4000 {
+		t.Errorf("size = %dx%d, want 1501x4000 after cropping and rotation", info.Width, info.Height)
+	}
+}
+
+func TestReadRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.heic")
+	if err := os.WriteFile(path, []byte("\xff\xd8\xff\xe0 not a heif file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); err == nil {
+		t.Error("Read accepted a JPEG")
+	}
+}
+
+func TestReadRejectsBadBoxSizes(t *testing.T) {
+	ftyp := "\x00\x00\x00\x10ftypheic\x00\x00\x00\x00"
+	for name, data := range map[string]string{
+		"meta smaller than its header": ftyp + "\x00\x00\x00\x04meta",
+		"negative 64-bit meta size":    ftyp + "\x00\x00\x00\x01meta\xff\xff\xff\xff\xff\xff\xff\xf0",
+		"64-bit size under the header": ftyp + "\x00\x00\x00\x01free\x00\x00\x00\x00\x00\x00\x00\x08",
+	} {
+		path := filepath.Join(t.TempDir(), "photo.heic")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Read(path); err == nil {
+			t.Errorf("%s: Read succeeded", name)
+		}
+	}
+}
+
+func TestReadIgnoresItemsOutOfBounds(t *testing.T) {
+	fullBox := []byte{0, 0, 0, 0}
+	idat := bytes.Repeat([]byte{0}, 16)
+	for name, extent := range map[string]struct {
+		method         uint16
+		offset, length uint64
+	}{
+		"idat offset wraps around": {1, 1<<64 - 8, 16},
+		"idat past the end":        {1, 8, 16},
+		"file offset wraps around": {0, 1<<64 - 8, 16},
+		"file past the end":        {0, 1 << 20, 16},
+	} {
+		meta := makeBox("meta", fullBox,
+			makeBox("pitm", fullBox, u16(1)),
+			makeBox("iinf", fullBox, u16(1),
+				makeBox("infe", []byte{2, 0, 0, 0}, u16(2), u16(0), []byte("Exif\x00")),
+			),
+			// version 1, 8-byte offsets and lengths, no base offset
+			makeBox("iloc", []byte{1, 0, 0, 0}, []byte{0x88, 0x00}, u16(1),
+				u16(2), u16(extent.method), u16(0), u16(1),
+				binary.BigEndian.AppendUint64(nil, extent.offset),
+				binary.BigEndian.AppendUint64(nil, extent.length),
+			),
+			makeBox("iprp",
+				makeBox("ipco", makeBox("ispe", fullBox, u32(640), u32(480))),
+				makeBox("ipma", fullBox, u32(1), u16(1), []byte{1, 0x81}),
+			),
+			makeBox("idat", idat),
+		)
+		file := append(makeBox("ftyp", []byte("heic"), u32(0), []byte("mif1heic")), meta...)
+
+		path := filepath.Join(t.TempDir(), "photo.heic")
+		if err := os.WriteFile(path, file, 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := Read(path)
+		if err != nil {
+			t.Errorf("%s: Read: %v", name, err)
+			continue
+		}
+		if info.EXIF != nil {
+			t.Errorf("%s: EXIF = %q, want none", name, info.EXIF)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package image
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Adjustments are non-destructive tonal changes to a photo, applied after
+// its Edit and before it is resized. Zero values leave the photo as it is.
+type Adjustments struct {
+	Gamma      float64 `json:"gamma,omitempty"`      // midtone brightness: above 1 lightens, below darkens; 0 or 1 for none
+	Brightness float64 `json:"brightness,omitempty"` // percent, -100 to 100
+	Contrast   float64 `json:"contrast,omitempty"`   // percent, -100 to 100
+	Saturation float64 `json:"saturation,omitempty"` // percent, -100 (gray) to 500
+	Grayscale  bool    `json:"grayscale,omitempty"`  // black and white
+}
+
+// NewAdjustments builds adjustments from stored values, limiting each to
+// the range it accepts
+func NewAdjustments(gamma, brightness, contrast, saturation float64, grayscale bool) Adjustments {
+	if gamma == 1 || gamma <= 0 {
+		gamma = 0
+	}
+	return Adjustments{
+		Gamma:      math.Min(gamma, 10),
+		Brightness: math.Max(-100, math.Min(100, brightness)),
+		Contrast:   math.Max(-100, math.Min(100, contrast)),
+		Saturation: math.Max(-100, math.Min(500, saturation)),
+		Grayscale:  grayscale,
+	}
+}
+
+// IsZero reports whether the adjustments leave photos as they are
+func (a Adjustments) IsZero() bool {
+	return a == Adjustments{}
+}
+
+// Apply returns the adjusted image. Gamma goes first, like exposure in a raw
+// converter, and grayscale last, so saturation has no effect with it.
+func (a Adjustments) Apply(img image.Image) image.Image {
+	if a.Gamma != 0 {
+		img = imaging.AdjustGamma(img, a.Gamma)
+	}
+	if a.Brightness != 0 {
+		img = imaging.AdjustBrightness(img, a.Brightness)
+	}
+	if a.Contrast != 0 {
+		img = imaging.AdjustContrast(img, a.Contrast)
+	}
+	if a.Grayscale {
+		return imaging.Grayscale(img)
+	}
+	if a.Saturation != 0 {
+		img = imaging.AdjustSaturation(img, a.Saturation)
+	}
+	return img
+}
@@ -0,0 +1,36 @@
+package image
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestNewAdjustments(t *testing.T) {
+	adj := NewAdjustments(1, -150, 30, 900, false)
+	if adj.Gamma != 0 || adj.Brightness != -100 || adj.Contrast != 30 || adj.Saturation != 500 {
+		t.Errorf("NewAdjustments = %+v, want no gamma and values clamped", adj)
+	}
+	if !NewAdjustments(0, 0, 0, 0, false).IsZero() || NewAdjustments(0, 0, 0, 0, true).IsZero() {
+		t.Error("IsZero should only hold for no adjustments")
+	}
+}
+
+func TestAdjustmentsApply(t *testing.T) {
+	img := imaging.New(10, 10, color.NRGBA{200, 100, 50, 255})
+
+	gray := imaging.Clone(NewAdjustments(0, 0, 0, 0, true).Apply(img)).NRGBAAt(5, 5)
+	if gray.R != gray.G || gray.G != gray.B {
+		t.Errorf("grayscale pixel = %v", gray)
+	}
+
+	brighter := imaging.Clone(NewAdjustments(1.5, 20, 0, 0, false).Apply(img)).NRGBAAt(5, 5)
+	if brighter.G <= 100 || brighter.B <= 50 {
+		t.Errorf("brightened pixel = %v, want lighter than the original", brighter)
+	}
+
+	if got := NewAdjustments(0, 0, 0, 0, false).Apply(img); got != img {
+		t.Error("no adjustments should return the image untouched")
+	}
+}
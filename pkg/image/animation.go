@@ -0,0 +1,181 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// IsAnimated reports whether the file at path is a GIF with more than one
+// frame
+func IsAnimated(sourcePath string) bool {
+	if strings.ToLower(filepath.Ext(sourcePath)) != ".gif" {
+		return false
+	}
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	anim, err := gif.DecodeAll(f)
+	return err == nil && len(anim.Image) > 1
+}
+
+// ProcessAnimation writes moving renditions of an animated GIF for every
+// size ProcessImage writes stills for. With ffmpeg installed they are muted
+// MP4 videos, which are far smaller; otherwise the GIF is resized frame by
+// frame.
+func (p *Processor) ProcessAnimation(sourcePath, albumID, photoID string) ([]Rendition, error) {
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	format := animationFormat()
+
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	config, err := gif.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	thumbDir := filepath.Join(p.outputPath, "static", "thumbs", albumID)
+	if err := os.MkdirAll(thumbDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var anim *gif.GIF
+	var renditions []Rendition
+	for i, size := range p.sizes {
+		width, height, larger := size.Dimensions(config.Width, config.Height)
+		if !larger && i > 0 {
+			continue
+		}
+		if format == FormatMP4 {
+			// H.264 needs even dimensions
+			width, height = max(width&^1, 2), max(height&^1, 2)
+		}
+
+		outPath := formatPath(filepath.Join(thumbDir, fmt.Sprintf("%s_%s.jpg", photoID, size.Name)), format)
+		outInfo, err := os.Stat(outPath)
+		if err != nil || p.regenerate || outInfo.ModTime().Before(sourceInfo.ModTime()) {
+			if format == FormatMP4 {
+				err = encodeMP4(sourcePath, outPath, width, height)
+			} else {
+				if anim == nil {
+					if anim, err = decodeGIF(sourcePath); err != nil {
+						return nil, err
+					}
+				}
+				err = writeGIF(outPath, resizeGIF(anim, width, height))
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		renditions = append(renditions, Rendition{
+			Size:   size.Name,
+			Format: format,
+			Path:   path.Join("/static/thumbs", albumID, fmt.Sprintf("%s_%s%s", photoID, size.Name, formatInfo[format].ext)),
+			Width:  width,
+			Height: height,
+		})
+	}
+	return renditions, nil
+}
+
+// animationFormat returns the format of moving renditions: MP4 when ffmpeg
+// is installed to encode it, GIF otherwise
+func animationFormat() string {
+	if _, err := exec.LookPath("ffmpeg"); err == nil {
+		return FormatMP4
+	}
+	return FormatGIF
+}
+
+// encodeMP4 converts a GIF to a silent H.264 video that starts playing
+// before it has fully downloaded. Looping is up to the page.
+func encodeMP4(in, out string, width, height int) error {
+	cmd := exec.Command("ffmpeg", "-y", "-loglevel", "error", "-i", in,
+		"-vf", fmt.Sprintf("scale=%d:%d:flags=lanczos", width, height),
+		"-an", "-pix_fmt", "yuv420p", "-movflags", "+faststart", out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(out)
+		return fmt.Errorf("ffmpeg failed to write %s: %v: %s", out, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func decodeGIF(sourcePath string) (*gif.GIF, error) {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return gif.DecodeAll(f)
+}
+
+// resizeGIF scales every frame of an animation. Frames may only cover part
+// of the canvas, so each is composed onto the canvas as a viewer would show
+// it, then the whole canvas is scaled and mapped back to the frame's palette.
+func resizeGIF(anim *gif.GIF, width, height int) *gif.GIF {
+	bounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	canvas := image.NewNRGBA(bounds)
+	out := &gif.GIF{
+		Delay:     anim.Delay,
+		LoopCount: anim.LoopCount,
+	}
+
+	for i, frame := range anim.Image {
+		var previous *image.NRGBA
+		disposal := byte(0)
+		if i < len(anim.Disposal) {
+			disposal = anim.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = imaging.Clone(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		scaled := imaging.Resize(canvas, width, height, imaging.Lanczos)
+		paletted := image.NewPaletted(image.Rect(0, 0, width, height), frame.Palette)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), scaled, image.Point{})
+		out.Image = append(out.Image, paletted)
+		out.Disposal = append(out.Disposal, gif.DisposalNone)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return out
+}
+
+func writeGIF(outPath string, anim *gif.GIF) error {
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(f, anim); err != nil {
+		f.Close()
+		os.Remove(outPath)
+		return err
+	}
+	return f.Close()
+}
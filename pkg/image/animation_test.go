@@ -0,0 +1,96 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessAnimationResizesFrames(t *testing.T) {
+	t.Setenv("PATH", "") // no ffmpeg, so frames are resized as GIF
+
+	palette := color.Palette{color.Black, color.White, color.RGBA{255, 0, 0, 255}}
+	anim := &gif.GIF{LoopCount: 0}
+	for i := 0; i < 3; i++ {
+		// Later frames only cover part of the canvas
+		bounds := image.Rect(0, 0, 900, 600)
+		if i > 0 {
+			bounds = image.Rect(100*i, 100, 100*i+200, 300)
+		}
+		frame := image.NewPaletted(bounds, palette)
+		for j := range frame.Pix {
+			frame.Pix[j] = uint8(i % len(palette))
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "spinner.gif")
+	f, err := os.Create(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.EncodeAll(f, anim); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if !IsAnimated(source) {
+		t.Fatal("IsAnimated = false for a three-frame GIF")
+	}
+
+	p := NewProcessor(filepath.Join(dir, "out"))
+	renditions, err := p.ProcessAnimation(source, "album", "spinner")
+	if err != nil {
+		t.Fatalf("ProcessAnimation: %v", err)
+	}
+
+	// small (400) and medium (800) fit, large and full would upscale
+	if len(renditions) != 2 {
+		t.Fatalf("got %d renditions, want 2: %+v", len(renditions), renditions)
+	}
+	medium := renditions[1]
+	if medium.Format != FormatGIF || medium.Width != 800 || medium.Height != 533 {
+		t.Errorf("medium rendition = %+v, want an 800x533 GIF", medium)
+	}
+
+	out, err := os.Open(filepath.Join(dir, "out", "static", "thumbs", "album", "spinner_medium.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	resized, err := gif.DecodeAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resized.Image) != 3 {
+		t.Errorf("resized GIF has %d frames, want 3", len(resized.Image))
+	}
+	for i, frame := range resized.Image {
+		if b := frame.Bounds(); b.Dx() != 800 || b.Dy() != 533 {
+			t.Errorf("frame %d is %dx%d, want 800x533", i, b.Dx(), b.Dy())
+		}
+	}
+}
+
+func TestSettingsTrackAnimationFormat(t *testing.T) {
+	p := NewProcessor(t.TempDir())
+
+	t.Setenv("PATH", "")
+	withoutFFmpeg := p.Settings()
+
+	// Installing ffmpeg turns the GIF renditions into MP4s
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	if p.Settings() == withoutFFmpeg {
+		t.Error("Settings unchanged after ffmpeg was installed")
+	}
+}
@@ -0,0 +1,152 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Crop is a fixed aspect ratio for cropped renditions, for themes that show
+// photos in uniform cards
+type Crop struct {
+	Name   string // as configured, e.g. "square" or "4:3"
+	Width  int    // the aspect ratio, e.g. 4 and 3
+	Height int
+}
+
+// ParseCrop reads a crop name: "square" or a width:height ratio such as
+// "4:3" or "16:9"
+func ParseCrop(name string) (Crop, error) {
+	if name == "square" {
+		return Crop{Name: name, Width: 1, Height: 1}, nil
+	}
+	w, h, ok := strings.Cut(name, ":")
+	if ok {
+		width, errW := strconv.Atoi(w)
+		height, errH := strconv.Atoi(h)
+		if errW == nil && errH == nil && width > 0 && height > 0 {
+			return Crop{Name: name, Width: width, Height: height}, nil
+		}
+	}
+	return Crop{}, fmt.Errorf("crop %q is neither \"square\" nor a ratio like \"4:3\"", name)
+}
+
+// slug returns the crop's name as used in file names, e.g. 4x3
+func (c Crop) slug() string {
+	return strings.ReplaceAll(c.Name, ":", "x")
+}
+
+// FocalPoint is the part of a photo that crops keep in view, as fractions of
+// the displayed width and height measured from the top left
+type FocalPoint struct {
+	X float64
+	Y float64
+}
+
+// cropDimensions returns the size of a crop rendered at s: the size's long
+// edge bounds the crop's long edge, or its width the crop's width
+func (s Size) cropDimensions(c Crop) (int, int) {
+	if s.Width > 0 || c.Width >= c.Height {
+		width := s.Width
+		if width == 0 {
+			width = s.LongEdge
+		}
+		return width, max(width*c.Height/c.Width, 1)
+	}
+	return max(s.LongEdge*c.Width/c.Height, 1), s.LongEdge
+}
+
+// cropRect returns the largest region of a w×h image with the crop's aspect
+// ratio, centred on the focal point as far as the edges allow
+func cropRect(w, h int, c Crop, focus FocalPoint) image.Rectangle {
+	cw, ch := w, w*c.Height/c.Width
+	if ch > h {
+		cw, ch = h*c.Width/c.Height, h
+	}
+	x := clamp(int(focus.X*float64(w))-cw/2, 0, w-cw)
+	y := clamp(int(focus.Y*float64(h))-ch/2, 0, h-ch)
+	return image.Rect(x, y, x+cw, y+ch)
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// energySize is the long edge of the copy smart crops are measured on
+const energySize = 256
+
+// energyMap sums the edge energy of a downscaled grayscale copy of an image
+// per column and per row. Busy, detailed regions have high energy while sky,
+// walls and blurred backgrounds have little, so a crop placed where the
+// energy is highest tends to keep the subject.
+type energyMap struct {
+	scale float64   // source pixels per map pixel
+	cols  []float64 // energy per column
+	rows  []float64 // energy per row
+}
+
+func newEnergyMap(img image.Image) *energyMap {
+	small := imaging.Grayscale(imaging.Fit(img, energySize, energySize, imaging.Box))
+	bounds := small.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	m := &energyMap{
+		scale: float64(img.Bounds().Dx()) / float64(w),
+		cols:  make([]float64, w),
+		rows:  make([]float64, h),
+	}
+
+	gray := func(x, y int) float64 { return float64(small.Pix[y*small.Stride+x*4]) }
+	for y := 0; y < h-1; y++ {
+		for x := 0; x < w-1; x++ {
+			v := gray(x, y)
+			e := abs(gray(x+1, y)-v) + abs(gray(x, y+1)-v)
+			m.cols[x] += e
+			m.rows[y] += e
+		}
+	}
+	return m
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// focalPoint returns the centre of the crop's window with the most energy.
+// Crops span the image in one direction, so the window only slides along
+// the other.
+func (m *energyMap) focalPoint(w, h int, c Crop) FocalPoint {
+	rect := cropRect(w, h, c, FocalPoint{0.5, 0.5})
+	if rect.Dx() < w {
+		x := bestWindow(m.cols, int(float64(rect.Dx())/m.scale))
+		return FocalPoint{X: (float64(x)*m.scale + float64(rect.Dx())/2) / float64(w), Y: 0.5}
+	}
+	y := bestWindow(m.rows, int(float64(rect.Dy())/m.scale))
+	return FocalPoint{X: 0.5, Y: (float64(y)*m.scale + float64(rect.Dy())/2) / float64(h)}
+}
+
+// bestWindow returns the start of the window of n values with the largest
+// sum. Ties go to the window nearest the centre.
+func bestWindow(values []float64, n int) int {
+	if n <= 0 || n >= len(values) {
+		return 0
+	}
+	var sum float64
+	for _, v := range values[:n] {
+		sum += v
+	}
+	best, bestSum := 0, sum
+	centre := (len(values) - n) / 2
+	for start := 1; start+n <= len(values); start++ {
+		sum += values[start+n-1] - values[start-1]
+		if sum > bestSum || (sum == bestSum && abs(float64(start-centre)) < abs(float64(best-centre))) {
+			best, bestSum = start, sum
+		}
+	}
+	return best
+}
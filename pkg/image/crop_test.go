@@ -0,0 +1,115 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestParseCrop(t *testing.T) {
+	for name, want := range map[string]Crop{
+		"square": {Name: "square", Width: 1, Height: 1},
+		"4:3":    {Name: "4:3", Width: 4, Height: 3},
+		"16:9":   {Name: "16:9", Width: 16, Height: 9},
+	} {
+		got, err := ParseCrop(name)
+		if err != nil || got != want {
+			t.Errorf("ParseCrop(%q) = %+v, %v, want %+v", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"", "wide", "4:0", "4x3", "-1:2"} {
+		if _, err := ParseCrop(name); err == nil {
+			t.Errorf("ParseCrop(%q) succeeded", name)
+		}
+	}
+}
+
+func TestCropRect(t *testing.T) {
+	square := Crop{Name: "square", Width: 1, Height: 1}
+	tests := []struct {
+		focus FocalPoint
+		want  image.Rectangle
+	}{
+		{FocalPoint{0.5, 0.5}, image.Rect(150, 0, 750, 600)},
+		{FocalPoint{0.1, 0.5}, image.Rect(0, 0, 600, 600)},   // held inside the left edge
+		{FocalPoint{0.9, 0.2}, image.Rect(300, 0, 900, 600)}, // and the right
+		{FocalPoint{0.6, 0.5}, image.Rect(240, 0, 840, 600)},
+	}
+	for _, tt := range tests {
+		if got := cropRect(900, 600, square, tt.focus); got != tt.want {
+			t.Errorf("cropRect(900x600, square, %+v) = %v, want %v", tt.focus, got, tt.want)
+		}
+	}
+
+	wide := Crop{Name: "16:9", Width: 16, Height: 9}
+	if got, want := cropRect(600, 900, wide, FocalPoint{0.5, 0.1}), image.Rect(0, 0, 600, 337); got != want {
+		t.Errorf("cropRect(600x900, 16:9) = %v, want %v", got, want)
+	}
+}
+
+func TestSmartCropFindsDetail(t *testing.T) {
+	// A flat image with a checkerboard near its right edge
+	img := imaging.New(1200, 600, color.NRGBA{90, 120, 200, 255})
+	for y := 200; y < 400; y++ {
+		for x := 950; x < 1150; x++ {
+			if (x/10+y/10)%2 == 0 {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+
+	square := Crop{Name: "square", Width: 1, Height: 1}
+	focus := newEnergyMap(img).focalPoint(1200, 600, square)
+	rect := cropRect(1200, 600, square, focus)
+	if rect.Min.X > 950 || rect.Max.X < 1150 {
+		t.Errorf("smart crop %v misses the detail at x 950-1150", rect)
+	}
+}
+
+func TestProcessImageCrops(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "beach.jpg")
+	if err := imaging.Save(imaging.New(1200, 800, color.NRGBA{200, 180, 120, 255}), source); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProcessor(filepath.Join(dir, "out"))
+	p.SetSizes([]Size{{Name: "small", LongEdge: 400}, {Name: "medium", LongEdge: 800}})
+	p.SetCrops([]Crop{{Name: "square", Width: 1, Height: 1}, {Name: "16:9", Width: 16, Height: 9}})
+	renditions, err := p.ProcessImage(source, "album", "beach", PhotoOptions{FocalPoint: &FocalPoint{X: 0, Y: 0}})
+	if err != nil {
+		t.Fatalf("ProcessImage: %v", err)
+	}
+
+	// The square crop is only 800px wide, so medium leaves it out as it
+	// does full frames that would not shrink
+	want := map[string][2]int{
+		"small":        {400, 266},
+		"small/square": {400, 400},
+		"small/16:9":   {400, 225},
+		"medium":       {800, 533},
+		"medium/16:9":  {800, 450},
+	}
+	if len(renditions) != len(want) {
+		t.Fatalf("got %d renditions, want %d: %+v", len(renditions), len(want), renditions)
+	}
+	for _, r := range renditions {
+		key := r.Size
+		if r.Crop != "" {
+			key += "/" + r.Crop
+		}
+		if dims, ok := want[key]; !ok || r.Width != dims[0] || r.Height != dims[1] {
+			t.Errorf("unexpected rendition %+v", r)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "out", filepath.FromSlash(r.Path))); err != nil {
+			t.Errorf("rendition %s missing: %v", r.Path, err)
+		}
+	}
+	if thumbs := Thumbnails(renditions); thumbs["small"] != "/static/thumbs/album/beach_small.jpg" {
+		t.Errorf("Thumbnails = %v, want the full frame", thumbs)
+	}
+}
@@ -0,0 +1,148 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cjs/purtypics/pkg/heif"
+	"github.com/cjs/purtypics/pkg/raw"
+	"github.com/disintegration/imaging"
+)
+
+// heifDecoders are the commands that can convert HEIF images to PNG, in order
+// of preference. ffmpeg only assembles tiled HEIC images from version 7 on.
+var heifDecoders = []struct {
+	command string
+	args    func(in, out string) []string
+}{
+	{"heif-convert", func(in, out string) []string { return []string{in, out} }},
+	{"ffmpeg", func(in, out string) []string {
+		return []string{"-y", "-loglevel", "error", "-i", in, "-frames:v", "1", out}
+	}},
+}
+
+var (
+	heifOnce    sync.Once
+	heifDecoder = -1 // index into heifDecoders, -1 when none is installed
+)
+
+// HEIFDecoder returns the command used to decode HEIF images, or "" when
+// neither heif-convert nor ffmpeg is installed
+func HEIFDecoder() string {
+	heifOnce.Do(func() {
+		for i, candidate := range heifDecoders {
+			if _, err := exec.LookPath(candidate.command); err == nil {
+				heifDecoder = i
+				return
+			}
+		}
+	})
+	if heifDecoder < 0 {
+		return ""
+	}
+	return heifDecoders[heifDecoder].command
+}
+
+// Open decodes an image file with its orientation applied. HEIF images are
+// converted with an external decoder, see HEIFDecoder, and RAW files yield
+// their embedded JPEG preview.
+func Open(path string) (image.Image, error) {
+	switch {
+	case heif.IsHEIF(path):
+		return openHEIF(path)
+	case raw.IsRAW(path):
+		return openRAW(path)
+	}
+	return imaging.Open(path, imaging.AutoOrientation(true))
+}
+
+// openRAW decodes the largest JPEG preview of a RAW file. Previews rarely
+// carry their own orientation, so the RAW file's is applied.
+func openRAW(path string) (image.Image, error) {
+	info, err := raw.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := info.Preview()
+	if err != nil {
+		return nil, err
+	}
+	img, err := imaging.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding preview of %s: %w", filepath.Base(path), err)
+	}
+	return orient(img, info.Orientation), nil
+}
+
+// orient applies an EXIF orientation (1-8) to an image
+func orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// openHEIF converts a HEIF image to PNG and decodes that. The converters
+// apply the image's rotation, so its EXIF orientation is not applied again.
+func openHEIF(path string) (image.Image, error) {
+	command := HEIFDecoder()
+	if command == "" {
+		return nil, fmt.Errorf("cannot decode %s: install heif-convert (libheif) or ffmpeg for HEIC/HEIF support", filepath.Base(path))
+	}
+
+	tmpDir, err := os.MkdirTemp("", "purtypics-heif-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	out := filepath.Join(tmpDir, "image.png")
+	cmd := exec.Command(command, heifDecoders[heifDecoder].args(path, out)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed on %s: %v: %s", command, filepath.Base(path), err, strings.TrimSpace(string(output)))
+	}
+
+	// heif-convert numbers its output when a file holds several images,
+	// the primary one first
+	if _, err := os.Stat(out); err != nil {
+		if numbered, _ := filepath.Glob(filepath.Join(tmpDir, "image-*.png")); len(numbered) > 0 {
+			sort.Strings(numbered)
+			out = numbered[0]
+		}
+	}
+
+	img, err := imaging.Open(out)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decoders that don't understand image grids return a single tile
+	if info, err := heif.Read(path); err == nil {
+		bounds := img.Bounds()
+		if bounds.Dx() != info.Width || bounds.Dy() != info.Height {
+			return nil, fmt.Errorf("%s decoded %s as %dx%d instead of %dx%d; install heif-convert (libheif) for tiled HEIC images",
+				command, filepath.Base(path), bounds.Dx(), bounds.Dy(), info.Width, info.Height)
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,117 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// MaxStraighten is the largest straightening angle in degrees either way
+const MaxStraighten = 45
+
+// Edit is a non-destructive change to a photo's framing, applied after EXIF
+// orientation and before anything is resized or cropped to a size. Steps run
+// in the order of the fields: rotate, straighten, then crop.
+type Edit struct {
+	Rotate     int     `json:"rotate,omitempty"`     // clockwise degrees, a multiple of 90
+	Straighten float64 `json:"straighten,omitempty"` // clockwise degrees, within ±MaxStraighten
+	Crop       *Region `json:"crop,omitempty"`       // part to keep of the rotated photo, nil for all of it
+}
+
+// Region is a rectangle as fractions of an image's width and height,
+// measured from the top left
+type Region struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// NewEdit builds an edit from stored values, rounding the rotation to
+// quarter turns, limiting the straightening angle and clipping the crop to
+// the photo. A crop with no area is dropped.
+func NewEdit(rotate int, straighten float64, crop *Region) Edit {
+	edit := Edit{
+		Rotate:     ((int(math.Round(float64(rotate)/90))%4 + 4) % 4) * 90,
+		Straighten: math.Max(-MaxStraighten, math.Min(MaxStraighten, straighten)),
+	}
+	if crop != nil {
+		x0, y0 := clampUnit(crop.X), clampUnit(crop.Y)
+		x1, y1 := clampUnit(crop.X+crop.Width), clampUnit(crop.Y+crop.Height)
+		if x1 > x0 && y1 > y0 && (x0 > 0 || y0 > 0 || x1 < 1 || y1 < 1) {
+			edit.Crop = &Region{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}
+		}
+	}
+	return edit
+}
+
+func clampUnit(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// IsZero reports whether the edit leaves photos as they are
+func (e Edit) IsZero() bool {
+	return e.Rotate == 0 && e.Straighten == 0 && e.Crop == nil
+}
+
+// Apply returns the edited image
+func (e Edit) Apply(img image.Image) image.Image {
+	switch e.Rotate {
+	case 90:
+		img = imaging.Rotate270(img) // imaging turns counter-clockwise
+	case 180:
+		img = imaging.Rotate180(img)
+	case 270:
+		img = imaging.Rotate90(img)
+	}
+
+	if e.Straighten != 0 {
+		// Rotating leaves empty corners; keep the largest rectangle of the
+		// same shape that has none
+		w, h := img.Bounds().Dx(), img.Bounds().Dy()
+		sw, sh := straightenedSize(w, h, e.Straighten)
+		img = imaging.CropCenter(imaging.Rotate(img, -e.Straighten, color.Transparent), sw, sh)
+	}
+
+	if e.Crop != nil {
+		img = imaging.Crop(img, e.Crop.rect(img.Bounds().Dx(), img.Bounds().Dy()))
+	}
+	return img
+}
+
+// Dimensions returns the size of a w×h image after the edit
+func (e Edit) Dimensions(w, h int) (int, int) {
+	if e.Rotate == 90 || e.Rotate == 270 {
+		w, h = h, w
+	}
+	if e.Straighten != 0 {
+		w, h = straightenedSize(w, h, e.Straighten)
+	}
+	if e.Crop != nil {
+		r := e.Crop.rect(w, h)
+		w, h = r.Dx(), r.Dy()
+	}
+	return w, h
+}
+
+// straightenedSize returns the largest w×h-shaped rectangle that fits inside
+// a w×h image turned by degrees, less a pixel on each side where the turned
+// edges are blended with the empty corners
+func straightenedSize(w, h int, degrees float64) (int, int) {
+	a := math.Abs(degrees) * math.Pi / 180
+	sin, cos := math.Sin(a), math.Cos(a)
+	fw, fh := float64(w), float64(h)
+	scale := math.Min(fw/(fw*cos+fh*sin), fh/(fw*sin+fh*cos))
+	return max(1, int(fw*scale)-2), max(1, int(fh*scale)-2)
+}
+
+// rect returns the region's pixels in a w×h image, at least one pixel
+func (r Region) rect(w, h int) image.Rectangle {
+	x0 := min(int(math.Round(r.X*float64(w))), w-1)
+	y0 := min(int(math.Round(r.Y*float64(h))), h-1)
+	x1 := max(x0+1, int(math.Round((r.X+r.Width)*float64(w))))
+	y1 := max(y0+1, int(math.Round((r.Y+r.Height)*float64(h))))
+	return image.Rect(x0, y0, min(x1, w), min(y1, h))
+}
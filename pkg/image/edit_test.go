@@ -0,0 +1,66 @@
+package image
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestNewEdit(t *testing.T) {
+	edit := NewEdit(-90, 60, &Region{X: -0.1, Y: 0.5, Width: 0.6, Height: 0.8})
+	if edit.Rotate != 270 {
+		t.Errorf("Rotate = %d, want 270", edit.Rotate)
+	}
+	if edit.Straighten != MaxStraighten {
+		t.Errorf("Straighten = %v, want %v", edit.Straighten, MaxStraighten)
+	}
+	if c := edit.Crop; c == nil || c.X != 0 || c.Y != 0.5 || c.Width != 0.5 || c.Height != 0.5 {
+		t.Errorf("Crop = %+v, want clipped to 0,0.5 0.5×0.5", c)
+	}
+
+	if edit := NewEdit(360, 0, &Region{Width: 1, Height: 1}); !edit.IsZero() {
+		t.Errorf("full turn with a whole-photo crop = %+v, want no edit", edit)
+	}
+	if edit := NewEdit(0, 0, &Region{X: 0.5, Width: 0, Height: 1}); edit.Crop != nil {
+		t.Errorf("empty crop kept: %+v", edit.Crop)
+	}
+}
+
+func TestEditApply(t *testing.T) {
+	// A red mark in the top left corner of a landscape image
+	img := imaging.New(300, 200, color.NRGBA{255, 255, 255, 255})
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			img.Set(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+
+	// Turned clockwise, the mark ends up top right
+	rotated := imaging.Clone(NewEdit(90, 0, nil).Apply(img))
+	if b := rotated.Bounds(); b.Dx() != 200 || b.Dy() != 300 {
+		t.Fatalf("rotated size = %v, want 200×300", b.Size())
+	}
+	if c := rotated.NRGBAAt(195, 5); c.G != 0 {
+		t.Errorf("top right after turning clockwise = %v, want the red mark", c)
+	}
+
+	for _, edit := range []Edit{
+		NewEdit(0, 5, nil),
+		NewEdit(270, -12.5, nil),
+		NewEdit(180, 2, &Region{X: 0.25, Y: 0.1, Width: 0.5, Height: 0.3}),
+	} {
+		result := edit.Apply(img)
+		w, h := edit.Dimensions(300, 200)
+		if result.Bounds().Dx() != w || result.Bounds().Dy() != h {
+			t.Errorf("%+v: applied size %v, Dimensions %d×%d", edit, result.Bounds().Size(), w, h)
+		}
+		// Straightening crops away the transparent corners
+		nrgba := imaging.Clone(result)
+		for _, p := range [][2]int{{0, 0}, {w - 1, 0}, {0, h - 1}, {w - 1, h - 1}} {
+			if a := nrgba.NRGBAAt(p[0], p[1]).A; a != 255 {
+				t.Errorf("%+v: corner %v has alpha %d", edit, p, a)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Output formats
+const (
+	FormatJPEG = "jpeg"
+	FormatWebP = "webp"
+	FormatAVIF = "avif"
+	FormatGIF  = "gif" // animations, see ProcessAnimation
+	FormatMP4  = "mp4"
+)
+
+// formatInfo describes an output format
+var formatInfo = map[string]struct {
+	ext     string
+	mime    string
+	quality int // encoder quality; WebP and AVIF match JPEG at lower settings
+}{
+	FormatJPEG: {".jpg", "image/jpeg", 0},
+	FormatWebP: {".webp", "image/webp", 82},
+	FormatAVIF: {".avif", "image/avif", 60},
+	FormatGIF:  {".gif", "image/gif", 0},
+	FormatMP4:  {".mp4", "video/mp4", 0},
+}
+
+// FormatMIME returns the MIME type of an output format
+func FormatMIME(format string) string {
+	return formatInfo[format].mime
+}
+
+// encoder runs an external program that converts a PNG to another format
+type encoder struct {
+	command string
+	args    func(in, out string, quality int) []string
+}
+
+// encoders lists the programs that can write each format, preferred first.
+// ffmpeg only qualifies when it was built with the named library.
+var encoders = map[string][]struct {
+	encoder
+	ffmpegLib string
+}{
+	FormatWebP: {
+		{encoder{"cwebp", func(in, out string, q int) []string {
+			return []string{"-quiet", "-q", fmt.Sprint(q), in, "-o", out}
+		}}, ""},
+		{encoder{"ffmpeg", func(in, out string, q int) []string {
+			return []string{"-y", "-loglevel", "error", "-i", in, "-c:v", "libwebp", "-quality", fmt.Sprint(q), out}
+		}}, "libwebp"},
+	},
+	FormatAVIF: {
+		{encoder{"avifenc", func(in, out string, q int) []string {
+			return []string{"-q", fmt.Sprint(q), in, out}
+		}}, ""},
+		{encoder{"ffmpeg", func(in, out string, q int) []string {
+			crf := 63 - q*63/100
+			return []string{"-y", "-loglevel", "error", "-i", in, "-c:v", "libaom-av1", "-still-picture", "1",
+				"-crf", fmt.Sprint(crf), "-pix_fmt", "yuv420p", out}
+		}}, "libaom-av1"},
+	},
+}
+
+var (
+	ffmpegOnce     sync.Once
+	ffmpegEncoders string
+)
+
+// ffmpegHas reports whether the installed ffmpeg has the named encoder
+func ffmpegHas(lib string) bool {
+	ffmpegOnce.Do(func() {
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			return
+		}
+		out, err := exec.Command("ffmpeg", "-hide_banner", "-encoders").Output()
+		if err == nil {
+			ffmpegEncoders = string(out)
+		}
+	})
+	return strings.Contains(ffmpegEncoders, " "+lib+" ")
+}
+
+// findEncoder returns an installed encoder for a format
+func findEncoder(format string) (encoder, bool) {
+	for _, candidate := range encoders[format] {
+		if _, err := exec.LookPath(candidate.command); err != nil {
+			continue
+		}
+		if candidate.ffmpegLib != "" && !ffmpegHas(candidate.ffmpegLib) {
+			continue
+		}
+		return candidate.encoder, true
+	}
+	return encoder{}, false
+}
+
+// SetFormats sets the formats written besides JPEG for every size. Formats
+// without an installed encoder are left out and returned.
+func (p *Processor) SetFormats(formats []string) (unavailable []string) {
+	p.formats = nil
+	p.encoders = make(map[string]encoder)
+	for _, format := range formats {
+		format = strings.ToLower(format)
+		if format == FormatJPEG || p.encoders[format].command != "" {
+			continue
+		}
+		enc, ok := findEncoder(format)
+		if !ok {
+			unavailable = append(unavailable, format)
+			continue
+		}
+		p.encoders[format] = enc
+		p.formats = append(p.formats, format)
+	}
+	return unavailable
+}
+
+// encodeFormats writes img in every extra format next to jpegPath. The image
+// goes to the encoders as a lossless PNG.
+func (p *Processor) encodeFormats(img image.Image, jpegPath string) error {
+	if len(p.formats) == 0 {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp("", "purtypics-*.png")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(tmp, img); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	for _, format := range p.formats {
+		enc := p.encoders[format]
+		out := formatPath(jpegPath, format)
+		cmd := exec.Command(enc.command, enc.args(tmp.Name(), out, formatInfo[format].quality)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			os.Remove(out)
+			return fmt.Errorf("%s failed to write %s: %v: %s", enc.command, out, err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// formatPath returns the path of the rendition in format that sits next to
+// the given JPEG rendition
+func formatPath(jpegPath, format string) string {
+	return strings.TrimSuffix(jpegPath, ".jpg") + formatInfo[format].ext
+}
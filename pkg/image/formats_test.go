@@ -0,0 +1,50 @@
+package image
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessImageSkipsFormatsForUnconvertibleProfiles(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+
+	// A profile newColorTransform can't read, so the pixels stay in it
+	profile := make([]byte, 132)
+	copy(profile[16:], "GRAYXYZ ")
+	plain := filepath.Join(dir, "plain.jpg")
+	tagged := filepath.Join(dir, "tagged.jpg")
+	if err := saveJPEG(plain, img, 90, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveJPEG(tagged, img, 90, nil, profile); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProcessor(filepath.Join(dir, "out"))
+	p.formats = []string{FormatWebP}
+	p.encoders = map[string]encoder{FormatWebP: {command: "cp", args: func(in, out string, quality int) []string {
+		return []string{in, out}
+	}}}
+
+	for name, want := range map[string]bool{plain: true, tagged: false} {
+		id := filepath.Base(name)
+		renditions, err := p.ProcessImage(name, "album", id, PhotoOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		webp := false
+		for _, r := range renditions {
+			webp = webp || r.Format == FormatWebP
+		}
+		if webp != want {
+			t.Errorf("%s: WebP renditions = %v, want %v", id, webp, want)
+		}
+		_, err = os.Stat(filepath.Join(dir, "out", "static", "thumbs", "album", id+"_small.webp"))
+		if (err == nil) != want {
+			t.Errorf("%s: WebP file written = %v, want %v", id, err == nil, want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package image
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"math"
+)
+
+// xyzToSRGB converts D50 XYZ, the ICC profile connection space, to linear
+// sRGB. It includes the Bradford adaptation from D50 to D65.
+var xyzToSRGB = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+// colorTransform converts pixels from an RGB profile's color space to sRGB
+type colorTransform struct {
+	toLinear [3][256]float64 // per-channel tone curves of the source profile
+	matrix   [3][3]float64   // source linear RGB -> linear sRGB
+	toSRGB   [4096]uint8     // linear sRGB -> sRGB-encoded 8-bit
+}
+
+// newColorTransform builds a transform from a matrix/TRC RGB profile, the kind
+// cameras and editors embed (sRGB, Display P3, Adobe RGB). LUT-based, gray
+// and CMYK profiles are not supported.
+func newColorTransform(profile []byte) (*colorTransform, error) {
+	if len(profile) < 132 {
+		return nil, errors.New("ICC profile too short")
+	}
+	if string(profile[16:20]) != "RGB " || string(profile[20:24]) != "XYZ " {
+		return nil, errors.New("ICC profile is not an RGB profile with an XYZ connection space")
+	}
+
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(profile) {
+			break
+		}
+		offset := int(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int(binary.BigEndian.Uint32(profile[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(profile) {
+			continue
+		}
+		tags[string(profile[entry:entry+4])] = profile[offset : offset+size]
+	}
+
+	t := &colorTransform{}
+	var primaries [3][3]float64 // columns are the red, green and blue primaries
+	for c, name := range []string{"r", "g", "b"} {
+		xyz, err := iccXYZ(tags[name+"XYZ"])
+		if err != nil {
+			return nil, err
+		}
+		for row := 0; row < 3; row++ {
+			primaries[row][c] = xyz[row]
+		}
+
+		curve, err := iccCurve(tags[name+"TRC"])
+		if err != nil {
+			return nil, err
+		}
+		for v := 0; v < 256; v++ {
+			t.toLinear[c][v] = curve(float64(v) / 255)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				t.matrix[i][j] += xyzToSRGB[i][k] * primaries[k][j]
+			}
+		}
+	}
+
+	for i := range t.toSRGB {
+		v := float64(i) / float64(len(t.toSRGB)-1)
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		t.toSRGB[i] = uint8(math.Round(v * 255))
+	}
+	return t, nil
+}
+
+// iccXYZ decodes an XYZType tag
+func iccXYZ(data []byte) ([3]float64, error) {
+	var xyz [3]float64
+	if len(data) < 20 || string(data[:4]) != "XYZ " {
+		return xyz, errors.New("ICC profile has no usable colorant tags")
+	}
+	for i := range xyz {
+		xyz[i] = s15Fixed16(data[8+i*4:])
+	}
+	return xyz, nil
+}
+
+// iccCurve decodes a curveType or parametricCurveType tag into a function
+// from encoded to linear values, both in [0, 1]
+func iccCurve(data []byte) (func(float64) float64, error) {
+	if len(data) < 12 {
+		return nil, errors.New("ICC profile has no usable tone curves")
+	}
+
+	switch string(data[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(data[8:]))
+		switch {
+		case n == 0:
+			return func(x float64) float64 { return x }, nil
+		case n == 1 && len(data) >= 14:
+			gamma := float64(binary.BigEndian.Uint16(data[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, nil
+		case n > 1 && len(data) >= 12+2*n:
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(data[12+2*i:])) / 65535
+			}
+			return func(x float64) float64 {
+				pos := x * float64(n-1)
+				i := int(pos)
+				if i >= n-1 {
+					return table[n-1]
+				}
+				frac := pos - float64(i)
+				return table[i]*(1-frac) + table[i+1]*frac
+			}, nil
+		}
+
+	case "para":
+		kind := binary.BigEndian.Uint16(data[8:])
+		params := []int{1, 3, 4, 5, 7}
+		if int(kind) >= len(params) || len(data) < 12+4*params[kind] {
+			break
+		}
+		var p [7]float64
+		for i := 0; i < params[kind]; i++ {
+			p[i] = s15Fixed16(data[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		pow := func(x float64) float64 { return math.Pow(math.Max(0, x), g) }
+		switch kind {
+		case 0:
+			return func(x float64) float64 { return pow(x) }, nil
+		case 1:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return pow(a*x + b)
+				}
+				return 0
+			}, nil
+		case 2:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return pow(a*x+b) + c
+				}
+				return c
+			}, nil
+		case 3:
+			return func(x float64) float64 {
+				if x >= d {
+					return pow(a*x + b)
+				}
+				return c * x
+			}, nil
+		case 4:
+			return func(x float64) float64 {
+				if x >= d {
+					return pow(a*x+b) + e
+				}
+				return c*x + f
+			}, nil
+		}
+	}
+	return nil, errors.New("ICC profile has an unsupported tone curve")
+}
+
+// s15Fixed16 decodes an ICC signed 15.16 fixed point number
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// apply converts the pixels of img to sRGB in place
+func (t *colorTransform) apply(img *image.NRGBA) {
+	last := float64(len(t.toSRGB) - 1)
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+img.Rect.Dx()*4]
+		for x := 0; x < len(row); x += 4 {
+			r := t.toLinear[0][row[x]]
+			g := t.toLinear[1][row[x+1]]
+			b := t.toLinear[2][row[x+2]]
+			for c := 0; c < 3; c++ {
+				v := t.matrix[c][0]*r + t.matrix[c][1]*g + t.matrix[c][2]*b
+				row[x+c] = t.toSRGB[int(math.Round(math.Min(1, math.Max(0, v))*last))]
+			}
+		}
+	}
+}
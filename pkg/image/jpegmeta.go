@@ -0,0 +1,544 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/heif"
+	"github.com/cjs/purtypics/pkg/raw"
+)
+
+// JPEG markers and segment identifiers used when reading and writing metadata
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerEOI  = 0xD9
+	markerAPP1 = 0xE1
+	markerAPP2 = 0xE2
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+)
+
+// TIFF field types
+const (
+	tiffByte      = 1
+	tiffASCII     = 2
+	tiffShort     = 3
+	tiffLong      = 4
+	tiffRational  = 5
+	tiffSRational = 10
+)
+
+// IFDs a tag can live in
+const (
+	ifdMain = iota
+	ifdExif
+	ifdGPS
+)
+
+// TIFF tags the metadata policy cares about
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagArtist           = 0x013B
+	tagCopyright        = 0x8298
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagISO              = 0x8827
+	tagDateTimeOriginal = 0x9003
+	tagOffsetTimeOrig   = 0x9011
+	tagFocalLength      = 0x920A
+	tagBodySerial       = 0xA431
+	tagLensMake         = 0xA433
+	tagLensModel        = 0xA434
+	tagLensSerial       = 0xA435
+)
+
+// cameraTags are copied when the policy keeps camera details
+var cameraTags = map[uint16]bool{
+	tagMake: true, tagModel: true, tagExposureTime: true, tagFNumber: true, tagISO: true,
+	tagDateTimeOriginal: true, tagOffsetTimeOrig: true, tagFocalLength: true,
+	tagLensMake: true, tagLensModel: true,
+}
+
+// serialTags are copied only when the policy keeps serial numbers
+var serialTags = map[uint16]bool{
+	tagBodySerial: true, tagLensSerial: true,
+}
+
+// tiffTag is a decoded TIFF entry. Only one of the value fields is set,
+// according to Type.
+type tiffTag struct {
+	IFD    int
+	ID     uint16
+	Type   uint16
+	Text   string      // tiffASCII
+	Ints   []uint32    // tiffByte, tiffShort, tiffLong
+	Ratios [][2]uint32 // tiffRational, tiffSRational (stored as raw bits)
+}
+
+// sourceMetadata is the metadata read from a source image
+type sourceMetadata struct {
+	ICC  []byte    // embedded ICC profile, nil if none
+	Tags []tiffTag // EXIF tags from IFD0 and the Exif IFD
+}
+
+// readSourceMetadata reads the ICC profile and EXIF tags of a JPEG or HEIF
+// file, and the EXIF tags of a RAW file. Other formats yield empty metadata.
+func readSourceMetadata(path string) (*sourceMetadata, error) {
+	if heif.IsHEIF(path) {
+		info, err := heif.Read(path)
+		if err != nil {
+			return nil, err
+		}
+		meta := &sourceMetadata{ICC: info.ICC}
+		if info.EXIF != nil {
+			meta.Tags, _ = parseTIFF(info.EXIF)
+		}
+		return meta, nil
+	}
+	if raw.IsRAW(path) {
+		return readRAWMetadata(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	meta := &sourceMetadata{}
+	r := bufio.NewReader(f)
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != markerSOI {
+		return meta, nil
+	}
+
+	// ICC profiles may be split across several APP2 segments, each tagged
+	// with its sequence number
+	iccChunks := make(map[int][]byte)
+	for {
+		marker, err := nextMarker(r)
+		if err != nil || marker == markerSOS || marker == markerEOI {
+			break
+		}
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil || length < 2 {
+			break
+		}
+		data := make([]byte, int(length)-2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			break
+		}
+
+		switch {
+		case marker == markerAPP1 && bytes.HasPrefix(data, exifHeader) && meta.Tags == nil:
+			meta.Tags, _ = parseTIFF(data[len(exifHeader):])
+		case marker == markerAPP2 && bytes.HasPrefix(data, iccHeader) && len(data) > len(iccHeader)+2:
+			seq := int(data[len(iccHeader)])
+			iccChunks[seq] = data[len(iccHeader)+2:]
+		}
+	}
+
+	if len(iccChunks) > 0 {
+		seqs := make([]int, 0, len(iccChunks))
+		for seq := range iccChunks {
+			seqs = append(seqs, seq)
+		}
+		sort.Ints(seqs)
+		for _, seq := range seqs {
+			meta.ICC = append(meta.ICC, iccChunks[seq]...)
+		}
+	}
+	return meta, nil
+}
+
+// nextMarker skips to the next JPEG marker and returns its code
+func nextMarker(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0xFF {
+			continue
+		}
+		for b == 0xFF {
+			if b, err = r.ReadByte(); err != nil {
+				return 0, err
+			}
+		}
+		if b != 0 {
+			return b, nil
+		}
+	}
+}
+
+// rawMetadataSize is how much of a RAW file is searched for EXIF tags. The
+// IFDs come first; the sensor data and previews they point to follow.
+const rawMetadataSize = 4 << 20
+
+// readRAWMetadata reads the EXIF tags of a TIFF-based RAW file. Its previews
+// are sRGB renderings, so there is no ICC profile to carry over.
+func readRAWMetadata(path string) (*sourceMetadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, rawMetadataSize))
+	if err != nil {
+		return nil, err
+	}
+	meta := &sourceMetadata{}
+	meta.Tags, _ = parseTIFF(data)
+	return meta, nil
+}
+
+// parseTIFF decodes the entries of IFD0 and the Exif IFD
+func parseTIFF(data []byte) ([]tiffTag, error) {
+	if len(data) < 8 {
+		return nil, errors.New("short TIFF header")
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("bad TIFF byte order")
+	}
+
+	var tags []tiffTag
+	exifOffset, err := readIFD(data, order, order.Uint32(data[4:8]), ifdMain, &tags)
+	if err != nil {
+		return tags, err
+	}
+	if exifOffset != 0 {
+		_, err = readIFD(data, order, exifOffset, ifdExif, &tags)
+	}
+	return tags, err
+}
+
+// readIFD appends the entries of the IFD at offset to tags and returns the
+// Exif IFD offset if the IFD points to one
+func readIFD(data []byte, order binary.ByteOrder, offset uint32, ifd int, tags *[]tiffTag) (uint32, error) {
+	if int(offset)+2 > len(data) {
+		return 0, errors.New("IFD out of range")
+	}
+	count := int(order.Uint16(data[offset:]))
+	pos := int(offset) + 2
+	var exifOffset uint32
+
+	for i := 0; i < count; i++ {
+		if pos+12 > len(data) {
+			return exifOffset, errors.New("IFD entry out of range")
+		}
+		entry := data[pos : pos+12]
+		pos += 12
+
+		tag := tiffTag{IFD: ifd, ID: order.Uint16(entry[0:]), Type: order.Uint16(entry[2:])}
+		n := int(order.Uint32(entry[4:]))
+
+		size := 0
+		switch tag.Type {
+		case tiffByte, tiffASCII:
+			size = 1
+		case tiffShort:
+			size = 2
+		case tiffLong:
+			size = 4
+		case tiffRational, tiffSRational:
+			size = 8
+		default:
+			continue
+		}
+		if n <= 0 || n > 1<<16 {
+			continue
+		}
+
+		value := entry[8:12]
+		if n*size > 4 {
+			start := int(order.Uint32(entry[8:]))
+			if start < 0 || start+n*size > len(data) {
+				continue
+			}
+			value = data[start : start+n*size]
+		}
+
+		switch tag.Type {
+		case tiffASCII:
+			tag.Text = string(bytes.TrimRight(value[:n], "\x00 "))
+		case tiffByte:
+			for j := 0; j < n; j++ {
+				tag.Ints = append(tag.Ints, uint32(value[j]))
+			}
+		case tiffShort:
+			for j := 0; j < n; j++ {
+				tag.Ints = append(tag.Ints, uint32(order.Uint16(value[j*2:])))
+			}
+		case tiffLong:
+			for j := 0; j < n; j++ {
+				tag.Ints = append(tag.Ints, order.Uint32(value[j*4:]))
+			}
+		case tiffRational, tiffSRational:
+			for j := 0; j < n; j++ {
+				tag.Ratios = append(tag.Ratios, [2]uint32{order.Uint32(value[j*8:]), order.Uint32(value[j*8+4:])})
+			}
+		}
+
+		if ifd == ifdMain && tag.ID == tagExifIFD && len(tag.Ints) == 1 {
+			exifOffset = tag.Ints[0]
+			continue
+		}
+		*tags = append(*tags, tag)
+	}
+	return exifOffset, nil
+}
+
+// tags selects the EXIF tags a rendition carries under the policy
+func (policy MetadataPolicy) tags(source []tiffTag, gps *exif.GPSData) []tiffTag {
+	var tags []tiffTag
+	for _, tag := range source {
+		if (policy.Camera && cameraTags[tag.ID]) || (policy.SerialNumbers && serialTags[tag.ID]) {
+			tags = append(tags, tag)
+		}
+	}
+	if policy.Artist != "" {
+		tags = append(tags, tiffTag{ID: tagArtist, Type: tiffASCII, Text: policy.Artist})
+	}
+	if policy.Copyright != "" {
+		tags = append(tags, tiffTag{ID: tagCopyright, Type: tiffASCII, Text: policy.Copyright})
+	}
+	if policy.GPS && gps != nil {
+		tags = append(tags, gpsTags(gps)...)
+	}
+	return tags
+}
+
+// buildEXIF encodes tags as a big-endian TIFF structure wrapped in an Exif
+// APP1 payload. Tags are sorted into IFD0, the Exif IFD and the GPS IFD.
+func buildEXIF(tags []tiffTag) []byte {
+	var main, sub, gps []tiffTag
+	for _, tag := range tags {
+		switch tag.IFD {
+		case ifdExif:
+			sub = append(sub, tag)
+		case ifdGPS:
+			gps = append(gps, tag)
+		default:
+			main = append(main, tag)
+		}
+	}
+	if len(main)+len(sub)+len(gps) == 0 {
+		return nil
+	}
+
+	// Pointers to the sub-IFDs are filled in once their offsets are known
+	if len(sub) > 0 {
+		main = append(main, tiffTag{ID: tagExifIFD, Type: tiffLong, Ints: []uint32{0}})
+	}
+	if len(gps) > 0 {
+		main = append(main, tiffTag{ID: tagGPSIFD, Type: tiffLong, Ints: []uint32{0}})
+	}
+
+	order := binary.BigEndian
+	buf := &bytes.Buffer{}
+	buf.WriteString("MM")
+	binary.Write(buf, order, uint16(42))
+	binary.Write(buf, order, uint32(8))
+
+	mainSize := ifdSize(main)
+	exifOffset := uint32(8 + mainSize)
+	gpsOffset := exifOffset + uint32(ifdSize(sub))
+	for i := range main {
+		switch main[i].ID {
+		case tagExifIFD:
+			main[i].Ints[0] = exifOffset
+		case tagGPSIFD:
+			main[i].Ints[0] = gpsOffset
+		}
+	}
+
+	writeIFD(buf, main, 8)
+	if len(sub) > 0 {
+		writeIFD(buf, sub, exifOffset)
+	}
+	if len(gps) > 0 {
+		writeIFD(buf, gps, gpsOffset)
+	}
+	return append(append([]byte{}, exifHeader...), buf.Bytes()...)
+}
+
+// tagData returns the encoded value bytes of a tag and its element count
+func tagData(tag tiffTag) ([]byte, uint32) {
+	order := binary.BigEndian
+	var out []byte
+	switch tag.Type {
+	case tiffASCII:
+		out = append([]byte(tag.Text), 0)
+		return out, uint32(len(out))
+	case tiffByte:
+		for _, v := range tag.Ints {
+			out = append(out, byte(v))
+		}
+		return out, uint32(len(tag.Ints))
+	case tiffShort:
+		for _, v := range tag.Ints {
+			out = order.AppendUint16(out, uint16(v))
+		}
+		return out, uint32(len(tag.Ints))
+	case tiffLong:
+		for _, v := range tag.Ints {
+			out = order.AppendUint32(out, v)
+		}
+		return out, uint32(len(tag.Ints))
+	default:
+		for _, r := range tag.Ratios {
+			out = order.AppendUint32(out, r[0])
+			out = order.AppendUint32(out, r[1])
+		}
+		return out, uint32(len(tag.Ratios))
+	}
+}
+
+// ifdSize returns the encoded size of an IFD including out-of-line values
+func ifdSize(tags []tiffTag) int {
+	if len(tags) == 0 {
+		return 0
+	}
+	size := 2 + 12*len(tags) + 4
+	for _, tag := range tags {
+		if data, _ := tagData(tag); len(data) > 4 {
+			size += len(data) + len(data)%2
+		}
+	}
+	return size
+}
+
+// writeIFD writes an IFD that starts at offset within the TIFF structure,
+// followed by the values that don't fit in their entries
+func writeIFD(buf *bytes.Buffer, tags []tiffTag, offset uint32) {
+	order := binary.BigEndian
+	sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+
+	binary.Write(buf, order, uint16(len(tags)))
+	valueOffset := offset + uint32(2+12*len(tags)+4)
+	var values []byte
+	for _, tag := range tags {
+		data, count := tagData(tag)
+		binary.Write(buf, order, tag.ID)
+		binary.Write(buf, order, tag.Type)
+		binary.Write(buf, order, count)
+		if len(data) <= 4 {
+			var inline [4]byte
+			copy(inline[:], data)
+			buf.Write(inline[:])
+			continue
+		}
+		binary.Write(buf, order, valueOffset+uint32(len(values)))
+		values = append(values, data...)
+		if len(data)%2 == 1 {
+			values = append(values, 0)
+		}
+	}
+	binary.Write(buf, order, uint32(0)) // no next IFD
+	buf.Write(values)
+}
+
+// gpsTags encodes a location as GPS IFD entries
+func gpsTags(gps *exif.GPSData) []tiffTag {
+	dms := func(deg float64) [][2]uint32 {
+		deg = math.Abs(deg)
+		d := math.Floor(deg)
+		m := math.Floor((deg - d) * 60)
+		s := (deg - d - m/60) * 3600
+		return [][2]uint32{{uint32(d), 1}, {uint32(m), 1}, {uint32(math.Round(s * 100)), 100}}
+	}
+	latRef, lngRef := "N", "E"
+	if gps.Latitude < 0 {
+		latRef = "S"
+	}
+	if gps.Longitude < 0 {
+		lngRef = "W"
+	}
+
+	tags := []tiffTag{
+		{IFD: ifdGPS, ID: 0x0000, Type: tiffByte, Ints: []uint32{2, 3, 0, 0}}, // GPSVersionID
+		{IFD: ifdGPS, ID: 0x0001, Type: tiffASCII, Text: latRef},
+		{IFD: ifdGPS, ID: 0x0002, Type: tiffRational, Ratios: dms(gps.Latitude)},
+		{IFD: ifdGPS, ID: 0x0003, Type: tiffASCII, Text: lngRef},
+		{IFD: ifdGPS, ID: 0x0004, Type: tiffRational, Ratios: dms(gps.Longitude)},
+	}
+	if gps.Altitude != 0 {
+		ref := uint32(0)
+		if gps.Altitude < 0 {
+			ref = 1
+		}
+		tags = append(tags,
+			tiffTag{IFD: ifdGPS, ID: 0x0005, Type: tiffByte, Ints: []uint32{ref}},
+			tiffTag{IFD: ifdGPS, ID: 0x0006, Type: tiffRational, Ratios: [][2]uint32{{uint32(math.Round(math.Abs(gps.Altitude) * 100)), 100}}},
+		)
+	}
+	return tags
+}
+
+// writeJPEGWithMetadata writes encoded JPEG data to path, inserting the EXIF
+// and ICC segments right after the start-of-image marker
+func writeJPEGWithMetadata(path string, encoded, exif, icc []byte) error {
+	if len(encoded) < 2 {
+		return errors.New("empty JPEG data")
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	w.Write(encoded[:2])
+
+	if len(exif) > 0 && len(exif) <= 0xFFFF-2 {
+		writeSegment(w, markerAPP1, exif)
+	}
+
+	// ICC profiles larger than one segment are split into numbered chunks
+	const maxChunk = 0xFFFF - 2 - 14
+	if n := (len(icc) + maxChunk - 1) / maxChunk; n > 0 && n < 256 {
+		for i := 0; i < n; i++ {
+			end := (i + 1) * maxChunk
+			if end > len(icc) {
+				end = len(icc)
+			}
+			payload := append(append([]byte{}, iccHeader...), byte(i+1), byte(n))
+			writeSegment(w, markerAPP2, append(payload, icc[i*maxChunk:end]...))
+		}
+	}
+
+	w.Write(encoded[2:])
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeSegment writes one JPEG marker segment
+func writeSegment(w io.Writer, marker byte, payload []byte) {
+	w.Write([]byte{0xFF, marker})
+	binary.Write(w, binary.BigEndian, uint16(len(payload)+2))
+	w.Write(payload)
+}
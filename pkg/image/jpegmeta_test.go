@@ -0,0 +1,190 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cjs/purtypics/pkg/exif"
+	goexif "github.com/rwcarlsen/goexif/exif"
+)
+
+// testProfile builds a matrix/TRC RGB profile with the given D50 primaries
+// and the sRGB tone curve
+func testProfile(primaries [3][3]float64) []byte {
+	fixed := func(v float64) []byte {
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(v*65536)))
+	}
+	var xyz [3][]byte
+	for i, p := range primaries {
+		xyz[i] = append([]byte("XYZ \x00\x00\x00\x00"), append(append(fixed(p[0]), fixed(p[1])...), fixed(p[2])...)...)
+	}
+	trc := []byte("para\x00\x00\x00\x00\x00\x03\x00\x00")
+	for _, v := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+		trc = append(trc, fixed(v)...)
+	}
+
+	tags := []struct {
+		sig  string
+		data []byte
+	}{{"rXYZ", xyz[0]}, {"gXYZ", xyz[1]}, {"bXYZ", xyz[2]}, {"rTRC", trc}, {"gTRC", trc}, {"bTRC", trc}}
+
+	header := make([]byte, 128)
+	copy(header[16:], "RGB XYZ ")
+	profile := binary.BigEndian.AppendUint32(header, uint32(len(tags)))
+	offset := 132 + 12*len(tags)
+	var data []byte
+	for _, tag := range tags {
+		profile = append(profile, tag.sig...)
+		profile = binary.BigEndian.AppendUint32(profile, uint32(offset+len(data)))
+		profile = binary.BigEndian.AppendUint32(profile, uint32(len(tag.data)))
+		data = append(data, tag.data...)
+	}
+	return append(profile, data...)
+}
+
+var (
+	srgbPrimaries = [3][3]float64{{0.4361, 0.2225, 0.0139}, {0.3851, 0.7169, 0.0971}, {0.1431, 0.0606, 0.7141}}
+	p3Primaries   = [3][3]float64{{0.5151, 0.2412, -0.0011}, {0.2919, 0.6922, 0.0419}, {0.1571, 0.0666, 0.7841}}
+)
+
+func TestProcessImageMetadataPolicy(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.jpg")
+
+	img := image.NewNRGBA(image.Rect(0, 0, 900, 600))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	exifData := buildEXIF([]tiffTag{
+		{ID: tagMake, Type: tiffASCII, Text: "Acme"},
+		{ID: tagModel, Type: tiffASCII, Text: "One"},
+		{IFD: ifdExif, ID: tagISO, Type: tiffShort, Ints: []uint32{400}},
+		{IFD: ifdExif, ID: tagBodySerial, Type: tiffASCII, Text: "SN12345"},
+	})
+	if err := saveJPEG(source, img, 90, exifData, testProfile(p3Primaries)); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProcessor(dir)
+	p.SetMetadataPolicy("", MetadataPolicy{Camera: true, Artist: "Jane Doe", Copyright: "(c) Jane Doe"})
+	p.SetMetadataPolicy("medium", MetadataPolicy{ConvertToSRGB: true, SerialNumbers: true, GPS: true})
+
+	location := &exif.GPSData{Latitude: 45.5, Longitude: -122.25}
+	renditions, err := p.ProcessImage(source, "album", "photo", PhotoOptions{Location: location})
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbs := Thumbnails(renditions)
+
+	// The small size keeps camera details and the profile, adds the
+	// author and drops the serial number and location
+	small, err := readSourceMetadata(filepath.Join(dir, filepath.FromSlash(thumbs["small"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(small.ICC, testProfile(p3Primaries)) {
+		t.Error("small: ICC profile not kept")
+	}
+	x := decodeEXIF(t, filepath.Join(dir, filepath.FromSlash(thumbs["small"])))
+	for field, want := range map[goexif.FieldName]string{goexif.Make: "Acme", goexif.Artist: "Jane Doe", goexif.Copyright: "(c) Jane Doe"} {
+		if tag, err := x.Get(field); err != nil {
+			t.Errorf("small: %s missing", field)
+		} else if got, _ := tag.StringVal(); got != want {
+			t.Errorf("small: %s = %q, want %q", field, got, want)
+		}
+	}
+	if tag, err := x.Get(goexif.ISOSpeedRatings); err != nil {
+		t.Error("small: ISO missing")
+	} else if iso, _ := tag.Int(0); iso != 400 {
+		t.Errorf("small: ISO = %d, want 400", iso)
+	}
+	if _, err := x.Get(goexif.FieldName("BodySerialNumber")); err == nil {
+		t.Error("small: serial number kept")
+	}
+	if _, _, err := x.LatLong(); err == nil {
+		t.Error("small: location written")
+	}
+
+	// The medium size is converted to sRGB and carries only the serial
+	// number and location
+	medium, err := readSourceMetadata(filepath.Join(dir, filepath.FromSlash(thumbs["medium"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if medium.ICC != nil {
+		t.Error("medium: ICC profile kept after sRGB conversion")
+	}
+	var serial string
+	for _, tag := range medium.Tags {
+		if tag.ID == tagBodySerial {
+			serial = tag.Text
+		}
+		if tag.ID == tagMake {
+			t.Error("medium: camera details kept")
+		}
+	}
+	if serial != "SN12345" {
+		t.Errorf("medium: serial number = %q, want SN12345", serial)
+	}
+	lat, lng, err := decodeEXIF(t, filepath.Join(dir, filepath.FromSlash(thumbs["medium"]))).LatLong()
+	if err != nil {
+		t.Fatalf("medium: location missing: %v", err)
+	}
+	if lat < 45.4999 || lat > 45.5001 || lng < -122.2501 || lng > -122.2499 {
+		t.Errorf("medium: location = %f,%f, want 45.5,-122.25", lat, lng)
+	}
+}
+
+func decodeEXIF(t *testing.T, path string) *goexif.Exif {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	x, err := goexif.Decode(f)
+	if err != nil {
+		t.Fatalf("decoding EXIF of %s: %v", path, err)
+	}
+	return x
+}
+
+func TestColorTransform(t *testing.T) {
+	convert := func(primaries [3][3]float64, c color.NRGBA) color.NRGBA {
+		transform, err := newColorTransform(testProfile(primaries))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+		img.SetNRGBA(0, 0, c)
+		transform.apply(img)
+		return img.NRGBAAt(0, 0)
+	}
+	near := func(a, b uint8) bool { return a+2 >= b && b+2 >= a }
+
+	// An sRGB profile leaves colors alone
+	in := color.NRGBA{180, 90, 30, 255}
+	if got := convert(srgbPrimaries, in); !near(got.R, in.R) || !near(got.G, in.G) || !near(got.B, in.B) {
+		t.Errorf("sRGB profile changed %v to %v", in, got)
+	}
+
+	// Display P3 grays stay gray and its red lies beyond sRGB's
+	gray := convert(p3Primaries, color.NRGBA{128, 128, 128, 255})
+	if !near(gray.R, 128) || !near(gray.G, 128) || !near(gray.B, 128) {
+		t.Errorf("P3 gray converted to %v", gray)
+	}
+	red := convert(p3Primaries, color.NRGBA{200, 60, 60, 255})
+	if red.R <= 200 || red.G >= 60 {
+		t.Errorf("P3 red converted to %v, want a more saturated sRGB red", red)
+	}
+
+	// Unsupported profiles are rejected so callers can embed them instead
+	if _, err := newColorTransform([]byte("not a profile")); err == nil {
+		t.Error("accepted a broken profile")
+	}
+}
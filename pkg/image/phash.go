@@ -0,0 +1,102 @@
+package image
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// ImageHash is a pair of perceptual hashes of an image. Unlike a content
+// hash they barely change when a photo is resized, recompressed or lightly
+// edited, so copies exported at different sizes still match.
+type ImageHash struct {
+	DHash uint64 `json:"dhash"` // difference hash: whether brightness rises left to right
+	PHash uint64 `json:"phash"` // DCT hash: the signs of the lowest frequencies
+}
+
+// HashImage computes the perceptual hashes of an image
+func HashImage(img image.Image) ImageHash {
+	return ImageHash{DHash: dHash(img), PHash: pHash(img)}
+}
+
+// Distance returns how many bits differ between two images' hashes, taking
+// the larger of the two hashes' distances: 0 for the same picture, around
+// 32 for unrelated ones. Requiring both hashes to agree keeps photos that
+// merely share a layout apart.
+func (h ImageHash) Distance(other ImageHash) int {
+	return max(bits.OnesCount64(h.DHash^other.DHash), bits.OnesCount64(h.PHash^other.PHash))
+}
+
+// dHash compares each pixel of a 9×8 grayscale thumbnail with its right
+// neighbour
+func dHash(img image.Image) uint64 {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			i := y*small.Stride + x*4
+			hash <<= 1
+			if small.Pix[i] < small.Pix[i+4] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// pHash takes the 8×8 lowest frequencies of a 32×32 grayscale thumbnail and
+// records which lie above their median. The DC term, the overall brightness,
+// is left out of the median.
+func pHash(img image.Image) uint64 {
+	const n = 32
+	small := imaging.Grayscale(imaging.Resize(img, n, n, imaging.Box))
+
+	var pixels [n][n]float64
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			pixels[y][x] = float64(small.Pix[y*small.Stride+x*4])
+		}
+	}
+
+	// Separable DCT-II, rows then columns, keeping the first 8 of each
+	var cosines [8][n]float64
+	for u := 0; u < 8; u++ {
+		for x := 0; x < n; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * n))
+		}
+	}
+	var rows [n][8]float64
+	for y := 0; y < n; y++ {
+		for u := 0; u < 8; u++ {
+			for x := 0; x < n; x++ {
+				rows[y][u] += pixels[y][x] * cosines[u][x]
+			}
+		}
+	}
+	coefficients := make([]float64, 0, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				sum += rows[y][u] * cosines[v][y]
+			}
+			coefficients = append(coefficients, sum)
+		}
+	}
+
+	sorted := append([]float64(nil), coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for _, c := range coefficients {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
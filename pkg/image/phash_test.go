@@ -0,0 +1,42 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// scene draws a few overlapping shapes so the hashes have structure to find
+func scene(w, h int, shift int) *image.NRGBA {
+	img := imaging.New(w, h, color.NRGBA{30, 60, 90, 255})
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			switch {
+			case (fx-0.3)*(fx-0.3)+(fy-0.4)*(fy-0.4) < 0.04:
+				img.Set(x, y, color.NRGBA{240, 200, 40, 255})
+			case fy > 0.7 && x > shift:
+				img.Set(x, y, color.NRGBA{40, 140, 60, 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestImageHashMatchesResizedCopies(t *testing.T) {
+	original := HashImage(scene(1200, 800, 0))
+
+	// A smaller, recompressed-looking copy is still the same picture
+	copied := HashImage(imaging.Blur(imaging.Resize(scene(1200, 800, 0), 400, 0, imaging.Lanczos), 0.8))
+	if d := original.Distance(copied); d > 4 {
+		t.Errorf("distance to a resized copy = %d, want at most 4", d)
+	}
+
+	// A different picture is far away
+	other := HashImage(imaging.FlipH(scene(1200, 800, 600)))
+	if d := original.Distance(other); d < 12 {
+		t.Errorf("distance to a different picture = %d, want at least 12", d)
+	}
+}
@@ -0,0 +1,183 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Placeholder is what a page shows while a photo loads
+type Placeholder struct {
+	BlurHash string // a blurred preview in a few dozen characters, see https://blurha.sh
+	Color    string // the photo's dominant color as #rrggbb
+}
+
+// placeholderSize is the long edge of the copy placeholders are computed
+// from; both only keep the coarsest detail
+const placeholderSize = 64
+
+// ReadPlaceholder computes the placeholder of an image file, typically one
+// of its small renditions
+func ReadPlaceholder(path string) (Placeholder, error) {
+	img, err := imaging.Open(path)
+	if err != nil {
+		return Placeholder{}, err
+	}
+	return NewPlaceholder(img), nil
+}
+
+// NewPlaceholder computes the placeholder of an image
+func NewPlaceholder(img image.Image) Placeholder {
+	small := imaging.Fit(img, placeholderSize, placeholderSize, imaging.Box)
+	bounds := small.Bounds()
+
+	// Four components along the long side and three along the short one
+	// are enough for a recognisable blur
+	cx, cy := 4, 3
+	if bounds.Dy() > bounds.Dx() {
+		cx, cy = 3, 4
+	}
+	return Placeholder{
+		BlurHash: blurHash(small, cx, cy),
+		Color:    dominantColor(small),
+	}
+}
+
+// blurHash encodes an image as a BlurHash with cx×cy cosine components
+func blurHash(img *image.NRGBA, cx, cy int) string {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// Linear RGB of every pixel, computed once for all components
+	linear := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*img.Stride + x*4
+			linear[y*w+x] = [3]float64{
+				srgbToLinear(img.Pix[i]),
+				srgbToLinear(img.Pix[i+1]),
+				srgbToLinear(img.Pix[i+2]),
+			}
+		}
+	}
+
+	factors := make([][3]float64, 0, cx*cy)
+	for j := 0; j < cy; j++ {
+		for i := 0; i < cx; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(h))
+					p := linear[y*w+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+			scale := 1 / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(encode83((cx-1)+(cy-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maximum := 1.0
+	if len(ac) > 0 {
+		var actual float64
+		for _, f := range ac {
+			actual = math.Max(actual, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		b.WriteString(encode83(quantised, 1))
+	} else {
+		b.WriteString(encode83(0, 1))
+	}
+
+	b.WriteString(encode83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		b.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+	return b.String()
+}
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// encode83 writes value as length base 83 digits
+func encode83(value, length int) string {
+	digits := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		digits[i] = base83[value%83]
+		value /= 83
+	}
+	return string(digits)
+}
+
+func srgbToLinear(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	c := math.Max(0, math.Min(1, v))
+	if c <= 0.0031308 {
+		return int(c*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(c, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// dominantColor returns the average of the most common color, with colors
+// grouped into 4096 buckets of similar shades. Unlike a plain average it
+// gives the sky's blue rather than the grey a blue sky over a red roof
+// averages to. Transparent pixels are ignored.
+func dominantColor(img *image.NRGBA) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var best *bucket
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		r, g, b, a := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2]), img.Pix[i+3]
+		if a < 128 {
+			continue
+		}
+		key := r>>4<<8 | g>>4<<4 | b>>4
+		bk := buckets[key]
+		if bk == nil {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.count++
+		bk.r += r
+		bk.g += g
+		bk.b += b
+		if best == nil || bk.count > best.count {
+			best = bk
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
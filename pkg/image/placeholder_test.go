@@ -0,0 +1,43 @@
+package image
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestPlaceholderUniform(t *testing.T) {
+	// A flat image has no detail, so every AC component encodes as zero
+	p := NewPlaceholder(imaging.New(300, 200, color.NRGBA{0, 0, 0, 255}))
+	if want := "L00000" + strings.Repeat("fQ", 11); p.BlurHash != want {
+		t.Errorf("BlurHash = %q, want %q", p.BlurHash, want)
+	}
+	if p.Color != "#000000" {
+		t.Errorf("Color = %q, want #000000", p.Color)
+	}
+}
+
+func TestPlaceholderDominantColor(t *testing.T) {
+	// Two thirds sky, one third roof
+	img := imaging.New(300, 300, color.NRGBA{40, 110, 220, 255})
+	for y := 200; y < 300; y++ {
+		for x := 0; x < 300; x++ {
+			img.Set(x, y, color.NRGBA{200, 30, 20, 255})
+		}
+	}
+
+	p := NewPlaceholder(img)
+	if p.Color != "#286edc" {
+		t.Errorf("Color = %q, want the sky's #286edc", p.Color)
+	}
+	if len(p.BlurHash) != 6+11*2 || p.BlurHash == "L00000"+strings.Repeat("fQ", 11) {
+		t.Errorf("BlurHash = %q, want a 4×3 hash with detail", p.BlurHash)
+	}
+
+	// Portrait photos get more components vertically: size flag 2+3*9 is "T"
+	if p := NewPlaceholder(imaging.New(200, 300, color.White)); !strings.HasPrefix(p.BlurHash, "T") {
+		t.Errorf("portrait BlurHash = %q, want 3×4 components", p.BlurHash)
+	}
+}
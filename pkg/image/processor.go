@@ -1,42 +1,111 @@
 package image
 
 import (
+	"bytes"
 	"path"
 	"fmt"
+	"sort"
+	"strings"
 	"image"
 	"image/jpeg"
 	"os"
 	"path/filepath"
 
+	"github.com/cjs/purtypics/pkg/exif"
+	"github.com/cjs/purtypics/pkg/heif"
+	"github.com/cjs/purtypics/pkg/raw"
 	"github.com/disintegration/imaging"
 	_ "golang.org/x/image/webp"
 	_ "image/gif"
 	_ "image/png"
 )
 
-// ThumbnailSizes defines standard thumbnail dimensions
-type ThumbnailSizes struct {
-	Small  int // for grid view
-	Medium int // for larger grid
-	Large  int // for detail view
-	Full   int // max size for web display
+// Size describes one generated thumbnail size. Images are scaled to Width
+// when it is set, otherwise to fit within LongEdge on their longest side.
+type Size struct {
+	Name     string
+	LongEdge int
+	Width    int
+	Quality  int     // JPEG quality, 0 for the processor's default
+	Sharpen  float64 // sigma of the sharpening applied after resizing, 0 for none
 }
 
-// DefaultSizes returns recommended thumbnail sizes
-func DefaultSizes() ThumbnailSizes {
-	return ThumbnailSizes{
-		Small:  400,
-		Medium: 800,
-		Large:  1600,
-		Full:   2560, // good for up to 5K displays
+// DefaultSizes returns recommended thumbnail sizes, smallest first
+func DefaultSizes() []Size {
+	return []Size{
+		{Name: "small", LongEdge: 400},  // for grid view
+		{Name: "medium", LongEdge: 800}, // for larger grid
+		{Name: "large", LongEdge: 1600}, // for detail view
+		{Name: "full", LongEdge: 2560},  // good for up to 5K displays
 	}
 }
 
+// Dimensions returns the dimensions of a w×h image scaled to the size, and
+// whether the image is larger than the size in the first place
+func (s Size) Dimensions(w, h int) (int, int, bool) {
+	if w <= 0 || h <= 0 {
+		return 0, 0, false
+	}
+	if s.Width > 0 {
+		return s.Width, h * s.Width / w, w > s.Width
+	}
+	if w > h {
+		return s.LongEdge, h * s.LongEdge / w, w > s.LongEdge
+	}
+	return w * s.LongEdge / h, s.LongEdge, h > s.LongEdge
+}
+
+// Render scales img to the size and sharpens it if the size asks for it
+func (s Size) Render(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height, _ := s.Dimensions(bounds.Dx(), bounds.Dy())
+	return s.renderAt(img, width, height)
+}
+
+// renderAt scales img to width×height with the size's sharpening
+func (s Size) renderAt(img image.Image, width, height int) *image.NRGBA {
+	// Resize with Lanczos filter for best quality
+	resized := imaging.Resize(img, width, height, imaging.Lanczos)
+	if s.Sharpen > 0 {
+		resized = imaging.Sharpen(resized, s.Sharpen)
+	}
+	return resized
+}
+
+// MetadataPolicy says which metadata a generated image carries
+type MetadataPolicy struct {
+	ConvertToSRGB bool   // convert pixels to sRGB with the source's ICC profile instead of embedding the profile
+	Artist        string // written to the Artist tag when set
+	Copyright     string // written to the Copyright tag when set
+	Camera        bool   // keep camera, lens, exposure and capture time
+	SerialNumbers bool   // keep body and lens serial numbers
+	GPS           bool   // write the location given in PhotoOptions
+}
+
+// DefaultMetadataPolicy keeps the color profile and camera details and drops
+// serial numbers and locations
+func DefaultMetadataPolicy() MetadataPolicy {
+	return MetadataPolicy{Camera: true}
+}
+
+// PhotoOptions carries per-photo input for ProcessImage
+type PhotoOptions struct {
+	Location    *exif.GPSData // location sizes that allow GPS embed, nil for none
+	FocalPoint  *FocalPoint   // what crops keep in view, nil to find it from the image
+	Edit        Edit          // rotation, straightening and crop applied before resizing
+	Adjustments Adjustments   // tonal changes applied after the edit, before resizing
+}
+
 // Processor handles image operations
 type Processor struct {
-	sizes      ThumbnailSizes
+	sizes      []Size // smallest first
 	outputPath string
 	quality    int
+	policies   map[string]MetadataPolicy // by size name; "" applies to sizes without their own
+	formats    []string                  // formats written besides JPEG
+	encoders   map[string]encoder
+	crops      []Crop // cropped renditions written besides the full frame
+	regenerate bool
 }
 
 // NewProcessor creates a new image processor
@@ -44,13 +113,106 @@ func NewProcessor(outputPath string) *Processor {
 	return &Processor{
 		sizes:      DefaultSizes(),
 		outputPath: outputPath,
-		quality:    95, // High quality for gallery
+		quality:    95, // High quality for gallery, unless a size sets its own
+		policies:   map[string]MetadataPolicy{"": DefaultMetadataPolicy()},
 	}
 }
 
-// ProcessImage generates all thumbnail sizes for an image
-func (p *Processor) ProcessImage(sourcePath, albumID, photoID string) (map[string]string, error) {
+// SetSizes sets the thumbnail sizes to generate, smallest first
+func (p *Processor) SetSizes(sizes []Size) {
+	p.sizes = sizes
+}
+
+// SetCrops sets the cropped renditions written for every size besides the
+// full frame
+func (p *Processor) SetCrops(crops []Crop) {
+	p.crops = crops
+}
+
+// HasSize reports whether the processor generates the named size
+func (p *Processor) HasSize(name string) bool {
+	for _, size := range p.sizes {
+		if size.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMetadataPolicy sets the metadata policy of one size, or of every size
+// without its own policy when size is empty
+func (p *Processor) SetMetadataPolicy(size string, policy MetadataPolicy) {
+	p.policies[size] = policy
+}
+
+// SetRegenerate makes ProcessImage ignore existing thumbnails, for when they
+// were made with other settings
+func (p *Processor) SetRegenerate(regenerate bool) {
+	p.regenerate = regenerate
+}
+
+// EmbedsLocations reports whether any size writes GPS tags
+func (p *Processor) EmbedsLocations() bool {
+	for _, policy := range p.policies {
+		if policy.GPS {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataPolicy returns the policy that applies to a size
+func (p *Processor) metadataPolicy(size string) MetadataPolicy {
+	if policy, ok := p.policies[size]; ok {
+		return policy
+	}
+	return p.policies[""]
+}
+
+// Settings describes the options that affect generated thumbnails, so callers
+// can tell when previously generated files are stale
+func (p *Processor) Settings() string {
+	names := make([]string, 0, len(p.policies))
+	for name := range p.policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var policies bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&policies, " metadata[%s]=%+v", name, p.policies[name])
+	}
+	return fmt.Sprintf("sizes=%+v quality=%d formats=%s crops=%+v animations=%s%s",
+		p.sizes, p.quality,
+		strings.Join(append([]string{FormatJPEG}, p.formats...), ","), p.crops, animationFormat(), policies.String())
+}
+
+// Rendition is one generated file of an image
+type Rendition struct {
+	Size   string `json:"size"`
+	Format string `json:"format"`
+	Crop   string `json:"crop,omitempty"` // crop name, empty for the full frame
+	Path   string `json:"path"`           // site path, e.g. /static/thumbs/album/photo_small.webp
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Thumbnails returns the path of the full-frame JPEG rendition of each size
+func Thumbnails(renditions []Rendition) map[string]string {
 	thumbnails := make(map[string]string)
+	for _, r := range renditions {
+		if r.Format == FormatJPEG && r.Crop == "" {
+			thumbnails[r.Size] = r.Path
+		}
+	}
+	return thumbnails
+}
+
+// ProcessImage generates all thumbnail sizes for an image, as JPEG and in
+// every extra format set with SetFormats, full frame and in every crop set
+// with SetCrops
+func (p *Processor) ProcessImage(sourcePath, albumID, photoID string, opts PhotoOptions) ([]Rendition, error) {
+	var renditions []Rendition
 
 	// Get source file info
 	sourceInfo, err := os.Stat(sourcePath)
@@ -58,101 +220,206 @@ func (p *Processor) ProcessImage(sourcePath, albumID, photoID string) (map[strin
 		return nil, fmt.Errorf("failed to stat source file: %w", err)
 	}
 
-	// Check for existing thumbnails first
-	sizes := map[string]int{
-		"small":  p.sizes.Small,
-		"medium": p.sizes.Medium,
-		"large":  p.sizes.Large,
-		"full":   p.sizes.Full,
+	// Metadata that can't be read is simply not carried over
+	source, err := readSourceMetadata(sourcePath)
+	if err != nil {
+		source = &sourceMetadata{}
+	}
+
+	// Profiles that can't be converted are embedded instead. Only JPEG
+	// carries them, so such photos get no other formats rather than ones
+	// showing their colors wrong.
+	var transform *colorTransform
+	if source.ICC != nil {
+		transform, _ = newColorTransform(source.ICC)
 	}
+	formats := append([]string{FormatJPEG}, p.formats...)
+	if source.ICC != nil && transform == nil {
+		formats = formats[:1]
+	}
+
+	thumbDir := filepath.Join(p.outputPath, "static", "thumbs", albumID)
+	crops := append([]Crop{{}}, p.crops...) // the zero crop is the full frame
 
 	// Check if all thumbnails exist and are newer than source
-	allCached := true
-	for sizeName := range sizes {
-		thumbDir := filepath.Join(p.outputPath, "static", "thumbs", albumID)
-		ext := ".jpg"
-		thumbPath := filepath.Join(thumbDir, fmt.Sprintf("%s_%s%s", photoID, sizeName, ext))
-		relPath := path.Join("/static/thumbs", albumID, fmt.Sprintf("%s_%s%s", photoID, sizeName, ext))
-		
-		thumbInfo, err := os.Stat(thumbPath)
-		if err != nil || thumbInfo.ModTime().Before(sourceInfo.ModTime()) {
-			allCached = false
-			break
+	allCached := !p.regenerate
+	for _, size := range p.sizes {
+		for _, crop := range crops {
+			if !allCached {
+				break
+			}
+			name := renditionName(photoID, size, crop)
+			width, height, err := GetImageDimensions(filepath.Join(thumbDir, name+".jpg"))
+			if err != nil {
+				allCached = false
+				break
+			}
+			for _, format := range formats {
+				thumbInfo, err := os.Stat(filepath.Join(thumbDir, name+formatInfo[format].ext))
+				if err != nil || thumbInfo.ModTime().Before(sourceInfo.ModTime()) {
+					allCached = false
+					break
+				}
+				renditions = append(renditions, Rendition{
+					Size:   size.Name,
+					Format: format,
+					Crop:   crop.Name,
+					Path:   path.Join("/static/thumbs", albumID, name+formatInfo[format].ext),
+					Width:  width,
+					Height: height,
+				})
+			}
 		}
-		thumbnails[sizeName] = relPath
 	}
 
 	// If all thumbnails are cached and up-to-date, return them
 	if allCached {
-		return thumbnails, nil
+		return renditions, nil
 	}
 
 	// Otherwise, regenerate all thumbnails
-	thumbnails = make(map[string]string)
+	renditions = nil
 
-	// Decode image and auto-orient based on EXIF
-	img, err := imaging.Open(sourcePath, imaging.AutoOrientation(true))
+	// Decode image and auto-orient based on EXIF, then frame and adjust it
+	// as edited
+	img, err := Open(sourcePath)
 	if err != nil {
 		return nil, err
 	}
+	img = opts.Adjustments.Apply(opts.Edit.Apply(img))
 
 	bounds := img.Bounds()
 	origWidth := bounds.Dx()
 	origHeight := bounds.Dy()
 
-	// Reuse sizes map from above
+	if err := os.MkdirAll(thumbDir, 0755); err != nil {
+		return nil, err
+	}
 
-	for sizeName, maxDim := range sizes {
-		// Skip if image is smaller than target
-		if origWidth <= maxDim && origHeight <= maxDim && sizeName != "small" {
-			continue
+	// Crops are cut once, around the focal point or where the image is
+	// busiest, and scaled to each size
+	var energy *energyMap
+	cropped := make([]image.Image, len(crops))
+	cropped[0] = img
+	for i, crop := range crops[1:] {
+		focus := opts.FocalPoint
+		if focus == nil {
+			if energy == nil {
+				energy = newEnergyMap(img)
+			}
+			point := energy.focalPoint(origWidth, origHeight, crop)
+			focus = &point
 		}
+		cropped[i+1] = imaging.Crop(img, cropRect(origWidth, origHeight, crop, *focus))
+	}
 
-		// Calculate new dimensions maintaining aspect ratio
-		var newWidth, newHeight int
-		if origWidth > origHeight {
-			newWidth = maxDim
-			newHeight = origHeight * maxDim / origWidth
-		} else {
-			newHeight = maxDim
-			newWidth = origWidth * maxDim / origHeight
-		}
+	for i, size := range p.sizes {
+		for j, crop := range crops {
+			// Skip if image is smaller than target; the smallest size is
+			// always generated
+			var newWidth, newHeight int
+			var larger bool
+			if j == 0 {
+				newWidth, newHeight, larger = size.Dimensions(origWidth, origHeight)
+			} else {
+				newWidth, newHeight = size.cropDimensions(crop)
+				larger = cropped[j].Bounds().Dx() > newWidth
+			}
+			if !larger && i > 0 {
+				continue
+			}
 
-		// Create output path
-		thumbDir := filepath.Join(p.outputPath, "static", "thumbs", albumID)
-		if err := os.MkdirAll(thumbDir, 0755); err != nil {
-			return nil, err
-		}
+			var resized *image.NRGBA
+			if j == 0 {
+				resized = size.Render(img)
+			} else {
+				resized = size.renderAt(cropped[j], newWidth, newHeight)
+			}
 
-		ext := ".jpg" // always output JPEG for consistency
-		thumbPath := filepath.Join(thumbDir, fmt.Sprintf("%s_%s%s", photoID, sizeName, ext))
-		relPath := path.Join("/static/thumbs", albumID, fmt.Sprintf("%s_%s%s", photoID, sizeName, ext))
+			name := renditionName(photoID, size, crop)
+			thumbPath := filepath.Join(thumbDir, name+".jpg")
+			policy := p.metadataPolicy(size.Name)
+			icc := source.ICC
+			if policy.ConvertToSRGB && transform != nil {
+				transform.apply(resized)
+				icc = nil
+			}
+			exifData := buildEXIF(policy.tags(source.Tags, opts.Location))
 
-		// Resize with Lanczos filter for best quality
-		resized := imaging.Resize(img, newWidth, newHeight, imaging.Lanczos)
+			quality := size.Quality
+			if quality == 0 {
+				quality = p.quality
+			}
+			if err := saveJPEG(thumbPath, resized, quality, exifData, icc); err != nil {
+				return nil, err
+			}
 
-		if err := saveJPEG(thumbPath, resized, p.quality); err != nil {
-			return nil, err
-		}
+			// The other formats carry no color profile, so they always get
+			// sRGB pixels
+			if len(formats) > 1 {
+				srgb := resized
+				if icc != nil {
+					srgb = imaging.Clone(resized)
+					transform.apply(srgb)
+				}
+				if err := p.encodeFormats(srgb, thumbPath); err != nil {
+					return nil, err
+				}
+			}
 
-		thumbnails[sizeName] = relPath
+			for _, format := range formats {
+				renditions = append(renditions, Rendition{
+					Size:   size.Name,
+					Format: format,
+					Crop:   crop.Name,
+					Path:   path.Join("/static/thumbs", albumID, name+formatInfo[format].ext),
+					Width:  newWidth,
+					Height: newHeight,
+				})
+			}
+		}
 	}
 
-	return thumbnails, nil
+	return renditions, nil
 }
 
-func saveJPEG(path string, img image.Image, quality int) error {
-	out, err := os.Create(path)
-	if err != nil {
-		return err
+// renditionName returns the file name of a rendition without its extension,
+// e.g. photo_small or photo_small_4x3
+func renditionName(photoID string, size Size, crop Crop) string {
+	if crop.Name == "" {
+		return fmt.Sprintf("%s_%s", photoID, size.Name)
 	}
-	defer out.Close()
+	return fmt.Sprintf("%s_%s_%s", photoID, size.Name, crop.slug())
+}
 
-	return jpeg.Encode(out, img, &jpeg.Options{Quality: quality})
+// saveJPEG encodes img and writes it with the given EXIF and ICC payloads,
+// either of which may be nil
+func saveJPEG(path string, img image.Image, quality int, exifData, icc []byte) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return err
+	}
+	return writeJPEGWithMetadata(path, buf.Bytes(), exifData, icc)
 }
 
 // GetImageDimensions returns width and height of an image
 func GetImageDimensions(imgPath string) (int, int, error) {
+	if heif.IsHEIF(imgPath) {
+		info, err := heif.Read(imgPath)
+		if err != nil {
+			return 0, 0, err
+		}
+		return info.Width, info.Height, nil
+	}
+	if raw.IsRAW(imgPath) {
+		info, err := raw.Read(imgPath)
+		if err != nil {
+			return 0, 0, err
+		}
+		width, height := info.DisplaySize()
+		return width, height, nil
+	}
+
 	file, err := os.Open(imgPath)
 	if err != nil {
 		return 0, 0, err
@@ -6,34 +6,152 @@ import (
 
 // GalleryMetadata represents the overall gallery configuration
 type GalleryMetadata struct {
-	Title         string                     `yaml:"title" json:"title"`
-	Description   string                     `yaml:"description" json:"description"`
-	Author        string                     `yaml:"author" json:"author"`
-	Copyright     string                     `yaml:"copyright" json:"copyright"`
-	Theme         string                     `yaml:"theme,omitempty" json:"theme,omitempty"`
-	ShowLocations bool                       `yaml:"show_locations" json:"show_locations"`
-	AlbumOrder    []string                   `yaml:"album_order,omitempty" json:"album_order"`
-	Albums        map[string]*AlbumMetadata  `yaml:"albums" json:"albums"`
-	Photos        map[string]*PhotoMetadata  `yaml:"photos" json:"photos"`
+	Title             string                    `yaml:"title" json:"title"`
+	Description       string                    `yaml:"description" json:"description"`
+	Author            string                    `yaml:"author" json:"author"`
+	Copyright         string                    `yaml:"copyright" json:"copyright"`
+	BaseURL           string                    `yaml:"base_url,omitempty" json:"base_url,omitempty"` // public URL of the site, used for absolute links
+	Theme             string                    `yaml:"theme,omitempty" json:"theme,omitempty"`
+	ShowLocations     bool                      `yaml:"show_locations" json:"show_locations"`
+	PrivacyZones      []PrivacyZone             `yaml:"privacy_zones,omitempty" json:"privacy_zones,omitempty"`
+	AlbumOrder        []string                  `yaml:"album_order,omitempty" json:"album_order"`
+	Feeds             *FeedSettings             `yaml:"feeds,omitempty" json:"feeds,omitempty"`
+	Robots            *RobotsPolicy             `yaml:"robots,omitempty" json:"robots,omitempty"`
+	Rendering         *RenderingSettings        `yaml:"rendering,omitempty" json:"rendering,omitempty"`
+	ImageMetadata     *ImageMetadataSettings    `yaml:"image_metadata,omitempty" json:"image_metadata,omitempty"`
+	ImageFormats      []string                  `yaml:"image_formats,omitempty" json:"image_formats,omitempty"`           // formats written besides JPEG: webp, avif
+	AdjustmentPresets map[string]*Adjustments   `yaml:"adjustment_presets,omitempty" json:"adjustment_presets,omitempty"` // named tonal adjustments albums and photos can share
+	Albums            map[string]*AlbumMetadata `yaml:"albums" json:"albums"`
+	Photos            map[string]*PhotoMetadata `yaml:"photos" json:"photos"`
+	Stacks            []PhotoStack              `yaml:"stacks,omitempty" json:"stacks,omitempty"` // bursts and similar shots published as one photo
 }
 
+// FeedSettings controls the Atom, RSS and JSON feeds of new albums
+type FeedSettings struct {
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled,omitempty"` // don't publish feeds
+	Size     int  `yaml:"size,omitempty" json:"size,omitempty"`         // number of albums per feed, 20 if unset
+}
+
+// RobotsPolicy controls robots.txt and how search engines may index the gallery
+type RobotsPolicy struct {
+	NoIndex  bool     `yaml:"noindex,omitempty" json:"noindex,omitempty"`   // keep search engines away from the whole gallery
+	Disallow []string `yaml:"disallow,omitempty" json:"disallow,omitempty"` // extra paths crawlers should skip, e.g. /static/videos/
+}
+
+// RenderingSettings controls the image sizes generated for every photo
+type RenderingSettings struct {
+	Quality  int                    `yaml:"quality,omitempty" json:"quality,omitempty"`     // JPEG quality of sizes without their own, 95 if unset
+	Sizes    map[string]*RenderSize `yaml:"sizes,omitempty" json:"sizes,omitempty"`         // by name; overrides the built-in small, medium, large and full
+	Crops    []string               `yaml:"crops,omitempty" json:"crops,omitempty"`         // cropped renditions besides the full frame: square, 4:3, 16:9
+	CardCrop string                 `yaml:"card_crop,omitempty" json:"card_crop,omitempty"` // crop of album grids and covers, one of Crops; full frame if unset
+}
+
+// RenderSize is one generated image size. Set either LongEdge or Width.
+type RenderSize struct {
+	LongEdge int     `yaml:"long_edge,omitempty" json:"long_edge,omitempty"` // fit the longest side within this many pixels
+	Width    int     `yaml:"width,omitempty" json:"width,omitempty"`         // scale to this width whatever the orientation
+	Quality  int     `yaml:"quality,omitempty" json:"quality,omitempty"`     // JPEG quality, 1-100
+	Sharpen  float64 `yaml:"sharpen,omitempty" json:"sharpen,omitempty"`     // sharpening strength after resizing, e.g. 0.5; 0 for none
+	Disabled bool    `yaml:"disabled,omitempty" json:"disabled,omitempty"`   // don't generate this size
+}
+
+// ImageMetadataSettings controls the metadata written into generated images.
+// The top-level policy applies to every size; entries in Sizes override it
+// field by field for one size (small, medium, large or full).
+type ImageMetadataSettings struct {
+	ImageMetadataPolicy `yaml:",inline"`
+	Sizes               map[string]*ImageMetadataPolicy `yaml:"sizes,omitempty" json:"sizes,omitempty"`
+}
+
+// ImageMetadataPolicy says what an image size keeps from its source. Unset
+// fields fall back to the gallery-wide policy, then to the defaults.
+type ImageMetadataPolicy struct {
+	Color         string `yaml:"color,omitempty" json:"color,omitempty"`                   // "keep" the ICC profile (default) or convert to "srgb"
+	Copyright     *bool  `yaml:"copyright,omitempty" json:"copyright,omitempty"`           // write author and copyright, default true
+	Camera        *bool  `yaml:"camera,omitempty" json:"camera,omitempty"`                 // keep camera, lens, exposure and capture time, default true
+	SerialNumbers *bool  `yaml:"serial_numbers,omitempty" json:"serial_numbers,omitempty"` // keep body and lens serial numbers, default false
+	GPS           *bool  `yaml:"gps,omitempty" json:"gps,omitempty"`                       // write the published location, default false
+}
+
+// Image color handling
+const (
+	ColorKeep = "keep" // embed the source's ICC profile
+	ColorSRGB = "srgb" // convert pixels to sRGB and drop the profile
+)
+
+// PrivacyZone is an area whose photo locations are never published exactly
+type PrivacyZone struct {
+	Name      string  `yaml:"name,omitempty" json:"name,omitempty"`
+	Latitude  float64 `yaml:"latitude" json:"latitude"`
+	Longitude float64 `yaml:"longitude" json:"longitude"`
+	Radius    float64 `yaml:"radius" json:"radius"`                     // meters
+	Action    string  `yaml:"action,omitempty" json:"action,omitempty"` // "drop" (default) or "fuzz"
+}
+
+// Privacy zone actions
+const (
+	PrivacyDrop = "drop" // remove the location entirely
+	PrivacyFuzz = "fuzz" // replace the location with an approximate point
+)
+
 // AlbumMetadata represents metadata for a single album
 type AlbumMetadata struct {
-	Title       string    `yaml:"title" json:"title"`
-	Description string    `yaml:"description" json:"description"`
-	Date        time.Time `yaml:"date" json:"date"`
-	CoverPhoto  string    `yaml:"cover_photo" json:"cover_photo"`
-	Hidden      bool      `yaml:"hidden" json:"hidden"`
-	SortOrder   string    `yaml:"sort_order" json:"sort_order"` // "date", "name", "custom"
-	CustomOrder []string  `yaml:"custom_order" json:"custom_order"`
-	Tags        []string  `yaml:"tags" json:"tags"`
+	Title       string       `yaml:"title" json:"title"`
+	Description string       `yaml:"description" json:"description"`
+	Date        time.Time    `yaml:"date" json:"date"`
+	CoverPhoto  string       `yaml:"cover_photo" json:"cover_photo"`
+	Hidden      bool         `yaml:"hidden" json:"hidden"`
+	SortOrder   string       `yaml:"sort_order" json:"sort_order"` // "date", "date_desc", "name", "custom"
+	CustomOrder []string     `yaml:"custom_order" json:"custom_order"`
+	Tags        []string     `yaml:"tags" json:"tags"`
+	NoIndex     bool         `yaml:"noindex,omitempty" json:"noindex,omitempty"`         // leave out of the sitemap and mark pages noindex
+	Adjustments *Adjustments `yaml:"adjustments,omitempty" json:"adjustments,omitempty"` // tonal adjustments of photos without their own
 }
 
 // PhotoMetadata represents metadata for a single photo
 type PhotoMetadata struct {
-	Title       string   `yaml:"title" json:"title"`
-	Description string   `yaml:"description" json:"description"`
-	Tags        []string `yaml:"tags" json:"tags"`
-	Hidden      bool     `yaml:"hidden" json:"hidden"`
-	SortIndex   int      `yaml:"sort_index" json:"sort_index"`
+	Title       string       `yaml:"title" json:"title"`
+	Description string       `yaml:"description" json:"description"`
+	Tags        []string     `yaml:"tags" json:"tags"`
+	Hidden      bool         `yaml:"hidden" json:"hidden"`
+	SortIndex   int          `yaml:"sort_index" json:"sort_index"`
+	FocalPoint  *FocalPoint  `yaml:"focal_point,omitempty" json:"focal_point,omitempty"` // what crops keep in view; found from the image if unset
+	Rotate      int          `yaml:"rotate,omitempty" json:"rotate,omitempty"`           // clockwise degrees after EXIF orientation: 90, 180 or 270
+	Straighten  float64      `yaml:"straighten,omitempty" json:"straighten,omitempty"`   // clockwise degrees to level the horizon, up to 45 either way
+	Crop        *CropRegion  `yaml:"crop,omitempty" json:"crop,omitempty"`               // part of the rotated photo to publish
+	Adjustments *Adjustments `yaml:"adjustments,omitempty" json:"adjustments,omitempty"` // tonal adjustments, replacing the album's
+}
+
+// PhotoStack is a set of similar shots from one album, such as the frames of
+// a burst. Albums show only the pick; the others open from it.
+type PhotoStack struct {
+	Photos []string `yaml:"photos" json:"photos"`                 // photo paths, keyed like Photos
+	Pick   string   `yaml:"pick,omitempty" json:"pick,omitempty"` // the photo shown, the first if unset
+}
+
+// Adjustments are tonal changes applied to a photo before it is resized.
+// Values set here override those of the preset they name.
+type Adjustments struct {
+	Preset     string  `yaml:"preset,omitempty" json:"preset,omitempty"`         // one of the gallery's adjustment_presets to start from
+	Gamma      float64 `yaml:"gamma,omitempty" json:"gamma,omitempty"`           // midtones: above 1 lightens, below 1 darkens
+	Brightness float64 `yaml:"brightness,omitempty" json:"brightness,omitempty"` // percent, -100 to 100
+	Contrast   float64 `yaml:"contrast,omitempty" json:"contrast,omitempty"`     // percent, -100 to 100
+	Saturation float64 `yaml:"saturation,omitempty" json:"saturation,omitempty"` // percent, -100 (gray) to 500
+	Grayscale  bool    `yaml:"grayscale,omitempty" json:"grayscale,omitempty"`   // black and white
+}
+
+// CropRegion is a rectangle in a photo as fractions of its width and height,
+// measured from the top left
+type CropRegion struct {
+	X      float64 `yaml:"x" json:"x"`
+	Y      float64 `yaml:"y" json:"y"`
+	Width  float64 `yaml:"width" json:"width"`
+	Height float64 `yaml:"height" json:"height"`
+}
+
+// FocalPoint is a point in a photo as fractions of its width and height,
+// measured from the top left
+type FocalPoint struct {
+	X float64 `yaml:"x" json:"x"`
+	Y float64 `yaml:"y" json:"y"`
 }
\ No newline at end of file
@@ -0,0 +1,232 @@
+// Package raw finds the JPEG previews that cameras embed in their RAW files.
+// NEF, CR2, ARW and DNG files are TIFF containers whose IFDs point to one or
+// more JPEG renderings of the photo next to the sensor data; the largest of
+// them is usually full size.
+package raw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Extensions lists the RAW formats Purtypics reads
+var Extensions = []string{".nef", ".cr2", ".arw", ".dng"}
+
+// IsRAW reports whether a file is a camera RAW file, judging by its extension
+func IsRAW(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, raw := range Extensions {
+		if ext == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// Info describes the largest JPEG preview of a RAW file
+type Info struct {
+	Width       int // preview size as stored, before orientation
+	Height      int
+	Orientation int // EXIF orientation of the RAW file (1-8)
+
+	path   string
+	offset int64
+	length int64
+}
+
+// DisplaySize returns the preview's size with the orientation applied
+func (i *Info) DisplaySize() (int, int) {
+	if i.Orientation >= 5 && i.Orientation <= 8 {
+		return i.Height, i.Width
+	}
+	return i.Width, i.Height
+}
+
+// Preview reads the preview's JPEG data
+func (i *Info) Preview() ([]byte, error) {
+	f, err := os.Open(i.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data := make([]byte, i.length)
+	if _, err := f.ReadAt(data, i.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// TIFF tags that locate previews
+const (
+	tagCompression     = 0x0103
+	tagStripOffsets    = 0x0111
+	tagOrientation     = 0x0112
+	tagStripByteCounts = 0x0117
+	tagSubIFDs         = 0x014A
+	tagJPEGOffset      = 0x0201
+	tagJPEGLength      = 0x0202
+)
+
+// maxIFDs bounds the walk through corrupt or looping IFD chains
+const maxIFDs = 32
+
+// Read finds the largest JPEG preview in the RAW file at path
+func Read(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch string(header[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%s is not a TIFF-based RAW file", filepath.Base(path))
+	}
+
+	w := &walker{r: f, size: stat.Size(), order: order, seen: make(map[uint32]bool)}
+	best := &Info{path: path, Orientation: 1}
+
+	// IFD0 and the IFDs chained after it, then their SubIFDs
+	queue := []uint32{order.Uint32(header[4:])}
+	for len(queue) > 0 && len(w.seen) < maxIFDs {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset == 0 || w.seen[offset] {
+			continue
+		}
+		w.seen[offset] = true
+
+		ifd, next, err := w.readIFD(offset)
+		if err != nil {
+			continue
+		}
+		if len(w.seen) == 1 {
+			if v := ifd[tagOrientation]; len(v) == 1 && v[0] >= 1 && v[0] <= 8 {
+				best.Orientation = int(v[0])
+			}
+		}
+		queue = append(queue, next)
+		queue = append(queue, ifd[tagSubIFDs]...)
+
+		var offsets, lengths []uint32
+		if len(ifd[tagJPEGOffset]) == 1 && len(ifd[tagJPEGLength]) == 1 {
+			offsets, lengths = ifd[tagJPEGOffset], ifd[tagJPEGLength]
+		} else if c := ifd[tagCompression]; len(c) == 1 && (c[0] == 6 || c[0] == 7) &&
+			len(ifd[tagStripOffsets]) == 1 && len(ifd[tagStripByteCounts]) == 1 {
+			offsets, lengths = ifd[tagStripOffsets], ifd[tagStripByteCounts]
+		}
+		if offsets != nil {
+			w.consider(best, int64(offsets[0]), int64(lengths[0]))
+		}
+	}
+
+	if best.length == 0 {
+		return nil, fmt.Errorf("no JPEG preview in %s", filepath.Base(path))
+	}
+	return best, nil
+}
+
+// walker reads IFDs of a TIFF file
+type walker struct {
+	r     io.ReaderAt
+	size  int64 // of the file, which previews must fit inside
+	order binary.ByteOrder
+	seen  map[uint32]bool
+}
+
+// readIFD returns the SHORT and LONG values of an IFD's entries by tag, and
+// the offset of the next IFD
+func (w *walker) readIFD(offset uint32) (map[uint32][]uint32, uint32, error) {
+	var countBuf [2]byte
+	if _, err := w.r.ReadAt(countBuf[:], int64(offset)); err != nil {
+		return nil, 0, err
+	}
+	count := int(w.order.Uint16(countBuf[:]))
+	buf := make([]byte, count*12+4)
+	if _, err := w.r.ReadAt(buf, int64(offset)+2); err != nil {
+		return nil, 0, err
+	}
+
+	ifd := make(map[uint32][]uint32)
+	for i := 0; i < count; i++ {
+		entry := buf[i*12 : i*12+12]
+		tag := uint32(w.order.Uint16(entry))
+		typ := w.order.Uint16(entry[2:])
+		n := int(w.order.Uint32(entry[4:]))
+
+		size := 0
+		switch typ {
+		case 3: // SHORT
+			size = 2
+		case 4, 13: // LONG, IFD
+			size = 4
+		default:
+			continue
+		}
+		if n <= 0 || n > 256 {
+			continue
+		}
+
+		value := entry[8:12]
+		if n*size > 4 {
+			value = make([]byte, n*size)
+			if _, err := w.r.ReadAt(value, int64(w.order.Uint32(entry[8:]))); err != nil {
+				continue
+			}
+		}
+		values := make([]uint32, n)
+		for j := range values {
+			if size == 2 {
+				values[j] = uint32(w.order.Uint16(value[j*2:]))
+			} else {
+				values[j] = w.order.Uint32(value[j*4:])
+			}
+		}
+		ifd[tag] = values
+	}
+	return ifd, w.order.Uint32(buf[count*12:]), nil
+}
+
+// consider makes the JPEG at offset the preview if it is larger than the
+// current one. Lossless JPEG sensor data fails to decode and is skipped, as
+// is a preview running past the end of the file, whose length can't be
+// trusted for the read.
+func (w *walker) consider(best *Info, offset, length int64) {
+	if length < 4 || offset > w.size || length > w.size-offset {
+		return
+	}
+	section := io.NewSectionReader(w.r, offset, length)
+	var soi [2]byte
+	if _, err := section.ReadAt(soi[:], 0); err != nil || !bytes.Equal(soi[:], []byte{0xFF, 0xD8}) {
+		return
+	}
+	config, err := jpeg.DecodeConfig(section)
+	if err != nil {
+		return
+	}
+	if config.Width*config.Height > best.Width*best.Height {
+		best.Width, best.Height = config.Width, config.Height
+		best.offset, best.length = offset, length
+	}
+}
@@ -0,0 +1,136 @@
+package raw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encodeJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// ifd encodes an IFD of SHORT and LONG entries, sorted by the caller
+func ifd(entries [][3]uint32, next uint32) []byte {
+	le := binary.LittleEndian
+	out := le.AppendUint16(nil, uint16(len(entries)))
+	for _, e := range entries {
+		out = le.AppendUint16(out, uint16(e[0]))
+		out = le.AppendUint16(out, uint16(e[1]))
+		out = le.AppendUint32(out, 1)
+		if e[1] == 3 {
+			out = le.AppendUint16(out, uint16(e[2]))
+			out = le.AppendUint16(out, 0)
+		} else {
+			out = le.AppendUint32(out, e[2])
+		}
+	}
+	return le.AppendUint32(out, next)
+}
+
+func TestReadPicksLargestPreview(t *testing.T) {
+	small := encodeJPEG(t, 8, 6)
+	large := encodeJPEG(t, 32, 24)
+
+	// Layout: header, IFD0 (4 entries), SubIFD (3 entries), small, large
+	const ifd0At, subAt = 8, 8 + 2 + 4*12 + 4
+	smallAt := uint32(subAt + 2 + 3*12 + 4)
+	largeAt := smallAt + uint32(len(small))
+
+	file := []byte("II*\x00")
+	file = binary.LittleEndian.AppendUint32(file, ifd0At)
+	file = append(file, ifd([][3]uint32{
+		{tagOrientation, 3, 6},
+		{tagSubIFDs, 4, subAt},
+		{tagJPEGOffset, 4, smallAt},
+		{tagJPEGLength, 4, uint32(len(small))},
+	}, 0)...)
+	file = append(file, ifd([][3]uint32{
+		{tagCompression, 3, 6},
+		{tagStripOffsets, 4, largeAt},
+		{tagStripByteCounts, 4, uint32(len(large))},
+	}, 0)...)
+	file = append(append(file, small...), large...)
+
+	path := filepath.Join(t.TempDir(), "DSC_0001.NEF")
+	if err := os.WriteFile(path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if info.Width != 32 || info.Height != 24 {
+		t.Errorf("preview = %dx%d, want 32x24", info.Width, info.Height)
+	}
+	if info.Orientation != 6 {
+		t.Errorf("orientation = %d, want 6", info.Orientation)
+	}
+	if w, h := info.DisplaySize(); w != 24 || h != 32 {
+		t.Errorf("display size = %dx%d, want 24x32", w, h)
+	}
+	data, err := info.Preview()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, large) {
+		t.Error("Preview returned the wrong JPEG")
+	}
+}
+
+func TestReadSkipsPreviewPastEnd(t *testing.T) {
+	small := encodeJPEG(t, 8, 6)
+	large := encodeJPEG(t, 32, 24)
+
+	// The large preview claims to run far past the end of the file
+	const ifd0At, subAt = 8, 8 + 2 + 3*12 + 4
+	smallAt := uint32(subAt + 2 + 2*12 + 4)
+	largeAt := smallAt + uint32(len(small))
+
+	file := []byte("II*\x00")
+	file = binary.LittleEndian.AppendUint32(file, ifd0At)
+	file = append(file, ifd([][3]uint32{
+		{tagSubIFDs, 4, subAt},
+		{tagJPEGOffset, 4, smallAt},
+		{tagJPEGLength, 4, uint32(len(small))},
+	}, 0)...)
+	file = append(file, ifd([][3]uint32{
+		{tagJPEGOffset, 4, largeAt},
+		{tagJPEGLength, 4, 0xFFFFFFF0},
+	}, 0)...)
+	file = append(append(file, small...), large...)
+
+	path := filepath.Join(t.TempDir(), "DSC_0001.NEF")
+	if err := os.WriteFile(path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if info.Width != 8 || info.Height != 6 {
+		t.Errorf("preview = %dx%d, want the 8x6 one that fits in the file", info.Width, info.Height)
+	}
+}
+
+func TestIsRAW(t *testing.T) {
+	for path, want := range map[string]bool{
+		"a.NEF": true, "b.cr2": true, "c.arw": true, "d.DNG": true,
+		"e.jpg": false, "f.heic": false,
+	} {
+		if got := IsRAW(path); got != want {
+			t.Errorf("IsRAW(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -12,7 +12,8 @@ import (
 // Processor handles video operations
 
 type Processor struct {
-	outputPath string
+	outputPath    string
+	stripMetadata bool // remux copies without container metadata such as the location
 }
 
 // NewProcessor creates a new video processor
@@ -22,6 +23,12 @@ func NewProcessor(outputPath string) *Processor {
 	}
 }
 
+// SetStripMetadata makes CopyVideoToStatic drop the container metadata of
+// videos, including the recording location, by remuxing them with ffmpeg
+func (p *Processor) SetStripMetadata(strip bool) {
+	p.stripMetadata = strip
+}
+
 // ExtractThumbnail extracts a frame from video as thumbnail
 func (p *Processor) ExtractThumbnail(videoPath, albumID, photoID string) (string, error) {
 	// Create output directory
@@ -38,8 +45,12 @@ func (p *Processor) ExtractThumbnail(videoPath, albumID, photoID string) (string
 	thumbPath := filepath.Join(thumbDir, fmt.Sprintf("%s_poster.jpg", basePhotoID))
 	relPath := path.Join("/static/thumbs", albumID, fmt.Sprintf("%s_poster.jpg", basePhotoID))
 
-	// Check if thumbnail already exists
-	if _, err := os.Stat(thumbPath); err == nil {
+	// Reuse an existing thumbnail unless the video is newer
+	sourceInfo, err := os.Stat(videoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat video file: %w", err)
+	}
+	if thumbInfo, err := os.Stat(thumbPath); err == nil && !thumbInfo.ModTime().Before(sourceInfo.ModTime()) {
 		return relPath, nil
 	}
 
@@ -113,7 +124,8 @@ func GetVideoDimensions(videoPath string) (int, int, error) {
 	return width, height, nil
 }
 
-// CopyVideoToStatic copies the video file to the static directory
+// CopyVideoToStatic copies the video file to the static directory. With
+// SetStripMetadata the copy is remuxed without its metadata instead.
 func (p *Processor) CopyVideoToStatic(videoPath, albumID, photoID string) (string, error) {
 	// Create output directory
 	videoDir := filepath.Join(p.outputPath, "static", "videos", albumID)
@@ -134,8 +146,20 @@ func (p *Processor) CopyVideoToStatic(videoPath, albumID, photoID string) (strin
 		relPath = path.Join("/static/videos", albumID, fmt.Sprintf("%s%s", photoID, ext))
 	}
 
-	// Check if already exists
-	if _, err := os.Stat(destPath); err == nil {
+	if p.stripMetadata {
+		if err := remuxWithoutMetadata(videoPath, destPath); err != nil {
+			return "", err
+		}
+		return relPath, nil
+	}
+
+	// Reuse an existing copy unless the video changed since it was made
+	sourceInfo, err := os.Stat(videoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat video file: %w", err)
+	}
+	if destInfo, err := os.Stat(destPath); err == nil &&
+		destInfo.Size() == sourceInfo.Size() && !destInfo.ModTime().Before(sourceInfo.ModTime()) {
 		return relPath, nil
 	}
 
@@ -157,4 +181,32 @@ func (p *Processor) CopyVideoToStatic(videoPath, albumID, photoID string) (strin
 	}
 
 	return relPath, nil
-}
\ No newline at end of file
+}
+
+// remuxWithoutMetadata copies the video and audio streams of a video into
+// destPath without re-encoding them, leaving out global and per-stream
+// metadata such as QuickTime location atoms, chapters and data tracks
+func remuxWithoutMetadata(videoPath, destPath string) error {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("ffmpeg not found, cannot remove the video's location")
+	}
+
+	// Write beside the destination so a failed run never leaves a partial
+	// video in its place
+	tmpPath := destPath + ".tmp" + filepath.Ext(destPath)
+	cmd := exec.Command("ffmpeg",
+		"-i", videoPath,
+		"-map", "0:v",
+		"-map", "0:a?",
+		"-map_metadata", "-1",
+		"-map_chapters", "-1",
+		"-c", "copy",
+		"-y",
+		tmpPath,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to remux video: %v, output: %s", err, string(output))
+	}
+	return os.Rename(tmpPath, destPath)
+}
@@ -0,0 +1,31 @@
+package video
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyVideoToStatic_StripMetadata(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "clip.mov")
+	if err := os.WriteFile(src, []byte("not really a movie"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	p := NewProcessor(out)
+
+	rel, err := p.CopyVideoToStatic(src, "trip", "clip")
+	if err != nil || rel != "/static/videos/trip/clip.mov" {
+		t.Fatalf("plain copy = %q, %v", rel, err)
+	}
+
+	// Without ffmpeg the location can't be removed, so nothing is published
+	t.Setenv("PATH", t.TempDir())
+	p.SetStripMetadata(true)
+	if _, err := p.CopyVideoToStatic(src, "trip", "other"); err == nil {
+		t.Fatal("stripped copy succeeded without ffmpeg")
+	}
+	if _, err := os.Stat(filepath.Join(out, "static", "videos", "trip", "other.mov")); err == nil {
+		t.Error("video published with its metadata")
+	}
+}